@@ -0,0 +1,608 @@
+package blnkgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ChartKeyMetaKey is the identity metadata key holding the spec key, which is
+// how Plan finds identities created by Apply.
+const ChartKeyMetaKey = "chart_key"
+
+// ErrChartConflict is returned by Apply when the plan has conflicts.
+var ErrChartConflict = errors.New("chart of accounts has conflicts")
+
+// ChartOfAccounts declares identities, ledgers and their balances. Ledgers are
+// matched by name, balances by indicator and currency, and identities by Key.
+type ChartOfAccounts struct {
+	Identities []ChartIdentity `json:"identities,omitempty"`
+	Ledgers    []ChartLedger   `json:"ledgers"`
+}
+
+// ChartIdentity is an identity referenced by balances through Key.
+type ChartIdentity struct {
+	Key string `json:"key"`
+	Identity
+}
+
+// ChartLedger is a ledger and the balances it holds.
+type ChartLedger struct {
+	Name     string         `json:"name"`
+	MetaData MetaData       `json:"meta_data,omitempty"`
+	Balances []ChartBalance `json:"balances,omitempty"`
+}
+
+// ChartBalance is an indicator balance. Identity is the Key of a
+// ChartIdentity.
+type ChartBalance struct {
+	Indicator          string             `json:"indicator"`
+	Currency           string             `json:"currency"`
+	Identity           string             `json:"identity,omitempty"`
+	TrackFundLineage   bool               `json:"track_fund_lineage,omitempty"`
+	AllocationStrategy AllocationStrategy `json:"allocation_strategy,omitempty"`
+	MetaData           MetaData           `json:"meta_data,omitempty"`
+}
+
+// ParseChartOfAccountsJSON decodes and validates a JSON chart of accounts.
+func ParseChartOfAccountsJSON(data []byte) (*ChartOfAccounts, error) {
+	var chart ChartOfAccounts
+	if err := json.Unmarshal(data, &chart); err != nil {
+		return nil, fmt.Errorf("chart error: %w", err)
+	}
+	if err := ValidateChartOfAccounts(chart); err != nil {
+		return nil, err
+	}
+	return &chart, nil
+}
+
+// ParseChartOfAccountsYAML decodes and validates a YAML chart of accounts. It
+// uses the same field names as the JSON form.
+func ParseChartOfAccountsYAML(data []byte) (*ChartOfAccounts, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("chart error: %w", err)
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("chart error: %w", err)
+	}
+	return ParseChartOfAccountsJSON(data)
+}
+
+// LoadChartOfAccounts reads a chart of accounts from a .json, .yaml or .yml
+// file.
+func LoadChartOfAccounts(path string) (*ChartOfAccounts, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ParseChartOfAccountsJSON(data)
+	case ".yaml", ".yml":
+		return ParseChartOfAccountsYAML(data)
+	default:
+		return nil, fmt.Errorf("chart error: unsupported chart file extension %q", filepath.Ext(path))
+	}
+}
+
+// ValidateChartOfAccounts checks names and keys are set and unique, balances
+// reference declared identities and allocation strategies are valid.
+func ValidateChartOfAccounts(chart ChartOfAccounts) error {
+	identities := map[string]struct{}{}
+	for i, id := range chart.Identities {
+		if id.Key == "" {
+			return fmt.Errorf("validation error: identity at index %d has no key", i)
+		}
+		if _, dup := identities[id.Key]; dup {
+			return fmt.Errorf("validation error: duplicate identity key %q", id.Key)
+		}
+		if id.IdentityID != "" {
+			return fmt.Errorf("validation error: identity %q must not set identity_id", id.Key)
+		}
+		if err := ValidateCreateIdentity(id.Identity); err != nil {
+			return fmt.Errorf("validation error: identity %q: %w", id.Key, err)
+		}
+		identities[id.Key] = struct{}{}
+	}
+
+	ledgers := map[string]struct{}{}
+	balances := map[string]struct{}{}
+	for i, l := range chart.Ledgers {
+		if l.Name == "" {
+			return fmt.Errorf("validation error: ledger at index %d has no name", i)
+		}
+		if _, dup := ledgers[l.Name]; dup {
+			return fmt.Errorf("validation error: duplicate ledger %q", l.Name)
+		}
+		ledgers[l.Name] = struct{}{}
+
+		for _, b := range l.Balances {
+			if b.Indicator == "" || b.Currency == "" {
+				return fmt.Errorf("validation error: balances in ledger %q need an indicator and currency", l.Name)
+			}
+			key := BalanceIndicatorKey(b.Indicator, b.Currency)
+			if _, dup := balances[key]; dup {
+				return fmt.Errorf("validation error: duplicate balance %s %s", b.Indicator, b.Currency)
+			}
+			balances[key] = struct{}{}
+			if _, ok := identities[b.Identity]; b.Identity != "" && !ok {
+				return fmt.Errorf("validation error: balance %s %s references unknown identity %q", b.Indicator, b.Currency, b.Identity)
+			}
+			if b.TrackFundLineage && b.Identity == "" {
+				return fmt.Errorf("validation error: balance %s %s tracks fund lineage and needs an identity", b.Indicator, b.Currency)
+			}
+			if s := normalizeAllocationStrategy(b.AllocationStrategy); s != "" && !isValidAllocationStrategy(s) {
+				return fmt.Errorf("validation error: balance %s %s has invalid allocation strategy: %s", b.Indicator, b.Currency, b.AllocationStrategy)
+			}
+		}
+	}
+	return nil
+}
+
+// ChartResource is the kind of object a ChartChange applies to.
+type ChartResource string
+
+const (
+	ChartResourceIdentity ChartResource = "identity"
+	ChartResourceLedger   ChartResource = "ledger"
+	ChartResourceBalance  ChartResource = "balance"
+)
+
+// ChartAction is what Apply does for a ChartChange. Conflicts are differences
+// Apply cannot fix, such as a balance in another ledger.
+type ChartAction string
+
+const (
+	ChartActionNone     ChartAction = "none"
+	ChartActionCreate   ChartAction = "create"
+	ChartActionUpdate   ChartAction = "update"
+	ChartActionConflict ChartAction = "conflict"
+)
+
+// ChartChange is the planned action for one spec entry. Key is the identity
+// key, the ledger name, or the balance indicator and currency (see
+// BalanceIndicatorKey). ID is the Core ID once known. Diff describes each
+// differing field as "field: current -> desired".
+type ChartChange struct {
+	Resource ChartResource `json:"resource"`
+	Key      string        `json:"key"`
+	Action   ChartAction   `json:"action"`
+	ID       string        `json:"id,omitempty"`
+	Diff     []string      `json:"diff,omitempty"`
+
+	identity *ChartIdentity
+	ledger   *ChartLedger
+	balance  *ChartBalance
+	// ledgerName is the ledger holding a balance.
+	ledgerName string
+	// update is the full identity body for identity updates.
+	update *Identity
+	// metaData holds the metadata keys to set on ledgers and balances.
+	metaData MetaData
+	// linkIdentity is the identity key to link a balance to.
+	linkIdentity string
+}
+
+// ChartPlan lists a change for every spec entry: identities, then ledgers,
+// then balances in spec order.
+type ChartPlan struct {
+	Changes []ChartChange `json:"changes"`
+}
+
+// HasChanges reports whether Apply would create or update anything.
+func (p *ChartPlan) HasChanges() bool {
+	for _, c := range p.Changes {
+		if c.Action == ChartActionCreate || c.Action == ChartActionUpdate {
+			return true
+		}
+	}
+	return false
+}
+
+// Conflicts returns the changes Apply cannot make.
+func (p *ChartPlan) Conflicts() []ChartChange {
+	var out []ChartChange
+	for _, c := range p.Changes {
+		if c.Action == ChartActionConflict {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// WriteText writes one line per change prefixed with "+" (create), "~"
+// (update), "!" (conflict) or " " (none), followed by its diff lines.
+func (p *ChartPlan) WriteText(w io.Writer) error {
+	markers := map[ChartAction]string{
+		ChartActionNone:     " ",
+		ChartActionCreate:   "+",
+		ChartActionUpdate:   "~",
+		ChartActionConflict: "!",
+	}
+	for _, c := range p.Changes {
+		line := fmt.Sprintf("%s %s %s", markers[c.Action], c.Resource, c.Key)
+		if c.ID != "" {
+			line += " (" + c.ID + ")"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		for _, d := range c.Diff {
+			if _, err := fmt.Fprintln(w, "    "+d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ChartPlanner diffs a ChartOfAccounts against Core and applies it.
+type ChartPlanner struct {
+	ledgers    *LedgerService
+	balances   *LedgerBalanceService
+	identities *IdentityService
+	metadata   *MetadataService
+}
+
+func NewChartPlanner(ledgers *LedgerService, balances *LedgerBalanceService, identities *IdentityService, metadata *MetadataService) *ChartPlanner {
+	return &ChartPlanner{ledgers: ledgers, balances: balances, identities: identities, metadata: metadata}
+}
+
+// Plan looks up every spec entry in Core, identities by their chart_key
+// metadata and ledgers by name with Filter, balances with GetByIndicator, and
+// returns the changes needed. Metadata keys present in Core but not in the
+// spec are left alone.
+func (c *ChartPlanner) Plan(chart ChartOfAccounts) (*ChartPlan, error) {
+	if err := ValidateChartOfAccounts(chart); err != nil {
+		return nil, err
+	}
+	plan := &ChartPlan{}
+
+	identityIDs := map[string]string{}
+	for i := range chart.Identities {
+		change, err := c.planIdentity(&chart.Identities[i])
+		if err != nil {
+			return nil, err
+		}
+		identityIDs[change.Key] = change.ID
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	ledgerIDs := map[string]string{}
+	for i := range chart.Ledgers {
+		change, err := c.planLedger(&chart.Ledgers[i])
+		if err != nil {
+			return nil, err
+		}
+		ledgerIDs[change.Key] = change.ID
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	for i := range chart.Ledgers {
+		l := &chart.Ledgers[i]
+		for j := range l.Balances {
+			change, err := c.planBalance(l.Name, ledgerIDs[l.Name], &l.Balances[j], identityIDs)
+			if err != nil {
+				return nil, err
+			}
+			plan.Changes = append(plan.Changes, change)
+		}
+	}
+	return plan, nil
+}
+
+func (c *ChartPlanner) planIdentity(spec *ChartIdentity) (ChartChange, error) {
+	change := ChartChange{Resource: ChartResourceIdentity, Key: spec.Key, identity: spec}
+	found, err := filterAll[Identity](c.identities.Filter, FilterParams{
+		Filters: []Filter{{Field: "meta_data." + ChartKeyMetaKey, Operator: OpEqual, Value: spec.Key}},
+	})
+	if err != nil {
+		return change, fmt.Errorf("chart plan: identity %s: %w", spec.Key, err)
+	}
+	switch len(found) {
+	case 0:
+		change.Action = ChartActionCreate
+		return change, nil
+	case 1:
+	default:
+		change.Action = ChartActionConflict
+		change.Diff = []string{fmt.Sprintf("%d identities have %s %q", len(found), ChartKeyMetaKey, spec.Key)}
+		return change, nil
+	}
+
+	have := found[0]
+	change.ID = have.IdentityID
+	update, diff, err := identityUpdate(spec.Identity, have)
+	if err != nil {
+		return change, fmt.Errorf("chart plan: identity %s: %w", spec.Key, err)
+	}
+	change.Action = ChartActionNone
+	if len(diff) > 0 {
+		change.Action = ChartActionUpdate
+		change.Diff = diff
+		change.update = update
+	}
+	return change, nil
+}
+
+func (c *ChartPlanner) planLedger(spec *ChartLedger) (ChartChange, error) {
+	change := ChartChange{Resource: ChartResourceLedger, Key: spec.Name, ledger: spec}
+	found, err := filterAll[Ledger](c.ledgers.Filter, FilterParams{
+		Filters: []Filter{{Field: "name", Operator: OpEqual, Value: spec.Name}},
+	})
+	if err != nil {
+		return change, fmt.Errorf("chart plan: ledger %s: %w", spec.Name, err)
+	}
+	switch len(found) {
+	case 0:
+		change.Action = ChartActionCreate
+		return change, nil
+	case 1:
+	default:
+		change.Action = ChartActionConflict
+		change.Diff = []string{fmt.Sprintf("%d ledgers are named %q", len(found), spec.Name)}
+		return change, nil
+	}
+
+	change.ID = found[0].LedgerID
+	change.metaData, change.Diff = metaDataDiff(spec.MetaData, found[0].MetaData)
+	change.Action = ChartActionNone
+	if len(change.Diff) > 0 {
+		change.Action = ChartActionUpdate
+	}
+	return change, nil
+}
+
+func (c *ChartPlanner) planBalance(ledgerName, ledgerID string, spec *ChartBalance, identityIDs map[string]string) (ChartChange, error) {
+	change := ChartChange{
+		Resource:   ChartResourceBalance,
+		Key:        BalanceIndicatorKey(spec.Indicator, spec.Currency),
+		ledgerName: ledgerName,
+		balance:    spec,
+	}
+	have, resp, err := c.balances.GetByIndicator(spec.Indicator, spec.Currency)
+	if isNotFound(resp, err) {
+		change.Action = ChartActionCreate
+		return change, nil
+	}
+	if err != nil {
+		return change, fmt.Errorf("chart plan: balance %s: %w", change.Key, err)
+	}
+	change.ID = have.BalanceID
+
+	var conflicts []string
+	if have.LedgerID != ledgerID {
+		conflicts = append(conflicts, fmt.Sprintf("ledger_id: %q -> ledger %q (balances cannot move)", have.LedgerID, ledgerName))
+	}
+	if have.TrackFundLineage != spec.TrackFundLineage {
+		conflicts = append(conflicts, fmt.Sprintf("track_fund_lineage: %t -> %t (cannot be changed)", have.TrackFundLineage, spec.TrackFundLineage))
+	}
+	if want := normalizeAllocationStrategy(spec.AllocationStrategy); want != "" && want != normalizeAllocationStrategy(have.AllocationStrategy) {
+		conflicts = append(conflicts, fmt.Sprintf("allocation_strategy: %q -> %q (cannot be changed)", have.AllocationStrategy, want))
+	}
+	if len(conflicts) > 0 {
+		change.Action = ChartActionConflict
+		change.Diff = conflicts
+		return change, nil
+	}
+
+	change.metaData, change.Diff = metaDataDiff(spec.MetaData, have.MetaData)
+	if spec.Identity != "" {
+		if want := identityIDs[spec.Identity]; want == "" || want != have.IdentityID {
+			change.linkIdentity = spec.Identity
+			change.Diff = append(change.Diff, fmt.Sprintf("identity_id: %q -> identity %q", have.IdentityID, spec.Identity))
+		}
+	}
+	change.Action = ChartActionNone
+	if len(change.Diff) > 0 {
+		change.Action = ChartActionUpdate
+	}
+	return change, nil
+}
+
+// Apply plans the chart and makes every create and update, identities first
+// so balances can be linked to them. Nothing is changed when the plan has
+// conflicts; the plan is returned with ErrChartConflict. Applying the same
+// chart again plans no changes. On failure the plan is returned with the IDs
+// resolved so far.
+func (c *ChartPlanner) Apply(chart ChartOfAccounts) (*ChartPlan, error) {
+	plan, err := c.Plan(chart)
+	if err != nil {
+		return nil, err
+	}
+	if conflicts := plan.Conflicts(); len(conflicts) > 0 {
+		return plan, fmt.Errorf("%w: %d to resolve", ErrChartConflict, len(conflicts))
+	}
+
+	identityIDs := map[string]string{}
+	ledgerIDs := map[string]string{}
+	for i := range plan.Changes {
+		change := &plan.Changes[i]
+		var err error
+		switch change.Resource {
+		case ChartResourceIdentity:
+			err = c.applyIdentity(change)
+			identityIDs[change.Key] = change.ID
+		case ChartResourceLedger:
+			err = c.applyLedger(change)
+			ledgerIDs[change.Key] = change.ID
+		case ChartResourceBalance:
+			err = c.applyBalance(change, ledgerIDs[change.ledgerName], identityIDs)
+		}
+		if err != nil {
+			return plan, fmt.Errorf("chart apply: %s %s: %w", change.Resource, change.Key, err)
+		}
+	}
+	return plan, nil
+}
+
+func (c *ChartPlanner) applyIdentity(change *ChartChange) error {
+	switch change.Action {
+	case ChartActionCreate:
+		body := change.identity.Identity
+		body.MetaData = mergeMetaData(body.MetaData, MetaData{ChartKeyMetaKey: change.Key})
+		created, _, err := c.identities.Create(body)
+		if err != nil {
+			return err
+		}
+		change.ID = created.IdentityId
+	case ChartActionUpdate:
+		_, _, err := c.identities.Update(change.ID, change.update)
+		return err
+	}
+	return nil
+}
+
+func (c *ChartPlanner) applyLedger(change *ChartChange) error {
+	switch change.Action {
+	case ChartActionCreate:
+		created, _, err := c.ledgers.Create(CreateLedgerRequest{Name: change.ledger.Name, MetaData: change.ledger.MetaData})
+		if err != nil {
+			return err
+		}
+		change.ID = created.LedgerID
+	case ChartActionUpdate:
+		_, _, err := c.metadata.UpdateMetadata(change.ID, UpdateMetaDataRequest{MetaData: change.metaData})
+		return err
+	}
+	return nil
+}
+
+func (c *ChartPlanner) applyBalance(change *ChartChange, ledgerID string, identityIDs map[string]string) error {
+	spec := change.balance
+	switch change.Action {
+	case ChartActionCreate:
+		created, _, err := c.balances.Create(CreateLedgerBalanceRequest{
+			LedgerID:           ledgerID,
+			IdentityID:         identityIDs[spec.Identity],
+			Indicator:          spec.Indicator,
+			Currency:           spec.Currency,
+			TrackFundLineage:   spec.TrackFundLineage,
+			AllocationStrategy: normalizeAllocationStrategy(spec.AllocationStrategy),
+			MetaData:           spec.MetaData,
+		})
+		if err != nil {
+			return err
+		}
+		change.ID = created.BalanceID
+	case ChartActionUpdate:
+		if len(change.metaData) > 0 {
+			if _, _, err := c.metadata.UpdateMetadata(change.ID, UpdateMetaDataRequest{MetaData: change.metaData}); err != nil {
+				return err
+			}
+		}
+		if change.linkIdentity != "" {
+			_, _, err := c.balances.UpdateIdentity(change.ID, UpdateBalanceIdentityRequest{IdentityID: identityIDs[change.linkIdentity]})
+			return err
+		}
+	}
+	return nil
+}
+
+// identityUpdate overlays the non-empty fields of want on have and describes
+// the fields that change. Metadata is merged.
+func identityUpdate(want, have Identity) (*Identity, []string, error) {
+	wantFields, err := jsonFields(want)
+	if err != nil {
+		return nil, nil, err
+	}
+	haveFields, err := jsonFields(have)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var diff []string
+	for _, field := range sortedKeys(wantFields) {
+		value := wantFields[field]
+		if field == "identity_id" || field == "meta_data" || value == nil || value == "" {
+			continue
+		}
+		if !sameJSON(value, haveFields[field]) {
+			diff = append(diff, fmt.Sprintf("%s: %s -> %s", field, jsonText(haveFields[field]), jsonText(value)))
+			haveFields[field] = value
+		}
+	}
+	metaData, metaDiff := metaDataDiff(want.MetaData, have.MetaData)
+	diff = append(diff, metaDiff...)
+	if len(diff) == 0 {
+		return nil, nil, nil
+	}
+
+	data, err := json.Marshal(haveFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	var update Identity
+	if err := json.Unmarshal(data, &update); err != nil {
+		return nil, nil, err
+	}
+	update.MetaData = mergeMetaData(have.MetaData, metaData)
+	return &update, diff, nil
+}
+
+// metaDataDiff returns the keys of want missing from or different in have,
+// with one diff line each.
+func metaDataDiff(want, have MetaData) (MetaData, []string) {
+	var changed MetaData
+	var diff []string
+	for _, key := range sortedKeys(want) {
+		current, ok := have[key]
+		if ok && sameJSON(want[key], current) {
+			continue
+		}
+		if changed == nil {
+			changed = MetaData{}
+		}
+		changed[key] = want[key]
+		was := "<unset>"
+		if ok {
+			was = jsonText(current)
+		}
+		diff = append(diff, fmt.Sprintf("meta_data.%s: %s -> %s", key, was, jsonText(want[key])))
+	}
+	return changed, diff
+}
+
+func mergeMetaData(base, overlay MetaData) MetaData {
+	if len(base) == 0 && len(overlay) == 0 {
+		return nil
+	}
+	out := MetaData{}
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range overlay {
+		out[k] = v
+	}
+	return out
+}
+
+func jsonFields(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	return fields, json.Unmarshal(data, &fields)
+}
+
+// sameJSON compares values by their JSON encoding, so 5 and 5.0 are equal.
+func sameJSON(a, b interface{}) bool {
+	return jsonText(a) == jsonText(b)
+}
+
+func jsonText(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,221 @@
+package blnkgo_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const chartYAML = `
+identities:
+  - key: treasury
+    identity_type: organization
+    organization_name: Acme Treasury
+    category: internal
+ledgers:
+  - name: Revenue
+    meta_data:
+      region: us
+    balances:
+      - indicator: "@fees"
+        currency: USD
+        identity: treasury
+      - indicator: "@float"
+        currency: USD
+  - name: Customers
+    balances:
+      - indicator: "@customer-1"
+        currency: USD
+        identity: treasury
+        track_fund_lineage: true
+        allocation_strategy: fifo
+        meta_data:
+          tier: 2
+`
+
+func setupChartPlanner() (*MockClient, *blnkgo.ChartPlanner) {
+	mockClient := &MockClient{}
+	planner := blnkgo.NewChartPlanner(
+		blnkgo.NewLedgerService(mockClient),
+		blnkgo.NewLedgerBalanceService(mockClient),
+		blnkgo.NewIdentityService(mockClient),
+		blnkgo.NewMetadataService(mockClient),
+	)
+	return mockClient, planner
+}
+
+func chartRequest(path string) *http.Request {
+	return &http.Request{URL: &url.URL{Path: path}}
+}
+
+func onChartPath(path string) interface{} {
+	return mock.MatchedBy(func(r *http.Request) bool { return r.URL != nil && r.URL.Path == path })
+}
+
+// mockChartLookups answers the identity and ledger filters from existing and
+// the indicator lookups from balances; missing balances return 404.
+func mockChartLookups(mockClient *MockClient, identities []interface{}, ledgers map[string]map[string]interface{}, balances map[string]*blnkgo.LedgerBalance) {
+	mockClient.On("NewRequest", "identities/filter", http.MethodPost, mock.Anything).Return(chartRequest("identities/filter"), nil)
+	mockClient.On("CallWithRetry", onChartPath("identities/filter"), mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.FilterResponse).Data = identities
+	})
+
+	var ledgerName string
+	mockClient.On("NewRequest", "ledgers/filter", http.MethodPost, mock.Anything).Return(chartRequest("ledgers/filter"), nil).Run(func(args mock.Arguments) {
+		ledgerName = args.Get(2).(blnkgo.FilterParams).Filters[0].Value.(string)
+	})
+	mockClient.On("CallWithRetry", onChartPath("ledgers/filter"), mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		data := []interface{}{}
+		if l, ok := ledgers[ledgerName]; ok {
+			data = append(data, l)
+		}
+		args.Get(1).(*blnkgo.FilterResponse).Data = data
+	})
+
+	for _, indicator := range []string{"@fees", "@float", "@customer-1"} {
+		path := "balances/indicator/" + indicator + "/currency/USD"
+		mockClient.On("NewRequest", path, http.MethodGet, nil).Return(chartRequest(path), nil)
+		existing, ok := balances[indicator]
+		if !ok {
+			mockClient.On("CallWithRetry", onChartPath(path), mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusNotFound}, notFound())
+			continue
+		}
+		mockClient.On("CallWithRetry", onChartPath(path), mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+			*args.Get(1).(*blnkgo.LedgerBalance) = *existing
+		})
+	}
+}
+
+func TestParseChartOfAccounts(t *testing.T) {
+	chart, err := blnkgo.ParseChartOfAccountsYAML([]byte(chartYAML))
+	require.NoError(t, err)
+	require.Len(t, chart.Ledgers, 2)
+	assert.Equal(t, "Acme Treasury", chart.Identities[0].OrganizationName)
+	assert.Equal(t, "treasury", chart.Ledgers[0].Balances[0].Identity)
+	assert.Equal(t, float64(2), chart.Ledgers[1].Balances[0].MetaData["tier"])
+
+	path := filepath.Join(t.TempDir(), "chart.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"ledgers":[{"name":"Revenue","balances":[{"indicator":"@fees","currency":"USD","identity":"missing"}]}]}`), 0o600))
+	_, err = blnkgo.LoadChartOfAccounts(path)
+	assert.ErrorContains(t, err, "unknown identity")
+
+	_, err = blnkgo.ParseChartOfAccountsJSON([]byte(`{"ledgers":[{"name":"A"},{"name":"A"}]}`))
+	assert.ErrorContains(t, err, "duplicate ledger")
+
+	_, err = blnkgo.ParseChartOfAccountsJSON([]byte(`{"ledgers":[{"name":"A","balances":[{"indicator":"@a","currency":"USD","track_fund_lineage":true}]}]}`))
+	assert.ErrorContains(t, err, "needs an identity")
+
+	_, err = blnkgo.LoadChartOfAccounts("chart.toml")
+	assert.Error(t, err)
+}
+
+func TestChartPlanner_Plan(t *testing.T) {
+	mockClient, planner := setupChartPlanner()
+	mockChartLookups(mockClient,
+		[]interface{}{map[string]interface{}{
+			"identity_id":       "idt_treasury",
+			"identity_type":     "organization",
+			"organization_name": "Acme Holdings",
+			"category":          "internal",
+			"meta_data":         map[string]interface{}{"chart_key": "treasury"},
+		}},
+		map[string]map[string]interface{}{
+			"Revenue": {"ledger_id": "ldg_revenue", "name": "Revenue", "meta_data": map[string]interface{}{"region": "eu", "owner": "finance"}},
+		},
+		map[string]*blnkgo.LedgerBalance{
+			"@fees":  {BalanceID: "bln_fees", LedgerID: "ldg_revenue"},
+			"@float": {BalanceID: "bln_float", LedgerID: "ldg_other"},
+		},
+	)
+	chart, err := blnkgo.ParseChartOfAccountsYAML([]byte(chartYAML))
+	require.NoError(t, err)
+
+	plan, err := planner.Plan(*chart)
+	require.NoError(t, err)
+	require.Len(t, plan.Changes, 6)
+	actions := map[string]blnkgo.ChartAction{}
+	for _, c := range plan.Changes {
+		actions[string(c.Resource)+" "+c.Key] = c.Action
+	}
+	assert.Equal(t, map[string]blnkgo.ChartAction{
+		"identity treasury":       blnkgo.ChartActionUpdate,
+		"ledger Revenue":          blnkgo.ChartActionUpdate,
+		"ledger Customers":        blnkgo.ChartActionCreate,
+		"balance @fees|USD":       blnkgo.ChartActionUpdate,
+		"balance @float|USD":      blnkgo.ChartActionConflict,
+		"balance @customer-1|USD": blnkgo.ChartActionCreate,
+	}, actions)
+	assert.Equal(t, []string{`organization_name: "Acme Holdings" -> "Acme Treasury"`}, plan.Changes[0].Diff)
+	assert.Equal(t, []string{`meta_data.region: "eu" -> "us"`}, plan.Changes[1].Diff)
+	assert.True(t, plan.HasChanges())
+	require.Len(t, plan.Conflicts(), 1)
+
+	var out bytes.Buffer
+	require.NoError(t, plan.WriteText(&out))
+	assert.Contains(t, out.String(), "~ ledger Revenue (ldg_revenue)\n    meta_data.region: \"eu\" -> \"us\"\n")
+	assert.Contains(t, out.String(), "! balance @float|USD (bln_float)")
+
+	_, err = planner.Apply(*chart)
+	assert.True(t, errors.Is(err, blnkgo.ErrChartConflict))
+	mockClient.AssertNotCalled(t, "NewRequest", "ledgers", http.MethodPost, mock.Anything)
+	mockClient.AssertNotCalled(t, "NewRequest", "ldg_revenue/metadata", http.MethodPost, mock.Anything)
+}
+
+func TestChartPlanner_Apply(t *testing.T) {
+	mockClient, planner := setupChartPlanner()
+	mockChartLookups(mockClient, nil, nil, nil)
+
+	var identity blnkgo.Identity
+	mockClient.On("NewRequest", "identities", http.MethodPost, mock.Anything).Return(chartRequest("identities"), nil).Run(func(args mock.Arguments) {
+		identity = args.Get(2).(blnkgo.Identity)
+	})
+	mockClient.On("CallWithRetry", onChartPath("identities"), mock.AnythingOfType("*blnkgo.IdentityResponse")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.IdentityResponse).IdentityId = "idt_treasury"
+	})
+
+	var ledgerName string
+	mockClient.On("NewRequest", "ledgers", http.MethodPost, mock.Anything).Return(chartRequest("ledgers"), nil).Run(func(args mock.Arguments) {
+		ledgerName = args.Get(2).(blnkgo.CreateLedgerRequest).Name
+	})
+	mockClient.On("CallWithRetry", onChartPath("ledgers"), mock.AnythingOfType("*blnkgo.Ledger")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.Ledger).LedgerID = "ldg_" + ledgerName
+	})
+
+	var created []blnkgo.CreateLedgerBalanceRequest
+	mockClient.On("NewRequest", "balances", http.MethodPost, mock.Anything).Return(chartRequest("balances"), nil).Run(func(args mock.Arguments) {
+		created = append(created, args.Get(2).(blnkgo.CreateLedgerBalanceRequest))
+	})
+	mockClient.On("CallWithRetry", onChartPath("balances"), mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.LedgerBalance).BalanceID = "bln_" + created[len(created)-1].Indicator
+	})
+
+	chart, err := blnkgo.ParseChartOfAccountsYAML([]byte(chartYAML))
+	require.NoError(t, err)
+	plan, err := planner.Apply(*chart)
+	require.NoError(t, err)
+
+	assert.Equal(t, "treasury", identity.MetaData[blnkgo.ChartKeyMetaKey])
+	require.Len(t, created, 3)
+	assert.Equal(t, blnkgo.CreateLedgerBalanceRequest{LedgerID: "ldg_Revenue", IdentityID: "idt_treasury", Indicator: "@fees", Currency: "USD"}, created[0])
+	assert.Equal(t, "ldg_Revenue", created[1].LedgerID)
+	assert.Empty(t, created[1].IdentityID)
+	assert.Equal(t, "ldg_Customers", created[2].LedgerID)
+	assert.Equal(t, "idt_treasury", created[2].IdentityID)
+	assert.True(t, created[2].TrackFundLineage)
+	assert.Equal(t, blnkgo.AllocationStrategyFIFO, created[2].AllocationStrategy)
+
+	ids := []string{}
+	for _, c := range plan.Changes {
+		ids = append(ids, c.ID)
+	}
+	assert.Equal(t, []string{"idt_treasury", "ldg_Revenue", "ldg_Customers", "bln_@fees", "bln_@float", "bln_@customer-1"}, ids)
+}
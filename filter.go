@@ -3,6 +3,7 @@ package blnkgo
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 )
 
 type Operator string
@@ -61,3 +62,85 @@ func (f *FilterResponse) UnmarshalJSON(data []byte) error {
 	f.TotalCount = nil
 	return nil
 }
+
+// DecodeData decodes Data into v, typically a pointer to a slice of Transaction,
+// LedgerBalance or Ledger.
+func (f *FilterResponse) DecodeData(v interface{}) error {
+	if f == nil || f.Data == nil {
+		return nil
+	}
+	data, err := json.Marshal(f.Data)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode FilterResponse data: %w", err)
+	}
+	return nil
+}
+
+const defaultFilterPageSize = 100
+
+// filterAll pages through a Filter endpoint with Limit/Offset until a short
+// page is returned and decodes every row into T.
+func filterAll[T any](filter func(FilterParams) (*FilterResponse, *http.Response, error), params FilterParams) ([]T, error) {
+	if params.Limit <= 0 {
+		params.Limit = defaultFilterPageSize
+	}
+
+	var all []T
+	for {
+		response, _, err := filter(params)
+		if err != nil {
+			return nil, err
+		}
+		var page []T
+		if err := response.DecodeData(&page); err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if len(page) < params.Limit {
+			return all, nil
+		}
+		params.Offset += params.Limit
+	}
+}
+
+// selectBalances returns the balances listed in ids (one "in" filter) followed
+// by those matching scope, without duplicates. keep, when set, is applied to the
+// scope matches only. A nil scope selects nothing beyond ids.
+func (s *LedgerBalanceService) selectBalances(ids []string, scope []Filter, keep func(LedgerBalance) bool) ([]LedgerBalance, error) {
+	seen := map[string]struct{}{}
+	var balances []LedgerBalance
+	add := func(found []LedgerBalance, keep func(LedgerBalance) bool) {
+		for _, b := range found {
+			if _, dup := seen[b.BalanceID]; dup || b.BalanceID == "" || (keep != nil && !keep(b)) {
+				continue
+			}
+			seen[b.BalanceID] = struct{}{}
+			balances = append(balances, b)
+		}
+	}
+
+	if len(ids) > 0 {
+		values := make([]interface{}, len(ids))
+		for i, id := range ids {
+			values[i] = id
+		}
+		found, err := filterAll[LedgerBalance](s.Filter, FilterParams{
+			Filters: []Filter{{Field: "balance_id", Operator: OpIn, Values: values}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		add(found, nil)
+	}
+	if scope != nil {
+		found, err := filterAll[LedgerBalance](s.Filter, FilterParams{Filters: scope, SortBy: "created_at", SortOrder: "asc"})
+		if err != nil {
+			return nil, err
+		}
+		add(found, keep)
+	}
+	return balances, nil
+}
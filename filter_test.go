@@ -236,3 +236,17 @@ func TestFilterResponse_UnmarshalJSON_InvalidJSON(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to decode FilterResponse")
 }
+
+func TestFilterResponse_DecodeData(t *testing.T) {
+	response := blnkgo.FilterResponse{
+		Data: []interface{}{
+			map[string]interface{}{"balance_id": "bln_1", "balance": float64(1500), "currency": "USD"},
+		},
+	}
+
+	var balances []blnkgo.LedgerBalance
+	assert.NoError(t, response.DecodeData(&balances))
+	assert.Len(t, balances, 1)
+	assert.Equal(t, "bln_1", balances[0].BalanceID)
+	assert.Equal(t, "1500", balances[0].Balance.String())
+}
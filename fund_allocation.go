@@ -0,0 +1,224 @@
+package blnkgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// FundAllocationEntry is one typed entry of TransactionLineage.FundAllocation:
+// the funds a debit drew from one provider, in minor units.
+type FundAllocationEntry struct {
+	Provider        string   `json:"provider"`
+	Amount          *big.Int `json:"amount"`
+	BalanceID       string   `json:"balance_id,omitempty"`
+	ShadowBalanceID string   `json:"shadow_balance_id,omitempty"`
+}
+
+func (e *FundAllocationEntry) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Provider        string          `json:"provider"`
+		Amount          json.RawMessage `json:"amount"`
+		BalanceID       string          `json:"balance_id"`
+		ShadowBalanceID string          `json:"shadow_balance_id"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	amount, err := unmarshalBigIntJSON(raw.Amount)
+	if err != nil {
+		return err
+	}
+	e.Provider = raw.Provider
+	e.Amount = amount
+	e.BalanceID = raw.BalanceID
+	e.ShadowBalanceID = raw.ShadowBalanceID
+	return nil
+}
+
+// Allocations decodes FundAllocation into typed entries. Amounts may be JSON
+// numbers or strings.
+func (t *TransactionLineage) Allocations() ([]FundAllocationEntry, error) {
+	if t == nil || len(t.FundAllocation) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(t.FundAllocation)
+	if err != nil {
+		return nil, err
+	}
+	var entries []FundAllocationEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid fund allocation on transaction %s: %w", t.TransactionID, err)
+	}
+	return entries, nil
+}
+
+// FundAllocationShare is what a simulated debit takes from one provider.
+// Remaining is the provider's available funds afterwards.
+type FundAllocationShare struct {
+	Provider        string   `json:"provider"`
+	ShadowBalanceID string   `json:"shadow_balance_id,omitempty"`
+	Amount          *big.Int `json:"amount"`
+	Remaining       *big.Int `json:"remaining"`
+}
+
+// FundAllocationSimulation predicts how a debit is split across providers.
+// Unallocated is the part of the debit not covered by lineage funds.
+type FundAllocationSimulation struct {
+	Strategy    AllocationStrategy    `json:"strategy"`
+	Amount      *big.Int              `json:"amount"`
+	Allocations []FundAllocationShare `json:"allocations"`
+	Unallocated *big.Int              `json:"unallocated"`
+}
+
+// SimulateFundAllocation predicts the per-provider allocation of a debit of
+// amount from a balance with the given lineage. Providers are taken to be in
+// the order their funds were received, as returned by GetLineage: FIFO draws
+// from the first provider first, LIFO from the last, and PROPORTIONAL splits by
+// available funds, giving rounding remainders to the largest fractions. An
+// empty strategy is treated as FIFO.
+func SimulateFundAllocation(lineage *BalanceLineage, amount *big.Int, strategy AllocationStrategy) (*FundAllocationSimulation, error) {
+	if lineage == nil {
+		return nil, errors.New("validation error: balance lineage is required")
+	}
+	if amount == nil || amount.Sign() <= 0 {
+		return nil, errors.New("validation error: debit amount must be positive")
+	}
+	strategy = normalizeAllocationStrategy(strategy)
+	if strategy == "" {
+		strategy = AllocationStrategyFIFO
+	}
+	if !isValidAllocationStrategy(strategy) {
+		return nil, fmt.Errorf("validation error: invalid allocation strategy: %s", strategy)
+	}
+
+	sim := &FundAllocationSimulation{Strategy: strategy, Amount: new(big.Int).Set(amount)}
+	available := make([]*big.Int, len(lineage.Providers))
+	total := big.NewInt(0)
+	for i, p := range lineage.Providers {
+		available[i] = cloneBigInt(p.Available)
+		if available[i].Sign() < 0 {
+			available[i].SetInt64(0)
+		}
+		total.Add(total, available[i])
+	}
+
+	taken := make([]*big.Int, len(available))
+	for i := range taken {
+		taken[i] = big.NewInt(0)
+	}
+	switch strategy {
+	case AllocationStrategyFIFO, AllocationStrategyLIFO:
+		left := new(big.Int).Set(amount)
+		for n := range available {
+			i := n
+			if strategy == AllocationStrategyLIFO {
+				i = len(available) - 1 - n
+			}
+			taken[i] = minBigInt(left, available[i])
+			left.Sub(left, taken[i])
+		}
+	case AllocationStrategyPROPORTIONAL:
+		proportionalShares(amount, available, total, taken)
+	}
+
+	allocated := big.NewInt(0)
+	for i, p := range lineage.Providers {
+		if taken[i].Sign() == 0 {
+			continue
+		}
+		allocated.Add(allocated, taken[i])
+		sim.Allocations = append(sim.Allocations, FundAllocationShare{
+			Provider:        p.Provider,
+			ShadowBalanceID: p.ShadowBalanceID,
+			Amount:          taken[i],
+			Remaining:       new(big.Int).Sub(available[i], taken[i]),
+		})
+	}
+	sim.Unallocated = new(big.Int).Sub(amount, allocated)
+	return sim, nil
+}
+
+// proportionalShares splits min(amount, total) across available by weight,
+// rounding down and handing the remainder out by largest fraction.
+func proportionalShares(amount *big.Int, available []*big.Int, total *big.Int, taken []*big.Int) {
+	if total.Sign() == 0 {
+		return
+	}
+	target := minBigInt(amount, total)
+	remainders := make([]*big.Int, len(available))
+	left := new(big.Int).Set(target)
+	for i, a := range available {
+		share, rem := new(big.Int).QuoRem(new(big.Int).Mul(target, a), total, new(big.Int))
+		taken[i] = share
+		remainders[i] = rem
+		left.Sub(left, share)
+	}
+	order := make([]int, len(available))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]].Cmp(remainders[order[b]]) > 0 })
+	for _, i := range order {
+		if left.Sign() == 0 {
+			break
+		}
+		if taken[i].Cmp(available[i]) < 0 {
+			taken[i].Add(taken[i], big.NewInt(1))
+			left.Sub(left, big.NewInt(1))
+		}
+	}
+}
+
+// SimulateFundAllocations runs SimulateFundAllocation for every strategy.
+func SimulateFundAllocations(lineage *BalanceLineage, amount *big.Int) (map[AllocationStrategy]*FundAllocationSimulation, error) {
+	out := make(map[AllocationStrategy]*FundAllocationSimulation, 3)
+	for _, strategy := range []AllocationStrategy{AllocationStrategyFIFO, AllocationStrategyLIFO, AllocationStrategyPROPORTIONAL} {
+		sim, err := SimulateFundAllocation(lineage, amount, strategy)
+		if err != nil {
+			return nil, err
+		}
+		out[strategy] = sim
+	}
+	return out, nil
+}
+
+// FundAllocationDifference is a provider whose predicted and actual
+// allocations differ.
+type FundAllocationDifference struct {
+	Provider  string   `json:"provider"`
+	Predicted *big.Int `json:"predicted"`
+	Actual    *big.Int `json:"actual"`
+}
+
+// Compare lists the providers whose predicted allocation differs from the
+// actual lineage of the posted transaction. An empty result means the
+// prediction matched.
+func (s *FundAllocationSimulation) Compare(actual []FundAllocationEntry) []FundAllocationDifference {
+	predicted := map[string]*big.Int{}
+	for _, a := range s.Allocations {
+		predicted[a.Provider] = new(big.Int).Add(cloneBigInt(predicted[a.Provider]), a.Amount)
+	}
+	got := map[string]*big.Int{}
+	for _, e := range actual {
+		got[e.Provider] = new(big.Int).Add(cloneBigInt(got[e.Provider]), cloneBigInt(e.Amount))
+	}
+	providers := map[string]struct{}{}
+	for p := range predicted {
+		providers[p] = struct{}{}
+	}
+	for p := range got {
+		providers[p] = struct{}{}
+	}
+
+	var diffs []FundAllocationDifference
+	for _, p := range sortedKeys(providers) {
+		want, have := cloneBigInt(predicted[p]), cloneBigInt(got[p])
+		if want.Cmp(have) != 0 {
+			diffs = append(diffs, FundAllocationDifference{Provider: p, Predicted: want, Actual: have})
+		}
+	}
+	return diffs
+}
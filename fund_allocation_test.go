@@ -0,0 +1,79 @@
+package blnkgo_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func allocationLineage() *blnkgo.BalanceLineage {
+	return &blnkgo.BalanceLineage{
+		BalanceID: "bln_wallet",
+		Providers: []blnkgo.LineageProviderBreakdown{
+			{Provider: "stripe", Available: big.NewInt(5000), ShadowBalanceID: "bln_shadow_stripe"},
+			{Provider: "paystack", Available: big.NewInt(3000)},
+			{Provider: "bank", Available: big.NewInt(2000)},
+		},
+	}
+}
+
+func shares(sim *blnkgo.FundAllocationSimulation) map[string]string {
+	out := map[string]string{}
+	for _, a := range sim.Allocations {
+		out[a.Provider] = a.Amount.String()
+	}
+	return out
+}
+
+func TestSimulateFundAllocation(t *testing.T) {
+	sims, err := blnkgo.SimulateFundAllocations(allocationLineage(), big.NewInt(6001))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"stripe": "5000", "paystack": "1001"}, shares(sims[blnkgo.AllocationStrategyFIFO]))
+	assert.Equal(t, map[string]string{"bank": "2000", "paystack": "3000", "stripe": "1001"}, shares(sims[blnkgo.AllocationStrategyLIFO]))
+	// 3000.5, 1800.3, 1200.2 rounded down, remainder to stripe.
+	assert.Equal(t, map[string]string{"stripe": "3001", "paystack": "1800", "bank": "1200"}, shares(sims[blnkgo.AllocationStrategyPROPORTIONAL]))
+	assert.Equal(t, "1999", sims[blnkgo.AllocationStrategyPROPORTIONAL].Allocations[0].Remaining.String())
+	assert.Equal(t, "bln_shadow_stripe", sims[blnkgo.AllocationStrategyFIFO].Allocations[0].ShadowBalanceID)
+
+	over, err := blnkgo.SimulateFundAllocation(allocationLineage(), big.NewInt(12000), "proportional")
+	require.NoError(t, err)
+	assert.Equal(t, "2000", over.Unallocated.String())
+	assert.Equal(t, map[string]string{"stripe": "5000", "paystack": "3000", "bank": "2000"}, shares(over))
+
+	_, err = blnkgo.SimulateFundAllocation(allocationLineage(), big.NewInt(100), "RANDOM")
+	assert.Error(t, err)
+}
+
+func TestTransactionLineage_Allocations(t *testing.T) {
+	var lineage blnkgo.TransactionLineage
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"transaction_id": "txn_1",
+		"fund_allocation": [{"provider": "stripe", "amount": "5000"}, {"provider": "paystack", "amount": 1001, "shadow_balance_id": "bln_shadow_paystack"}]
+	}`), &lineage))
+
+	entries, err := lineage.Allocations()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "5000", entries[0].Amount.String())
+	assert.Equal(t, "bln_shadow_paystack", entries[1].ShadowBalanceID)
+
+	fifo, err := blnkgo.SimulateFundAllocation(allocationLineage(), big.NewInt(6001), blnkgo.AllocationStrategyFIFO)
+	require.NoError(t, err)
+	assert.Empty(t, fifo.Compare(entries))
+
+	lifo, err := blnkgo.SimulateFundAllocation(allocationLineage(), big.NewInt(6001), blnkgo.AllocationStrategyLIFO)
+	require.NoError(t, err)
+	diffs := lifo.Compare(entries)
+	require.Len(t, diffs, 3)
+	assert.Equal(t, "bank", diffs[0].Provider)
+	assert.Equal(t, "0", diffs[0].Actual.String())
+
+	bad := blnkgo.TransactionLineage{FundAllocation: []map[string]interface{}{{"provider": "x", "amount": "1.5"}}}
+	_, err = bad.Allocations()
+	assert.Error(t, err)
+}
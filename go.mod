@@ -5,11 +5,11 @@ go 1.25.3
 require (
 	github.com/google/go-querystring v1.1.0
 	github.com/stretchr/testify v1.11.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/objx v0.5.3 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,320 @@
+package blnkgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// InflightSweepPolicy selects inflight transactions older than MaxAge (and
+// matching Filters and Match, when set) and resolves them with Action.
+type InflightSweepPolicy struct {
+	Name   string
+	MaxAge time.Duration
+	// Filters are added to the status/created_at filters sent to Core, e.g.
+	// {Field: "meta_data.channel", Operator: OpEqual, Value: "card"}.
+	Filters []Filter
+	// Match is an optional client-side predicate applied after filtering.
+	Match  func(Transaction) bool
+	Action InflightStatus
+}
+
+// InflightSweeperOptions configures an InflightSweeper.
+type InflightSweeperOptions struct {
+	Policies []InflightSweepPolicy
+	// BatchSize is the number of transactions per bulk commit/void call, capped
+	// at MaxBulkInflightItems. Zero uses MaxBulkInflightItems.
+	BatchSize int
+	// DryRun reports what would be done without calling bulk commit/void.
+	DryRun bool
+	Logger Logger
+}
+
+// InflightSweepOutcome is the result of one action in a sweep.
+type InflightSweepOutcome string
+
+const (
+	InflightSweepPlanned   InflightSweepOutcome = "planned"
+	InflightSweepSucceeded InflightSweepOutcome = "succeeded"
+	InflightSweepFailed    InflightSweepOutcome = "failed"
+)
+
+// InflightSweepAction reports what the sweeper did (or would do) to one
+// transaction.
+type InflightSweepAction struct {
+	Policy        string               `json:"policy"`
+	TransactionID string               `json:"transaction_id"`
+	Reference     string               `json:"reference"`
+	CreatedAt     time.Time            `json:"created_at"`
+	Action        InflightStatus       `json:"action"`
+	Outcome       InflightSweepOutcome `json:"outcome"`
+	Code          string               `json:"code,omitempty"`
+	Message       string               `json:"message,omitempty"`
+}
+
+// InflightSweepReport summarises one sweep.
+type InflightSweepReport struct {
+	SweptAt   time.Time             `json:"swept_at"`
+	DryRun    bool                  `json:"dry_run"`
+	Actions   []InflightSweepAction `json:"actions"`
+	Succeeded int                   `json:"succeeded"`
+	Failed    int                   `json:"failed"`
+}
+
+// InflightSweeper finds inflight holds that have outlived a business policy and
+// voids or commits them in batches.
+type InflightSweeper struct {
+	transactions *TransactionService
+	options      InflightSweeperOptions
+}
+
+func NewInflightSweeper(transactions *TransactionService, options InflightSweeperOptions) (*InflightSweeper, error) {
+	if err := ValidateInflightSweeperOptions(options); err != nil {
+		return nil, err
+	}
+	if options.BatchSize <= 0 || options.BatchSize > MaxBulkInflightItems {
+		options.BatchSize = MaxBulkInflightItems
+	}
+	if options.Logger == nil {
+		options.Logger = NewDefaultLogger()
+	}
+	return &InflightSweeper{transactions: transactions, options: options}, nil
+}
+
+// ValidateInflightSweeperOptions checks every policy has an age and a valid action.
+func ValidateInflightSweeperOptions(options InflightSweeperOptions) error {
+	if len(options.Policies) == 0 {
+		return errors.New("validation error: at least one sweep policy is required")
+	}
+	for i, p := range options.Policies {
+		if p.MaxAge <= 0 {
+			return fmt.Errorf("validation error: policy at index %d must have a positive max age", i)
+		}
+		if p.Action != InflightStatusCommit && p.Action != InflightStatusVoid {
+			return fmt.Errorf("validation error: policy at index %d action must be commit or void", i)
+		}
+	}
+	return nil
+}
+
+// Sweep evaluates every policy against now and applies the resulting actions.
+// A transaction selected by several policies is handled by the first one, and
+// holds already resolved by a commit or void are skipped.
+func (s *InflightSweeper) Sweep(now time.Time) (*InflightSweepReport, error) {
+	report := &InflightSweepReport{SweptAt: now, DryRun: s.options.DryRun}
+	seen := make(map[string]struct{})
+	batches := map[InflightStatus][]int{}
+	type candidate struct {
+		policy InflightSweepPolicy
+		txn    Transaction
+	}
+	var picked []candidate
+	var holds []Transaction
+
+	for _, policy := range s.options.Policies {
+		params := FilterParams{
+			Filters: append([]Filter{
+				{Field: "status", Operator: OpEqual, Value: string(PryTransactionStatusInFlight)},
+				{Field: "created_at", Operator: OpLessThan, Value: now.Add(-policy.MaxAge).UTC().Format(time.RFC3339)},
+			}, policy.Filters...),
+			SortBy:    "created_at",
+			SortOrder: "asc",
+		}
+		candidates, err := filterAll[Transaction](s.transactions.Filter, params)
+		if err != nil {
+			return report, err
+		}
+
+		for _, txn := range candidates {
+			if _, done := seen[txn.TransactionID]; done || txn.TransactionID == "" {
+				continue
+			}
+			if policy.Match != nil && !policy.Match(txn) {
+				continue
+			}
+			seen[txn.TransactionID] = struct{}{}
+			picked = append(picked, candidate{policy: policy, txn: txn})
+			holds = append(holds, txn)
+		}
+	}
+
+	resolved, err := s.resolvedHolds(holds)
+	if err != nil {
+		return report, err
+	}
+	for _, c := range picked {
+		if resolved[c.txn.TransactionID] {
+			continue
+		}
+		batches[c.policy.Action] = append(batches[c.policy.Action], len(report.Actions))
+		report.Actions = append(report.Actions, InflightSweepAction{
+			Policy:        c.policy.Name,
+			TransactionID: c.txn.TransactionID,
+			Reference:     c.txn.Reference,
+			CreatedAt:     c.txn.CreatedAt,
+			Action:        c.policy.Action,
+			Outcome:       InflightSweepPlanned,
+		})
+	}
+
+	if s.options.DryRun {
+		return report, nil
+	}
+
+	for _, action := range []InflightStatus{InflightStatusVoid, InflightStatusCommit} {
+		indexes := batches[action]
+		for start := 0; start < len(indexes); start += s.options.BatchSize {
+			end := start + s.options.BatchSize
+			if end > len(indexes) {
+				end = len(indexes)
+			}
+			s.applyBatch(report, action, indexes[start:end])
+		}
+	}
+
+	for _, a := range report.Actions {
+		switch a.Outcome {
+		case InflightSweepSucceeded:
+			report.Succeeded++
+		case InflightSweepFailed:
+			report.Failed++
+		}
+	}
+	return report, nil
+}
+
+// resolvedHolds returns the holds that already have a VOID child, or
+// APPLIED/COMMIT children covering the held amount. Core keeps the original row
+// INFLIGHT after a commit or void, so the status filter alone still selects
+// them.
+func (s *InflightSweeper) resolvedHolds(holds []Transaction) (map[string]bool, error) {
+	resolved := make(map[string]bool)
+	committed := make(map[string]*big.Int)
+	for start := 0; start < len(holds); start += defaultFilterPageSize {
+		end := min(start+defaultFilterPageSize, len(holds))
+		ids := make([]interface{}, 0, end-start)
+		for _, h := range holds[start:end] {
+			ids = append(ids, h.TransactionID)
+		}
+		children, err := filterAll[Transaction](s.transactions.Filter, FilterParams{
+			Filters: []Filter{{Field: "parent_transaction", Operator: OpIn, Values: ids}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range children {
+			if c.ParentTransactionID == "" {
+				continue
+			}
+			switch c.Status {
+			case PryTransactionStatusVoid:
+				resolved[c.ParentTransactionID] = true
+			case PryTransactionStatusApplied, PryTransactionStatusCommit:
+				amount, err := transactionPreciseAmount(c.ParentTransaction)
+				if err != nil {
+					resolved[c.ParentTransactionID] = true
+					continue
+				}
+				committed[c.ParentTransactionID] = new(big.Int).Add(cloneBigInt(committed[c.ParentTransactionID]), amount)
+			}
+		}
+	}
+	for _, h := range holds {
+		sum, ok := committed[h.TransactionID]
+		if !ok {
+			continue
+		}
+		if held, err := transactionPreciseAmount(h.ParentTransaction); err != nil || sum.Cmp(held) >= 0 {
+			resolved[h.TransactionID] = true
+		}
+	}
+	return resolved, nil
+}
+
+func (s *InflightSweeper) applyBatch(report *InflightSweepReport, action InflightStatus, indexes []int) {
+	byID := make(map[string]int, len(indexes))
+	var results []BulkVoidInflightResult
+	var err error
+
+	if action == InflightStatusVoid {
+		body := BulkVoidInflightRequest{}
+		for _, i := range indexes {
+			body.TransactionIDs = append(body.TransactionIDs, report.Actions[i].TransactionID)
+			byID[report.Actions[i].TransactionID] = i
+		}
+		var response *BulkVoidInflightResponse
+		response, _, err = s.transactions.BulkVoidInflight(body)
+		if response != nil {
+			results = response.Results
+		}
+	} else {
+		body := BulkCommitInflightRequest{}
+		for _, i := range indexes {
+			body.Transactions = append(body.Transactions, BulkCommitInflightItem{TransactionID: report.Actions[i].TransactionID})
+			byID[report.Actions[i].TransactionID] = i
+		}
+		var response *BulkCommitInflightResponse
+		response, _, err = s.transactions.BulkCommitInflight(body)
+		if response != nil {
+			for _, r := range response.Results {
+				results = append(results, BulkVoidInflightResult(r))
+			}
+		}
+	}
+
+	if err != nil {
+		s.options.Logger.Error(fmt.Sprintf("inflight sweeper: bulk %s failed: %v", action, err))
+		for _, i := range indexes {
+			report.Actions[i].Outcome = InflightSweepFailed
+			report.Actions[i].Message = err.Error()
+		}
+		return
+	}
+
+	for _, r := range results {
+		i, ok := byID[r.TransactionID]
+		if !ok {
+			continue
+		}
+		report.Actions[i].Code = r.Code
+		report.Actions[i].Message = r.Message
+		if r.Status == "succeeded" {
+			report.Actions[i].Outcome = InflightSweepSucceeded
+		} else {
+			report.Actions[i].Outcome = InflightSweepFailed
+		}
+		delete(byID, r.TransactionID)
+	}
+	for _, i := range byID {
+		report.Actions[i].Outcome = InflightSweepFailed
+		report.Actions[i].Message = "no result returned for transaction"
+	}
+}
+
+// Run sweeps every interval until ctx is cancelled, passing each report to
+// onReport when it is non-nil.
+func (s *InflightSweeper) Run(ctx context.Context, interval time.Duration, onReport func(*InflightSweepReport, error)) error {
+	if interval <= 0 {
+		return errors.New("validation error: sweep interval must be positive")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := s.Sweep(time.Now())
+		if err != nil {
+			s.options.Logger.Error(fmt.Sprintf("inflight sweeper: %v", err))
+		}
+		if onReport != nil {
+			onReport(report, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package blnkgo_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func mockInflightFilter(mockClient *MockClient, rows []interface{}) {
+	mockClient.On("NewRequest", "transactions/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.FilterResponse).Data = rows
+	})
+}
+
+func inflightRow(id, reference, channel string) map[string]interface{} {
+	return map[string]interface{}{
+		"transaction_id": id,
+		"reference":      reference,
+		"status":         "INFLIGHT",
+		"created_at":     "2026-01-01T00:00:00Z",
+		"meta_data":      map[string]interface{}{"channel": channel},
+	}
+}
+
+func TestInflightSweeper_DryRun(t *testing.T) {
+	mockClient := &MockClient{}
+	mockInflightFilter(mockClient, []interface{}{
+		inflightRow("txn_1", "ref_1", "card"),
+		inflightRow("txn_2", "ref_2", "bank"),
+	})
+
+	sweeper, err := blnkgo.NewInflightSweeper(blnkgo.NewTransactionService(mockClient), blnkgo.InflightSweeperOptions{
+		DryRun: true,
+		Policies: []blnkgo.InflightSweepPolicy{{
+			Name:   "card-holds",
+			MaxAge: 7 * 24 * time.Hour,
+			Action: blnkgo.InflightStatusVoid,
+			Match: func(txn blnkgo.Transaction) bool {
+				return txn.MetaData["channel"] == "card"
+			},
+		}},
+	})
+	require.NoError(t, err)
+
+	now := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	report, err := sweeper.Sweep(now)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	require.Len(t, report.Actions, 1)
+	assert.Equal(t, "txn_1", report.Actions[0].TransactionID)
+	assert.Equal(t, blnkgo.InflightSweepPlanned, report.Actions[0].Outcome)
+
+	mockClient.AssertNotCalled(t, "NewRequest", "transactions/inflight/bulk/void", http.MethodPost, mock.Anything)
+	params := mockClient.Calls[0].Arguments.Get(2).(blnkgo.FilterParams)
+	assert.Equal(t, "INFLIGHT", params.Filters[0].Value)
+	assert.Equal(t, "2026-01-25T00:00:00Z", params.Filters[1].Value)
+}
+
+func TestInflightSweeper_VoidsAndCommitsInBatches(t *testing.T) {
+	mockClient := &MockClient{}
+	mockInflightFilter(mockClient, []interface{}{
+		inflightRow("txn_1", "ref_1", "card"),
+		inflightRow("txn_2", "ref_2", "card"),
+		inflightRow("txn_3", "ref_3", "card"),
+	})
+
+	var voidBatches [][]string
+	mockClient.On("NewRequest", "transactions/inflight/bulk/void", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		voidBatches = append(voidBatches, args.Get(2).(blnkgo.BulkVoidInflightRequest).TransactionIDs)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.BulkVoidInflightResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		response := args.Get(1).(*blnkgo.BulkVoidInflightResponse)
+		batch := voidBatches[len(voidBatches)-1]
+		response.Results = nil
+		for _, id := range batch {
+			status := "succeeded"
+			if id == "txn_2" {
+				status = "failed"
+			}
+			response.Results = append(response.Results, blnkgo.BulkVoidInflightResult{TransactionID: id, Status: status})
+		}
+	})
+
+	sweeper, err := blnkgo.NewInflightSweeper(blnkgo.NewTransactionService(mockClient), blnkgo.InflightSweeperOptions{
+		BatchSize: 2,
+		Logger:    silentLogger{},
+		Policies: []blnkgo.InflightSweepPolicy{
+			{Name: "stale", MaxAge: time.Hour, Action: blnkgo.InflightStatusVoid},
+			{Name: "never-reached", MaxAge: time.Hour, Action: blnkgo.InflightStatusCommit},
+		},
+	})
+	require.NoError(t, err)
+
+	report, err := sweeper.Sweep(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"txn_1", "txn_2"}, {"txn_3"}}, voidBatches)
+	assert.Equal(t, 2, report.Succeeded)
+	assert.Equal(t, 1, report.Failed)
+	mockClient.AssertNotCalled(t, "NewRequest", "transactions/inflight/bulk/commit", http.MethodPost, mock.Anything)
+}
+
+func TestInflightSweeper_CommitErrorMarksBatchFailed(t *testing.T) {
+	mockClient := &MockClient{}
+	mockInflightFilter(mockClient, []interface{}{inflightRow("txn_1", "ref_1", "card")})
+	mockClient.On("NewRequest", "transactions/inflight/bulk/commit", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.BulkCommitInflightResponse")).Return((*http.Response)(nil), errors.New("boom"))
+
+	sweeper, err := blnkgo.NewInflightSweeper(blnkgo.NewTransactionService(mockClient), blnkgo.InflightSweeperOptions{
+		Logger:   silentLogger{},
+		Policies: []blnkgo.InflightSweepPolicy{{Name: "auto-capture", MaxAge: time.Hour, Action: blnkgo.InflightStatusCommit}},
+	})
+	require.NoError(t, err)
+
+	report, err := sweeper.Sweep(time.Now())
+	require.NoError(t, err)
+	require.Len(t, report.Actions, 1)
+	assert.Equal(t, blnkgo.InflightSweepFailed, report.Actions[0].Outcome)
+	assert.Equal(t, "boom", report.Actions[0].Message)
+}
+
+func TestInflightSweeper_SkipsResolvedHolds(t *testing.T) {
+	mockClient := &MockClient{}
+	var field string
+	mockClient.On("NewRequest", "transactions/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		field = args.Get(2).(blnkgo.FilterParams).Filters[0].Field
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		hold := func(id string) map[string]interface{} {
+			row := inflightRow(id, "ref_"+id, "card")
+			row["precise_amount"] = 1000
+			return row
+		}
+		child := func(parent, status string, amount int) map[string]interface{} {
+			return map[string]interface{}{"transaction_id": parent + "_" + status, "parent_transaction": parent, "status": status, "precise_amount": amount}
+		}
+		if field == "status" {
+			args.Get(1).(*blnkgo.FilterResponse).Data = []interface{}{hold("txn_voided"), hold("txn_partial"), hold("txn_committed"), hold("txn_open")}
+			return
+		}
+		args.Get(1).(*blnkgo.FilterResponse).Data = []interface{}{
+			child("txn_voided", "VOID", 1000),
+			child("txn_partial", "APPLIED", 500),
+			child("txn_committed", "APPLIED", 600),
+			child("txn_committed", "APPLIED", 400),
+		}
+	})
+
+	sweeper, err := blnkgo.NewInflightSweeper(blnkgo.NewTransactionService(mockClient), blnkgo.InflightSweeperOptions{
+		DryRun:   true,
+		Logger:   silentLogger{},
+		Policies: []blnkgo.InflightSweepPolicy{{Name: "stale", MaxAge: time.Hour, Action: blnkgo.InflightStatusVoid}},
+	})
+	require.NoError(t, err)
+
+	report, err := sweeper.Sweep(time.Now())
+	require.NoError(t, err)
+	var ids []string
+	for _, a := range report.Actions {
+		ids = append(ids, a.TransactionID)
+	}
+	assert.Equal(t, []string{"txn_partial", "txn_open"}, ids)
+	assert.ErrorContains(t, sweeper.Run(context.Background(), 0, nil), "interval must be positive")
+}
+
+func TestValidateInflightSweeperOptions(t *testing.T) {
+	assert.Error(t, blnkgo.ValidateInflightSweeperOptions(blnkgo.InflightSweeperOptions{}))
+	assert.Error(t, blnkgo.ValidateInflightSweeperOptions(blnkgo.InflightSweeperOptions{
+		Policies: []blnkgo.InflightSweepPolicy{{MaxAge: 0, Action: blnkgo.InflightStatusVoid}},
+	}))
+	assert.Error(t, blnkgo.ValidateInflightSweeperOptions(blnkgo.InflightSweeperOptions{
+		Policies: []blnkgo.InflightSweepPolicy{{MaxAge: time.Hour, Action: "expire"}},
+	}))
+}
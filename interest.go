@@ -0,0 +1,415 @@
+package blnkgo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DayCountConvention determines the year fraction one day of interest covers.
+type DayCountConvention string
+
+const (
+	DayCountACT365 DayCountConvention = "ACT/365"
+	DayCountACT360 DayCountConvention = "ACT/360"
+	// DayCount30360 is the US (NASD) 30/360 convention.
+	DayCount30360 DayCountConvention = "30/360"
+)
+
+// YearFraction returns the exact fraction of a year between from and to.
+func (c DayCountConvention) YearFraction(from, to time.Time) (*big.Rat, error) {
+	switch c {
+	case DayCountACT365, "":
+		return big.NewRat(actualDays(from, to), 365), nil
+	case DayCountACT360:
+		return big.NewRat(actualDays(from, to), 360), nil
+	case DayCount30360:
+		return big.NewRat(days30360(from, to), 360), nil
+	default:
+		return nil, fmt.Errorf("invalid day count convention: %s", c)
+	}
+}
+
+func actualDays(from, to time.Time) int64 {
+	a := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	b := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int64(b.Sub(a).Hours() / 24)
+}
+
+func days30360(from, to time.Time) int64 {
+	d1, d2 := from.Day(), to.Day()
+	if d1 == 31 {
+		d1 = 30
+	}
+	if d2 == 31 && d1 == 30 {
+		d2 = 30
+	}
+	return int64(360*(to.Year()-from.Year()) + 30*(int(to.Month())-int(from.Month())) + (d2 - d1))
+}
+
+// Compounding selects whether accrued, not yet posted interest earns interest.
+type Compounding string
+
+const (
+	// CompoundingNone accrues on the balance only; interest compounds when it
+	// is posted.
+	CompoundingNone Compounding = "none"
+	// CompoundingDaily also accrues on interest accrued earlier in the period
+	// plus the carry brought in, rounded to minor units.
+	CompoundingDaily Compounding = "daily"
+)
+
+// RoundingMode rounds accrued interest to minor units when it is posted.
+type RoundingMode string
+
+const (
+	RoundHalfUp   RoundingMode = "half_up"
+	RoundHalfEven RoundingMode = "half_even"
+	RoundDown     RoundingMode = "down"
+	RoundUp       RoundingMode = "up"
+)
+
+// Round rounds a non-negative r to an integer.
+func (m RoundingMode) Round(r *big.Rat) *big.Int {
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if rem.Sign() == 0 {
+		return q
+	}
+	switch m {
+	case RoundDown:
+		return q
+	case RoundUp:
+		return q.Add(q, big.NewInt(1))
+	case RoundHalfEven:
+		c := new(big.Int).Mul(rem, big.NewInt(2)).Cmp(r.Denom())
+		if c > 0 || (c == 0 && q.Bit(0) == 1) {
+			q.Add(q, big.NewInt(1))
+		}
+		return q
+	default:
+		return roundRat(r)
+	}
+}
+
+// RateTier applies Rate (annual percent) to the part of the balance up to UpTo
+// (minor units) not covered by earlier tiers. A nil UpTo covers the rest.
+type RateTier struct {
+	UpTo *big.Int
+	Rate float64
+}
+
+// InterestPlan describes how interest accrues. Rate is an annual percent (4.5
+// means 4.5%) used when Tiers is empty. Only positive balances earn interest.
+type InterestPlan struct {
+	Rate        float64
+	Tiers       []RateTier
+	DayCount    DayCountConvention
+	Compounding Compounding
+	Rounding    RoundingMode
+	// Location sets day boundaries; nil uses UTC.
+	Location *time.Location
+}
+
+// ValidateInterestPlan checks rates, tiers and conventions.
+func ValidateInterestPlan(p InterestPlan) error {
+	if p.Rate < 0 {
+		return errors.New("validation error: interest rate must be non-negative")
+	}
+	if _, err := p.DayCount.YearFraction(time.Time{}, time.Time{}); err != nil {
+		return fmt.Errorf("validation error: %w", err)
+	}
+	if p.Compounding != "" && p.Compounding != CompoundingNone && p.Compounding != CompoundingDaily {
+		return fmt.Errorf("validation error: invalid compounding: %s", p.Compounding)
+	}
+	switch p.Rounding {
+	case "", RoundHalfUp, RoundHalfEven, RoundDown, RoundUp:
+	default:
+		return fmt.Errorf("validation error: invalid rounding mode: %s", p.Rounding)
+	}
+	for i, tier := range p.Tiers {
+		if tier.Rate < 0 {
+			return fmt.Errorf("validation error: tier %d rate must be non-negative", i)
+		}
+		if tier.UpTo == nil && i != len(p.Tiers)-1 {
+			return errors.New("validation error: only the last rate tier may be unbounded")
+		}
+		if i > 0 && tier.UpTo != nil && tier.UpTo.Cmp(p.Tiers[i-1].UpTo) <= 0 {
+			return errors.New("validation error: rate tiers must be in ascending order")
+		}
+	}
+	return nil
+}
+
+// AnnualInterest returns the exact yearly interest on balance, applying tiers
+// marginally.
+func (p InterestPlan) AnnualInterest(balance *big.Int) (*big.Rat, error) {
+	total := new(big.Rat)
+	if balance == nil || balance.Sign() <= 0 {
+		return total, nil
+	}
+	tiers := p.Tiers
+	if len(tiers) == 0 {
+		tiers = []RateTier{{Rate: p.Rate}}
+	}
+
+	covered := big.NewInt(0)
+	for _, tier := range tiers {
+		portion := new(big.Int).Sub(balance, covered)
+		if tier.UpTo != nil && tier.UpTo.Cmp(balance) < 0 {
+			portion.Sub(tier.UpTo, covered)
+		}
+		if portion.Sign() <= 0 {
+			break
+		}
+		rate, ok := new(big.Rat).SetString(strconv.FormatFloat(tier.Rate, 'f', -1, 64))
+		if !ok {
+			return nil, fmt.Errorf("invalid interest rate: %v", tier.Rate)
+		}
+		part := new(big.Rat).Mul(new(big.Rat).SetInt(portion), rate)
+		total.Add(total, part.Quo(part, big.NewRat(100, 1)))
+		covered.Add(covered, portion)
+		if tier.UpTo == nil || covered.Cmp(balance) >= 0 {
+			break
+		}
+	}
+	return total, nil
+}
+
+// DailyInterest returns the exact interest balance earns on day.
+func (p InterestPlan) DailyInterest(balance *big.Int, day time.Time) (*big.Rat, error) {
+	annual, err := p.AnnualInterest(balance)
+	if err != nil {
+		return nil, err
+	}
+	fraction, err := p.DayCount.YearFraction(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	return annual.Mul(annual, fraction), nil
+}
+
+// InterestDay is one day of accrual.
+type InterestDay struct {
+	Date    time.Time `json:"date"`
+	Balance *big.Int  `json:"balance"`
+	Accrued *big.Rat  `json:"accrued"`
+}
+
+// InterestAccrual is the interest for one balance over [From, To). CarryIn is
+// the unposted fraction brought forward from the previous period, Amount the
+// rounded minor units to post and CarryOut the fraction carried forward.
+type InterestAccrual struct {
+	BalanceID string        `json:"balance_id"`
+	Currency  string        `json:"currency"`
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	Days      []InterestDay `json:"days"`
+	CarryIn   *big.Rat      `json:"carry_in"`
+	Accrued   *big.Rat      `json:"accrued"`
+	Amount    *big.Int      `json:"amount"`
+	CarryOut  *big.Rat      `json:"carry_out"`
+	Reference string        `json:"reference"`
+}
+
+// InterestStore keeps the fractional interest carried between postings. A
+// carry is recorded at the end of the period that produced it, so posting a
+// period again reads the same carry in and overwrites the same carry out.
+type InterestStore interface {
+	// Carry returns the carry recorded at or before at, or zero if none.
+	Carry(balanceID string, at time.Time) (*big.Rat, error)
+	SetCarry(balanceID string, at time.Time, carry *big.Rat) error
+}
+
+// InterestOptions configures an InterestAccruer. Source is the balance interest
+// is paid from, e.g. "@interest_expense".
+type InterestOptions struct {
+	Plan      InterestPlan
+	Source    string
+	Precision int64
+	// FromSource reconstructs historical balances from transactions.
+	FromSource bool
+}
+
+// InterestAccruer accrues interest daily from historical balances and posts it
+// periodically.
+type InterestAccruer struct {
+	transactions *TransactionService
+	balances     *LedgerBalanceService
+	store        InterestStore
+	options      InterestOptions
+}
+
+func NewInterestAccruer(transactions *TransactionService, balances *LedgerBalanceService, store InterestStore, options InterestOptions) (*InterestAccruer, error) {
+	if err := ValidateInterestPlan(options.Plan); err != nil {
+		return nil, err
+	}
+	if options.Source == "" {
+		return nil, errors.New("validation error: interest source balance is required")
+	}
+	if options.Plan.Location == nil {
+		options.Plan.Location = time.UTC
+	}
+	if options.Precision == 0 {
+		options.Precision = 1
+	}
+	return &InterestAccruer{transactions: transactions, balances: balances, store: store, options: options}, nil
+}
+
+// InterestReference is the deterministic reference for interest on a balance
+// over [from, to).
+func InterestReference(balanceID string, from, to time.Time) string {
+	return fmt.Sprintf("interest_%s_%s_%s", balanceID, from.Format("20060102"), to.Format("20060102"))
+}
+
+// Accrue computes interest for every day in [from, to) using each day's closing
+// balance from GetHistorical, sampled at the last second of the day. It does
+// not post or update the carry.
+func (a *InterestAccruer) Accrue(balanceID string, from, to time.Time) (*InterestAccrual, error) {
+	loc := a.options.Plan.Location
+	start := time.Date(from.In(loc).Year(), from.In(loc).Month(), from.In(loc).Day(), 0, 0, 0, 0, loc)
+	end := time.Date(to.In(loc).Year(), to.In(loc).Month(), to.In(loc).Day(), 0, 0, 0, 0, loc)
+	if !start.Before(end) {
+		return nil, errors.New("validation error: interest period must cover at least one day")
+	}
+
+	carry, err := a.store.Carry(balanceID, start)
+	if err != nil {
+		return nil, err
+	}
+	if carry == nil {
+		carry = new(big.Rat)
+	}
+
+	accrual := &InterestAccrual{
+		BalanceID: balanceID,
+		From:      start,
+		To:        end,
+		CarryIn:   new(big.Rat).Set(carry),
+		Accrued:   new(big.Rat),
+		Reference: InterestReference(balanceID, start, end),
+	}
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		historical, _, err := a.balances.GetHistorical(balanceID, day.AddDate(0, 0, 1).Add(-time.Second), a.options.FromSource)
+		if err != nil {
+			return nil, fmt.Errorf("interest: historical balance %s at %s: %w", balanceID, day.Format("2006-01-02"), err)
+		}
+		if accrual.Currency == "" {
+			accrual.Currency = historical.Balance.Currency
+		}
+		base := cloneBigInt(historical.Balance.Balance)
+		if a.options.Plan.Compounding == CompoundingDaily {
+			base.Add(base, roundRat(new(big.Rat).Add(accrual.Accrued, carry)))
+		}
+		interest, err := a.options.Plan.DailyInterest(base, day)
+		if err != nil {
+			return nil, err
+		}
+		accrual.Days = append(accrual.Days, InterestDay{Date: day, Balance: cloneBigInt(historical.Balance.Balance), Accrued: interest})
+		accrual.Accrued.Add(accrual.Accrued, interest)
+	}
+
+	total := new(big.Rat).Add(accrual.Accrued, carry)
+	if total.Sign() > 0 {
+		accrual.Amount = a.options.Plan.Rounding.Round(total)
+	} else {
+		accrual.Amount = big.NewInt(0)
+	}
+	accrual.CarryOut = total.Sub(total, new(big.Rat).SetInt(accrual.Amount))
+	return accrual, nil
+}
+
+// Post accrues interest for [from, to), posts it from the source balance with
+// the deterministic reference and carries the unposted fraction forward. The
+// posting is effective at to, after the last sampled instant, so re-running
+// the period reads the same balances. The carry is only updated once the
+// transaction is accepted or found already posted under its reference, and is
+// keyed by period, so posting the same period again is idempotent.
+func (a *InterestAccruer) Post(balanceID string, from, to time.Time) (*InterestAccrual, *Transaction, *http.Response, error) {
+	accrual, err := a.Accrue(balanceID, from, to)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var transaction *Transaction
+	var resp *http.Response
+	if accrual.Amount.Sign() > 0 {
+		effective := accrual.To
+		transaction, resp, err = a.transactions.Create(CreateTransactionRequest{
+			ParentTransaction: ParentTransaction{
+				PreciseAmount: new(big.Int).Set(accrual.Amount),
+				Precision:     a.options.Precision,
+				Reference:     accrual.Reference,
+				Description:   fmt.Sprintf("Interest %s to %s", accrual.From.Format("2006-01-02"), accrual.To.AddDate(0, 0, -1).Format("2006-01-02")),
+				Currency:      accrual.Currency,
+				Source:        a.options.Source,
+				Destination:   balanceID,
+				EffectiveDate: &effective,
+				MetaData: MetaData{
+					"interest_from":    accrual.From.Format("2006-01-02"),
+					"interest_to":      accrual.To.Format("2006-01-02"),
+					"interest_accrued": accrual.Accrued.FloatString(6),
+				},
+			},
+			AllowOverdraft: true,
+		})
+		if err != nil {
+			existing, _, lookupErr := a.transactions.GetByReference(accrual.Reference)
+			if lookupErr != nil {
+				return accrual, nil, resp, err
+			}
+			transaction = existing
+		}
+	}
+	if err := a.store.SetCarry(balanceID, accrual.To, accrual.CarryOut); err != nil {
+		return accrual, transaction, resp, err
+	}
+	return accrual, transaction, resp, nil
+}
+
+// MemoryInterestStore keeps interest carries in memory.
+type MemoryInterestStore struct {
+	carries map[string][]interestCarry
+	mu      sync.Mutex
+}
+
+type interestCarry struct {
+	at    time.Time
+	carry *big.Rat
+}
+
+func NewMemoryInterestStore() *MemoryInterestStore {
+	return &MemoryInterestStore{carries: make(map[string][]interestCarry)}
+}
+
+func (s *MemoryInterestStore) Carry(balanceID string, at time.Time) (*big.Rat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	carries := s.carries[balanceID]
+	i := sort.Search(len(carries), func(i int) bool { return carries[i].at.After(at) })
+	if i == 0 {
+		return new(big.Rat), nil
+	}
+	return new(big.Rat).Set(carries[i-1].carry), nil
+}
+
+func (s *MemoryInterestStore) SetCarry(balanceID string, at time.Time, carry *big.Rat) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	carries := s.carries[balanceID]
+	entry := interestCarry{at: at, carry: new(big.Rat).Set(carry)}
+	i := sort.Search(len(carries), func(i int) bool { return !carries[i].at.Before(at) })
+	if i < len(carries) && carries[i].at.Equal(at) {
+		carries[i] = entry
+	} else {
+		carries = append(carries, interestCarry{})
+		copy(carries[i+1:], carries[i:])
+		carries[i] = entry
+	}
+	s.carries[balanceID] = carries
+	return nil
+}
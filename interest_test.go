@@ -0,0 +1,250 @@
+package blnkgo_test
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDayCountConvention_YearFraction(t *testing.T) {
+	jan31 := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	feb28 := time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		convention blnkgo.DayCountConvention
+		from, to   time.Time
+		want       *big.Rat
+	}{
+		{blnkgo.DayCountACT365, jan31, jan31.AddDate(0, 0, 1), big.NewRat(1, 365)},
+		{blnkgo.DayCountACT360, jan31, feb28, big.NewRat(28, 360)},
+		{blnkgo.DayCount30360, jan31, jan31.AddDate(0, 0, 1), big.NewRat(1, 360)},
+		{blnkgo.DayCount30360, time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), big.NewRat(1, 360)},
+		{blnkgo.DayCount30360, time.Date(2024, 3, 30, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), big.NewRat(0, 1)},
+	}
+	for _, tt := range tests {
+		got, err := tt.convention.YearFraction(tt.from, tt.to)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want.String(), got.String(), "%s %s", tt.convention, tt.from.Format("2006-01-02"))
+	}
+
+	_, err := blnkgo.DayCountConvention("ACT/ACT").YearFraction(jan31, feb28)
+	assert.Error(t, err)
+}
+
+func TestRoundingMode_Round(t *testing.T) {
+	tests := []struct {
+		mode blnkgo.RoundingMode
+		in   *big.Rat
+		want int64
+	}{
+		{blnkgo.RoundHalfUp, big.NewRat(5, 2), 3},
+		{blnkgo.RoundHalfEven, big.NewRat(5, 2), 2},
+		{blnkgo.RoundHalfEven, big.NewRat(7, 2), 4},
+		{blnkgo.RoundDown, big.NewRat(29, 10), 2},
+		{blnkgo.RoundUp, big.NewRat(21, 10), 3},
+		{blnkgo.RoundUp, big.NewRat(4, 1), 4},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.mode.Round(tt.in).Int64(), "%s %s", tt.mode, tt.in)
+	}
+}
+
+func TestInterestPlan_AnnualInterest_Tiered(t *testing.T) {
+	plan := blnkgo.InterestPlan{Tiers: []blnkgo.RateTier{
+		{UpTo: big.NewInt(100000), Rate: 1},
+		{UpTo: big.NewInt(500000), Rate: 2},
+		{Rate: 3},
+	}}
+	require.NoError(t, blnkgo.ValidateInterestPlan(plan))
+
+	interest, err := plan.AnnualInterest(big.NewInt(600000))
+	require.NoError(t, err)
+	// 1000 + 8000 + 3000
+	assert.Equal(t, "12000", interest.RatString())
+
+	interest, err = plan.AnnualInterest(big.NewInt(50000))
+	require.NoError(t, err)
+	assert.Equal(t, "500", interest.RatString())
+
+	interest, err = plan.AnnualInterest(big.NewInt(-100))
+	require.NoError(t, err)
+	assert.Equal(t, "0", interest.RatString())
+
+	assert.Error(t, blnkgo.ValidateInterestPlan(blnkgo.InterestPlan{Tiers: []blnkgo.RateTier{{Rate: 1}, {UpTo: big.NewInt(10), Rate: 2}}}))
+	assert.Error(t, blnkgo.ValidateInterestPlan(blnkgo.InterestPlan{DayCount: "ACT/ACT"}))
+}
+
+func setupInterestAccruer(t *testing.T, plan blnkgo.InterestPlan, balance int64) (*MockClient, *blnkgo.InterestAccruer, *blnkgo.MemoryInterestStore) {
+	mockClient := &MockClient{}
+	store := blnkgo.NewMemoryInterestStore()
+	accruer, err := blnkgo.NewInterestAccruer(blnkgo.NewTransactionService(mockClient), blnkgo.NewLedgerBalanceService(mockClient), store,
+		blnkgo.InterestOptions{Plan: plan, Source: "@interest_expense", Precision: 100})
+	require.NoError(t, err)
+
+	mockClient.On("NewRequest", mock.MatchedBy(func(p string) bool { return strings.HasPrefix(p, "balances/bln_savings/at?") }), http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalanceHistorical")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		h := args.Get(1).(*blnkgo.LedgerBalanceHistorical)
+		h.Balance.Balance = big.NewInt(balance)
+		h.Balance.Currency = "USD"
+	})
+	return mockClient, accruer, store
+}
+
+func TestInterestAccruer_Accrue(t *testing.T) {
+	_, accruer, _ := setupInterestAccruer(t, blnkgo.InterestPlan{Rate: 3.65, DayCount: blnkgo.DayCountACT365}, 100000)
+
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	accrual, err := accruer.Accrue("bln_savings", from, from.AddDate(0, 0, 30))
+	require.NoError(t, err)
+	assert.Len(t, accrual.Days, 30)
+	assert.Equal(t, "10", accrual.Days[0].Accrued.RatString())
+	assert.Equal(t, "300", accrual.Amount.String())
+	assert.Equal(t, "interest_bln_savings_20240601_20240701", accrual.Reference)
+	assert.Equal(t, "USD", accrual.Currency)
+
+	_, compounding, _ := setupInterestAccruer(t, blnkgo.InterestPlan{Rate: 3.65, Compounding: blnkgo.CompoundingDaily}, 100000)
+	compounded, err := compounding.Accrue("bln_savings", from, from.AddDate(0, 0, 30))
+	require.NoError(t, err)
+	assert.Equal(t, 1, compounded.Accrued.Cmp(accrual.Accrued))
+}
+
+func TestInterestAccruer_Post_CarriesFraction(t *testing.T) {
+	// 1000 * 1% / 360 = 1/36 minor units a day
+	mockClient, accruer, store := setupInterestAccruer(t, blnkgo.InterestPlan{Rate: 1, DayCount: blnkgo.DayCountACT360, Rounding: blnkgo.RoundDown}, 1000)
+	var posted []blnkgo.CreateTransactionRequest
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		posted = append(posted, args.Get(2).(blnkgo.CreateTransactionRequest))
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusCreated}, nil)
+
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	accrual, txn, _, err := accruer.Post("bln_savings", from, from.AddDate(0, 0, 30))
+	require.NoError(t, err)
+	assert.Nil(t, txn)
+	assert.Equal(t, "0", accrual.Amount.String())
+	carry, _ := store.Carry("bln_savings", from.AddDate(0, 0, 30))
+	assert.Equal(t, "5/6", carry.RatString())
+
+	accrual, txn, _, err = accruer.Post("bln_savings", from.AddDate(0, 0, 30), from.AddDate(0, 0, 37))
+	require.NoError(t, err)
+	require.NotNil(t, txn)
+	assert.Equal(t, "1", accrual.Amount.String())
+	carry, _ = store.Carry("bln_savings", from.AddDate(0, 0, 37))
+	assert.Equal(t, "1/36", carry.RatString())
+
+	require.Len(t, posted, 1)
+	assert.Equal(t, "@interest_expense", posted[0].Source)
+	assert.Equal(t, "bln_savings", posted[0].Destination)
+	assert.Equal(t, "interest_bln_savings_20240701_20240708", posted[0].Reference)
+}
+
+func TestInterestAccruer_Post_RepeatIsIdempotent(t *testing.T) {
+	mockClient, accruer, store := setupInterestAccruer(t, blnkgo.InterestPlan{Rate: 1, DayCount: blnkgo.DayCountACT360, Rounding: blnkgo.RoundDown}, 1000)
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{URL: &url.URL{Path: "create"}}, nil)
+	mockClient.On("CallWithRetry", onChartPath("create"), mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.Transaction).TransactionID = "txn_interest"
+	}).Once()
+	mockClient.On("CallWithRetry", onChartPath("create"), mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusBadRequest}, errors.New("reference already used")).Once()
+	mockClient.On("NewRequest", "transactions/reference/interest_bln_savings_20240701_20240708", http.MethodGet, nil).Return(&http.Request{URL: &url.URL{Path: "lookup"}}, nil)
+	mockClient.On("CallWithRetry", onChartPath("lookup"), mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.Transaction).TransactionID = "txn_interest"
+	})
+
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	june, july := from.AddDate(0, 0, 30), from.AddDate(0, 0, 37)
+
+	// A zero-amount period posted twice must not add its fraction twice.
+	for i := 0; i < 2; i++ {
+		accrual, txn, _, err := accruer.Post("bln_savings", from, june)
+		require.NoError(t, err)
+		assert.Nil(t, txn)
+		assert.Equal(t, "0", accrual.CarryIn.RatString())
+		carry, _ := store.Carry("bln_savings", june)
+		assert.Equal(t, "5/6", carry.RatString())
+	}
+
+	// The repeat is rejected by Core as a duplicate and read back by reference.
+	for i := 0; i < 2; i++ {
+		accrual, txn, _, err := accruer.Post("bln_savings", june, july)
+		require.NoError(t, err)
+		require.NotNil(t, txn)
+		assert.Equal(t, "txn_interest", txn.TransactionID)
+		assert.Equal(t, "5/6", accrual.CarryIn.RatString())
+		assert.Equal(t, "1", accrual.Amount.String())
+		carry, _ := store.Carry("bln_savings", july)
+		assert.Equal(t, "1/36", carry.RatString())
+	}
+	mockClient.AssertExpectations(t)
+}
+
+func TestInterestAccruer_Post_RerunIgnoresPostedInterest(t *testing.T) {
+	// 100000 * 1% / 360 = 25/9 minor units a day; 7 days post 19 and carry 4/9.
+	mockClient := &MockClient{}
+	store := blnkgo.NewMemoryInterestStore()
+	accruer, err := blnkgo.NewInterestAccruer(blnkgo.NewTransactionService(mockClient), blnkgo.NewLedgerBalanceService(mockClient), store,
+		blnkgo.InterestOptions{Plan: blnkgo.InterestPlan{Rate: 1, DayCount: blnkgo.DayCountACT360, Rounding: blnkgo.RoundDown}, Source: "@interest_expense", Precision: 100})
+	require.NoError(t, err)
+
+	// The historical balance includes the posted interest from its effective
+	// date on, as Core would report it.
+	var posted *blnkgo.CreateTransactionRequest
+	var sampledAt time.Time
+	mockClient.On("NewRequest", mock.MatchedBy(func(p string) bool { return strings.HasPrefix(p, "balances/bln_savings/at?") }), http.MethodGet, nil).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		sampledAt, _ = time.Parse(time.RFC3339, strings.TrimPrefix(args.String(0), "balances/bln_savings/at?timestamp="))
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalanceHistorical")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		h := args.Get(1).(*blnkgo.LedgerBalanceHistorical)
+		h.Balance.Balance = big.NewInt(100000)
+		h.Balance.Currency = "USD"
+		if posted != nil && !sampledAt.Before(*posted.EffectiveDate) {
+			h.Balance.Balance.Add(h.Balance.Balance, posted.PreciseAmount)
+		}
+	})
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{URL: &url.URL{Path: "create"}}, nil).Run(func(args mock.Arguments) {
+		if posted == nil {
+			body := args.Get(2).(blnkgo.CreateTransactionRequest)
+			posted = &body
+		}
+	})
+	mockClient.On("CallWithRetry", onChartPath("create"), mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Once()
+	mockClient.On("CallWithRetry", onChartPath("create"), mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusBadRequest}, errors.New("reference already used")).Once()
+	mockClient.On("NewRequest", "transactions/reference/interest_bln_savings_20240701_20240708", http.MethodGet, nil).Return(&http.Request{URL: &url.URL{Path: "lookup"}}, nil)
+	mockClient.On("CallWithRetry", onChartPath("lookup"), mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusOK}, nil)
+
+	from, to := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 7, 8, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		accrual, txn, _, err := accruer.Post("bln_savings", from, to)
+		require.NoError(t, err)
+		require.NotNil(t, txn)
+		assert.Equal(t, "175/9", accrual.Accrued.RatString())
+		assert.Equal(t, "19", accrual.Amount.String())
+		assert.Equal(t, "4/9", accrual.CarryOut.RatString())
+		carry, _ := store.Carry("bln_savings", to)
+		assert.Equal(t, "4/9", carry.RatString())
+	}
+	assert.Equal(t, to, *posted.EffectiveDate)
+	mockClient.AssertExpectations(t)
+}
+
+func TestInterestAccruer_Accrue_DailyCompoundingIncludesCarry(t *testing.T) {
+	// 100 * 365% / 365 = 1 minor unit a day. The carried 1/2 rounds to 1, so
+	// the first day accrues on 101; with the first day's 101/100 it rounds
+	// to 2, so the second day accrues on 102.
+	_, accruer, store := setupInterestAccruer(t, blnkgo.InterestPlan{Rate: 365, Compounding: blnkgo.CompoundingDaily}, 100)
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, store.SetCarry("bln_savings", from, big.NewRat(1, 2)))
+
+	accrual, err := accruer.Accrue("bln_savings", from, from.AddDate(0, 0, 2))
+	require.NoError(t, err)
+	assert.Equal(t, "101/100", accrual.Days[0].Accrued.RatString())
+	assert.Equal(t, "51/50", accrual.Days[1].Accrued.RatString())
+}
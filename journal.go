@@ -0,0 +1,190 @@
+package blnkgo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Metadata keys linking the transactions of a posted journal entry.
+const (
+	JournalIDMetaKey         = "journal_id"
+	JournalDebitLineMetaKey  = "journal_debit_line"
+	JournalCreditLineMetaKey = "journal_credit_line"
+)
+
+// JournalLine debits or credits one balance. Exactly one of Debit or Credit
+// must be set, in minor units.
+type JournalLine struct {
+	Balance   string
+	Currency  string
+	Debit     *big.Int
+	Credit    *big.Int
+	Narration string
+}
+
+// Journal is a double-entry journal entry. Debits and credits must balance per
+// currency. EffectiveDate, when set, back-dates every posting of the entry.
+// Debited balances are sources, so set AllowOverdraft when they may go negative.
+type Journal struct {
+	ID             string
+	Description    string
+	Precision      int64
+	EffectiveDate  *time.Time
+	Lines          []JournalLine
+	MetaData       MetaData
+	SkipQueue      bool
+	AllowOverdraft bool
+}
+
+// ValidateJournal checks every line and that debits equal credits per currency.
+func ValidateJournal(j Journal) error {
+	if strings.TrimSpace(j.ID) == "" {
+		return errors.New("validation error: journal id is required")
+	}
+	if len(j.Lines) < 2 {
+		return errors.New("validation error: a journal needs at least one debit and one credit line")
+	}
+
+	totals := make(map[string]*big.Int)
+	for i, line := range j.Lines {
+		if strings.TrimSpace(line.Balance) == "" {
+			return fmt.Errorf("validation error: journal line %d must have a balance", i)
+		}
+		if line.Currency == "" {
+			return fmt.Errorf("validation error: journal line %d must have a currency", i)
+		}
+		if (line.Debit == nil) == (line.Credit == nil) {
+			return fmt.Errorf("validation error: journal line %d must set exactly one of debit or credit", i)
+		}
+		amount := line.Debit
+		if amount == nil {
+			amount = line.Credit
+		}
+		if amount.Sign() <= 0 {
+			return fmt.Errorf("validation error: journal line %d amount must be positive", i)
+		}
+		if totals[line.Currency] == nil {
+			totals[line.Currency] = big.NewInt(0)
+		}
+		if line.Debit != nil {
+			totals[line.Currency].Add(totals[line.Currency], amount)
+		} else {
+			totals[line.Currency].Sub(totals[line.Currency], amount)
+		}
+	}
+	for _, currency := range sortedKeys(totals) {
+		switch diff := totals[currency]; diff.Sign() {
+		case 1:
+			return fmt.Errorf("validation error: journal %s does not balance in %s: debits exceed credits by %s", j.ID, currency, diff)
+		case -1:
+			return fmt.Errorf("validation error: journal %s does not balance in %s: credits exceed debits by %s", j.ID, currency, new(big.Int).Neg(diff))
+		}
+	}
+	return nil
+}
+
+// Transactions decomposes the journal into source-to-destination transfers:
+// debit lines are matched to credit lines of the same currency in order, so
+// each debited balance is a source and each credited balance a destination.
+// References are "<ID>_<n>".
+func (j Journal) Transactions() ([]CreateTransactionRequest, error) {
+	if err := ValidateJournal(j); err != nil {
+		return nil, err
+	}
+	precision := j.Precision
+	if precision == 0 {
+		precision = 1
+	}
+
+	type open struct {
+		index  int
+		amount *big.Int
+	}
+	debits := make(map[string][]*open)
+	credits := make(map[string][]*open)
+	var currencies []string
+	for i, line := range j.Lines {
+		if _, seen := debits[line.Currency]; !seen {
+			if _, seen := credits[line.Currency]; !seen {
+				currencies = append(currencies, line.Currency)
+			}
+		}
+		if line.Debit != nil {
+			debits[line.Currency] = append(debits[line.Currency], &open{i, new(big.Int).Set(line.Debit)})
+		} else {
+			credits[line.Currency] = append(credits[line.Currency], &open{i, new(big.Int).Set(line.Credit)})
+		}
+	}
+
+	var out []CreateTransactionRequest
+	for _, currency := range currencies {
+		ds, cs := debits[currency], credits[currency]
+		for d, c := 0, 0; d < len(ds) && c < len(cs); {
+			amount := ds[d].amount
+			if cs[c].amount.Cmp(amount) < 0 {
+				amount = cs[c].amount
+			}
+			amount = new(big.Int).Set(amount)
+
+			debit, credit := j.Lines[ds[d].index], j.Lines[cs[c].index]
+			meta := make(MetaData, len(j.MetaData)+3)
+			for k, v := range j.MetaData {
+				meta[k] = v
+			}
+			meta[JournalIDMetaKey] = j.ID
+			meta[JournalDebitLineMetaKey] = ds[d].index
+			meta[JournalCreditLineMetaKey] = cs[c].index
+
+			description := j.Description
+			if description == "" {
+				description = fmt.Sprintf("Journal %s", j.ID)
+			}
+			if debit.Narration != "" {
+				description = debit.Narration
+			}
+			out = append(out, CreateTransactionRequest{
+				ParentTransaction: ParentTransaction{
+					PreciseAmount: amount,
+					Precision:     precision,
+					Reference:     fmt.Sprintf("%s_%d", j.ID, len(out)+1),
+					Description:   description,
+					Currency:      currency,
+					Source:        debit.Balance,
+					Destination:   credit.Balance,
+					SkipQueue:     j.SkipQueue,
+					MetaData:      meta,
+					EffectiveDate: j.EffectiveDate,
+				},
+				AllowOverdraft: j.AllowOverdraft,
+			})
+
+			ds[d].amount.Sub(ds[d].amount, amount)
+			cs[c].amount.Sub(cs[c].amount, amount)
+			if ds[d].amount.Sign() == 0 {
+				d++
+			}
+			if cs[c].amount.Sign() == 0 {
+				c++
+			}
+		}
+	}
+	return out, nil
+}
+
+// PostJournal submits the journal's transactions as one atomic bulk request,
+// so the entry either posts in full or not at all.
+func (s *TransactionService) PostJournal(j Journal) (*CreateBulkTransactionResponse, *http.Response, error) {
+	transactions, err := j.Transactions()
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.CreateBulk(CreateBulkTransactionRequest{
+		Transactions: transactions,
+		Atomic:       true,
+		SkipQueue:    j.SkipQueue,
+	})
+}
@@ -0,0 +1,108 @@
+package blnkgo_test
+
+import (
+	"math/big"
+	"net/http"
+	"testing"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func payrollJournal() blnkgo.Journal {
+	return blnkgo.Journal{
+		ID:          "je_2024_06_payroll",
+		Description: "June payroll",
+		Precision:   100,
+		Lines: []blnkgo.JournalLine{
+			{Balance: "@salaries_expense", Currency: "USD", Debit: big.NewInt(100000)},
+			{Balance: "@payroll_tax_expense", Currency: "USD", Debit: big.NewInt(7650)},
+			{Balance: "@wages_payable", Currency: "USD", Credit: big.NewInt(80000)},
+			{Balance: "@tax_payable", Currency: "USD", Credit: big.NewInt(27650)},
+		},
+		MetaData: blnkgo.MetaData{"period": "2024-06"},
+	}
+}
+
+func TestValidateJournal(t *testing.T) {
+	assert.NoError(t, blnkgo.ValidateJournal(payrollJournal()))
+
+	j := payrollJournal()
+	j.Lines[3].Credit = big.NewInt(27649)
+	assert.EqualError(t, blnkgo.ValidateJournal(j), "validation error: journal je_2024_06_payroll does not balance in USD: debits exceed credits by 1")
+
+	j = payrollJournal()
+	j.Lines[3].Credit = big.NewInt(27652)
+	assert.EqualError(t, blnkgo.ValidateJournal(j), "validation error: journal je_2024_06_payroll does not balance in USD: credits exceed debits by 2")
+
+	j = payrollJournal()
+	j.Lines[0].Credit = big.NewInt(1)
+	assert.Error(t, blnkgo.ValidateJournal(j))
+
+	j = payrollJournal()
+	j.ID = ""
+	assert.Error(t, blnkgo.ValidateJournal(j))
+}
+
+func TestJournal_Transactions(t *testing.T) {
+	txns, err := payrollJournal().Transactions()
+	require.NoError(t, err)
+	require.Len(t, txns, 3)
+
+	assert.Equal(t, "@salaries_expense", txns[0].Source)
+	assert.Equal(t, "@wages_payable", txns[0].Destination)
+	assert.Equal(t, "80000", txns[0].PreciseAmount.String())
+
+	assert.Equal(t, "@salaries_expense", txns[1].Source)
+	assert.Equal(t, "@tax_payable", txns[1].Destination)
+	assert.Equal(t, "20000", txns[1].PreciseAmount.String())
+
+	assert.Equal(t, "@payroll_tax_expense", txns[2].Source)
+	assert.Equal(t, "@tax_payable", txns[2].Destination)
+	assert.Equal(t, "7650", txns[2].PreciseAmount.String())
+
+	assert.Equal(t, "je_2024_06_payroll_3", txns[2].Reference)
+	assert.Equal(t, "je_2024_06_payroll", txns[2].MetaData[blnkgo.JournalIDMetaKey])
+	assert.Equal(t, "2024-06", txns[2].MetaData["period"])
+}
+
+func TestJournal_Transactions_MultiCurrency(t *testing.T) {
+	txns, err := blnkgo.Journal{
+		ID: "je_fx",
+		Lines: []blnkgo.JournalLine{
+			{Balance: "@usd_cash", Currency: "USD", Debit: big.NewInt(100)},
+			{Balance: "@eur_cash", Currency: "EUR", Credit: big.NewInt(90)},
+			{Balance: "@fx_usd", Currency: "USD", Credit: big.NewInt(100)},
+			{Balance: "@fx_eur", Currency: "EUR", Debit: big.NewInt(90)},
+		},
+	}.Transactions()
+	require.NoError(t, err)
+	require.Len(t, txns, 2)
+	assert.Equal(t, "USD", txns[0].Currency)
+	assert.Equal(t, "EUR", txns[1].Currency)
+	assert.Equal(t, "@fx_eur", txns[1].Source)
+}
+
+func TestTransactionService_PostJournal(t *testing.T) {
+	mockClient, svc := setupTransactionService()
+	var sent blnkgo.CreateBulkTransactionRequest
+	mockClient.On("NewRequest", "transactions/bulk", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		sent = args.Get(2).(blnkgo.CreateBulkTransactionRequest)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.CreateBulkTransactionResponse")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.CreateBulkTransactionResponse).BatchID = "batch_je"
+	})
+
+	resp, _, err := svc.PostJournal(payrollJournal())
+	require.NoError(t, err)
+	assert.Equal(t, "batch_je", resp.BatchID)
+	assert.True(t, sent.Atomic)
+	assert.Len(t, sent.Transactions, 3)
+
+	j := payrollJournal()
+	j.Lines = j.Lines[:3]
+	_, _, err = svc.PostJournal(j)
+	assert.Error(t, err)
+}
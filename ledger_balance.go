@@ -36,6 +36,7 @@ type LedgerBalance struct {
 type CreateLedgerBalanceRequest struct {
 	LedgerID           string                 `json:"ledger_id"`
 	IdentityID         string                 `json:"identity_id,omitempty"`
+	Indicator          string                 `json:"indicator,omitempty"`
 	Currency           string                 `json:"currency"`
 	TrackFundLineage   bool                   `json:"track_fund_lineage,omitempty"`
 	AllocationStrategy AllocationStrategy     `json:"allocation_strategy,omitempty"`
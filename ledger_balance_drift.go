@@ -0,0 +1,237 @@
+package blnkgo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Balance fields compared by CheckDrift.
+var (
+	driftFields = []string{
+		"balance", "credit_balance", "debit_balance",
+		"inflight_balance", "inflight_credit_balance", "inflight_debit_balance",
+		"queued_credit_balance", "queued_debit_balance",
+	}
+	historicalDriftFields = []string{"balance", "credit_balance", "debit_balance"}
+)
+
+// DriftCheckOptions selects the balances to audit: the listed BalanceIDs plus
+// those matching LedgerID and Filters. With none of them set every balance is
+// checked.
+type DriftCheckOptions struct {
+	BalanceIDs []string
+	LedgerID   string
+	Filters    []Filter
+	// At compares GetHistorical values at that time instead of current ones.
+	At *time.Time
+	// Fields limits the compared fields (JSON names, e.g. "balance"). Empty
+	// compares every field available for the check.
+	Fields []string
+	// Snapshot calls CreateSnapshot after the check.
+	Snapshot          bool
+	SnapshotBatchSize int
+}
+
+// BalanceFieldDrift is one field whose stored and rebuilt values differ.
+// Difference is Source minus Snapshot.
+type BalanceFieldDrift struct {
+	Field      string   `json:"field"`
+	Snapshot   *big.Int `json:"snapshot"`
+	Source     *big.Int `json:"source"`
+	Difference *big.Int `json:"difference"`
+}
+
+// BalanceDrift lists the drifted fields of one balance.
+type BalanceDrift struct {
+	BalanceID string              `json:"balance_id"`
+	Currency  string              `json:"currency"`
+	Fields    []BalanceFieldDrift `json:"fields"`
+}
+
+// DriftReport is the result of a drift check.
+type DriftReport struct {
+	CheckedAt       time.Time      `json:"checked_at"`
+	At              *time.Time     `json:"at,omitempty"`
+	Checked         int            `json:"checked"`
+	Drifted         []BalanceDrift `json:"drifted"`
+	Unsettled       []string       `json:"unsettled,omitempty"`
+	SnapshotMessage string         `json:"snapshot_message,omitempty"`
+}
+
+// HasDrift reports whether any balance drifted.
+func (r *DriftReport) HasDrift() bool {
+	return len(r.Drifted) > 0
+}
+
+// ValidateDriftCheckOptions checks the selected fields exist for the check.
+func ValidateDriftCheckOptions(options DriftCheckOptions) error {
+	available := driftFields
+	if options.At != nil {
+		available = historicalDriftFields
+	}
+	for _, f := range options.Fields {
+		if !containsString(available, f) {
+			return fmt.Errorf("validation error: field %q cannot be compared", f)
+		}
+	}
+	if options.At != nil && options.At.IsZero() {
+		return errors.New("validation error: drift check time is required when set")
+	}
+	if options.SnapshotBatchSize < 0 {
+		return errors.New("validation error: snapshot batch size must be non-negative")
+	}
+	return nil
+}
+
+// driftRechecks is how many times a current-value comparison is repeated when
+// the stored balance moves while it is being rebuilt.
+const driftRechecks = 3
+
+// CheckDrift fetches every selected balance twice, from snapshots and rebuilt
+// from transactions (FromSource), and reports the fields that differ. Nil
+// values count as zero.
+//
+// Current values are read stored, rebuilt, stored again, and a difference is
+// only flagged when the two stored reads agree, so a posting landing between
+// the reads is not mistaken for drift. Balances that keep moving across
+// driftRechecks attempts are listed in Unsettled instead. Historical checks
+// (At) compare a fixed timestamp and need no re-check.
+func (s *LedgerBalanceService) CheckDrift(options DriftCheckOptions) (*DriftReport, error) {
+	if err := ValidateDriftCheckOptions(options); err != nil {
+		return nil, err
+	}
+	fields := options.Fields
+	if len(fields) == 0 {
+		fields = driftFields
+		if options.At != nil {
+			fields = historicalDriftFields
+		}
+	}
+
+	var scope []Filter
+	if len(options.BalanceIDs) == 0 || options.LedgerID != "" || len(options.Filters) > 0 {
+		scope = append([]Filter{}, options.Filters...)
+		if options.LedgerID != "" {
+			scope = append(scope, Filter{Field: "ledger_id", Operator: OpEqual, Value: options.LedgerID})
+		}
+	}
+	balances, err := s.selectBalances(options.BalanceIDs, scope, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DriftReport{CheckedAt: time.Now().UTC(), At: options.At}
+	for _, b := range balances {
+		stored, rebuilt, settled, err := s.driftValues(b.BalanceID, options.At, fields)
+		if err != nil {
+			return nil, fmt.Errorf("drift check: %s: %w", b.BalanceID, err)
+		}
+		if !settled {
+			report.Unsettled = append(report.Unsettled, b.BalanceID)
+			continue
+		}
+		report.Checked++
+
+		drift := BalanceDrift{BalanceID: b.BalanceID, Currency: b.Currency, Fields: driftedFields(stored, rebuilt, fields)}
+		if len(drift.Fields) > 0 {
+			report.Drifted = append(report.Drifted, drift)
+		}
+	}
+
+	if options.Snapshot {
+		snapshot, _, err := s.CreateSnapshot(CreateBalanceSnapshotRequest{BatchSize: options.SnapshotBatchSize})
+		if err != nil {
+			return report, fmt.Errorf("drift check: snapshot failed: %w", err)
+		}
+		report.SnapshotMessage = snapshot.Message
+	}
+	return report, nil
+}
+
+// driftValues returns the stored and rebuilt values of a balance and whether
+// the stored values held still while the balance was rebuilt.
+func (s *LedgerBalanceService) driftValues(balanceID string, at *time.Time, fields []string) (stored, rebuilt map[string]*big.Int, settled bool, err error) {
+	if at != nil {
+		snapshot, _, err := s.GetHistorical(balanceID, *at, false)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		source, _, err := s.GetHistorical(balanceID, *at, true)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		return historicalFields(snapshot.Balance), historicalFields(source.Balance), true, nil
+	}
+
+	for attempt := 0; attempt < driftRechecks; attempt++ {
+		snapshot, _, err := s.Get(balanceID)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		source, _, err := s.Get(balanceID, &GetBalanceRequest{FromSource: true})
+		if err != nil {
+			return nil, nil, false, err
+		}
+		stored, rebuilt = balanceFields(snapshot), balanceFields(source)
+		if len(driftedFields(stored, rebuilt, fields)) == 0 {
+			return stored, rebuilt, true, nil
+		}
+		again, _, err := s.Get(balanceID)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if len(driftedFields(stored, balanceFields(again), fields)) == 0 {
+			return stored, rebuilt, true, nil
+		}
+	}
+	return stored, rebuilt, false, nil
+}
+
+// driftedFields compares fields of stored and rebuilt values, nil as zero.
+func driftedFields(stored, rebuilt map[string]*big.Int, fields []string) []BalanceFieldDrift {
+	var drifted []BalanceFieldDrift
+	for _, f := range fields {
+		snapshot, source := cloneBigInt(stored[f]), cloneBigInt(rebuilt[f])
+		if snapshot.Cmp(source) != 0 {
+			drifted = append(drifted, BalanceFieldDrift{
+				Field:      f,
+				Snapshot:   snapshot,
+				Source:     source,
+				Difference: new(big.Int).Sub(source, snapshot),
+			})
+		}
+	}
+	return drifted
+}
+
+func balanceFields(b *LedgerBalance) map[string]*big.Int {
+	return map[string]*big.Int{
+		"balance":                 b.Balance,
+		"credit_balance":          b.CreditBalance,
+		"debit_balance":           b.DebitBalance,
+		"inflight_balance":        b.InflightBalance,
+		"inflight_credit_balance": b.InflightCreditBalance,
+		"inflight_debit_balance":  b.InflightDebitBalance,
+		"queued_credit_balance":   b.QueuedCreditBalance,
+		"queued_debit_balance":    b.QueuedDebitBalance,
+	}
+}
+
+func historicalFields(b BalanceDetails) map[string]*big.Int {
+	return map[string]*big.Int{
+		"balance":        b.Balance,
+		"credit_balance": b.CreditBalance,
+		"debit_balance":  b.DebitBalance,
+	}
+}
+
+func containsString(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package blnkgo_test
+
+import (
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func mockDriftBalances(mockClient *MockClient) {
+	mockClient.On("NewRequest", "balances/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.FilterResponse).Data = []interface{}{
+			map[string]interface{}{"balance_id": "bln_ok", "currency": "USD"},
+			map[string]interface{}{"balance_id": "bln_drifted", "currency": "USD"},
+		}
+	})
+}
+
+func TestLedgerBalanceService_CheckDrift(t *testing.T) {
+	mockClient, svc := setupLedgerBalanceService()
+	mockDriftBalances(mockClient)
+
+	var path string
+	mockClient.On("NewRequest", mock.MatchedBy(func(p string) bool { return strings.HasPrefix(p, "balances/bln_") }), http.MethodGet, nil).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		path = args.String(0)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		b := args.Get(1).(*blnkgo.LedgerBalance)
+		b.Balance = big.NewInt(1000)
+		b.CreditBalance = big.NewInt(1000)
+		b.DebitBalance = big.NewInt(0)
+		if path == "balances/bln_drifted?from_source=true" {
+			b.Balance = big.NewInt(1200)
+			b.CreditBalance = big.NewInt(1200)
+			b.DebitBalance = nil
+		}
+	})
+	mockClient.On("NewRequest", "balances-snapshots", http.MethodPost, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.CreateBalanceSnapshotResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.CreateBalanceSnapshotResponse).Message = "snapshot started"
+	})
+
+	report, err := svc.CheckDrift(blnkgo.DriftCheckOptions{Snapshot: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Checked)
+	assert.True(t, report.HasDrift())
+	require.Len(t, report.Drifted, 1)
+	drift := report.Drifted[0]
+	assert.Equal(t, "bln_drifted", drift.BalanceID)
+	require.Len(t, drift.Fields, 2)
+	assert.Equal(t, "balance", drift.Fields[0].Field)
+	assert.Equal(t, "200", drift.Fields[0].Difference.String())
+	assert.Equal(t, "snapshot started", report.SnapshotMessage)
+
+	_, err = svc.CheckDrift(blnkgo.DriftCheckOptions{Fields: []string{"version"}})
+	assert.Error(t, err)
+}
+
+func TestLedgerBalanceService_CheckDrift_Historical(t *testing.T) {
+	mockClient, svc := setupLedgerBalanceService()
+	mockDriftBalances(mockClient)
+
+	var path string
+	mockClient.On("NewRequest", mock.MatchedBy(func(p string) bool { return strings.Contains(p, "/at?timestamp=") }), http.MethodGet, nil).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		path = args.String(0)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalanceHistorical")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		h := args.Get(1).(*blnkgo.LedgerBalanceHistorical)
+		h.Balance.DebitBalance = big.NewInt(300)
+		if strings.HasPrefix(path, "balances/bln_ok/") && strings.HasSuffix(path, "from_source=true") {
+			h.Balance.DebitBalance = big.NewInt(250)
+		}
+	})
+
+	at := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	report, err := svc.CheckDrift(blnkgo.DriftCheckOptions{At: &at, Fields: []string{"debit_balance"}})
+	require.NoError(t, err)
+	require.Len(t, report.Drifted, 1)
+	assert.Equal(t, "bln_ok", report.Drifted[0].BalanceID)
+	assert.Equal(t, "-50", report.Drifted[0].Fields[0].Difference.String())
+	mockClient.AssertNotCalled(t, "NewRequest", "balances-snapshots", http.MethodPost, nil)
+
+	_, err = svc.CheckDrift(blnkgo.DriftCheckOptions{At: &at, Fields: []string{"inflight_balance"}})
+	assert.Error(t, err)
+}
+
+func TestLedgerBalanceService_CheckDrift_RechecksMovingBalances(t *testing.T) {
+	mockClient, svc := setupLedgerBalanceService()
+	mockClient.On("NewRequest", "balances/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.FilterResponse).Data = []interface{}{
+			map[string]interface{}{"balance_id": "bln_settling", "currency": "USD"},
+			map[string]interface{}{"balance_id": "bln_busy", "currency": "USD"},
+		}
+	})
+
+	// Every read sees one more posting. bln_settling stops moving after its
+	// third read, bln_busy never does.
+	reads := map[string]int64{}
+	var id string
+	mockClient.On("NewRequest", mock.MatchedBy(func(p string) bool { return strings.HasPrefix(p, "balances/bln_") }), http.MethodGet, nil).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		id = strings.SplitN(strings.TrimPrefix(args.String(0), "balances/"), "?", 2)[0]
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		if id == "bln_busy" || reads[id] < 3 {
+			reads[id]++
+		}
+		args.Get(1).(*blnkgo.LedgerBalance).Balance = big.NewInt(1000 + reads[id])
+	})
+
+	report, err := svc.CheckDrift(blnkgo.DriftCheckOptions{Fields: []string{"balance"}})
+	require.NoError(t, err)
+	assert.False(t, report.HasDrift())
+	assert.Equal(t, 1, report.Checked)
+	assert.Equal(t, []string{"bln_busy"}, report.Unsettled)
+}
@@ -0,0 +1,73 @@
+package blnkgo
+
+import (
+	"math/big"
+	"strings"
+)
+
+// AvailableBalance returns what the balance can spend: Balance less inflight
+// and queued debits that have not been applied yet. Nil fields count as zero and
+// a nil balance returns zero.
+func (b *LedgerBalance) AvailableBalance() *big.Int {
+	if b == nil {
+		return big.NewInt(0)
+	}
+	available := cloneBigInt(b.Balance)
+	available.Sub(available, cloneBigInt(b.InflightDebitBalance))
+	return available.Sub(available, cloneBigInt(b.QueuedDebitBalance))
+}
+
+// PendingCredits returns inflight and queued credits not yet in Balance.
+func (b *LedgerBalance) PendingCredits() *big.Int {
+	if b == nil {
+		return big.NewInt(0)
+	}
+	pending := cloneBigInt(b.InflightCreditBalance)
+	return pending.Add(pending, cloneBigInt(b.QueuedCreditBalance))
+}
+
+// PendingDebits returns inflight and queued debits not yet in Balance.
+func (b *LedgerBalance) PendingDebits() *big.Int {
+	if b == nil {
+		return big.NewInt(0)
+	}
+	pending := cloneBigInt(b.InflightDebitBalance)
+	return pending.Add(pending, cloneBigInt(b.QueuedDebitBalance))
+}
+
+// PrecisionMultiplier returns the balance's minor-unit multiplier: Precision,
+// else CurrencyMultiplier, else 1.
+func (b *LedgerBalance) PrecisionMultiplier() int64 {
+	switch {
+	case b == nil:
+		return 1
+	case b.Precision > 0:
+		return int64(b.Precision)
+	case b.CurrencyMultiplier >= 1:
+		return int64(b.CurrencyMultiplier)
+	}
+	return 1
+}
+
+// MajorUnits formats amount, in the balance's minor units, as a decimal string,
+// e.g. MajorUnits(b.AvailableBalance()) is "12.50" for 1250 at precision 100.
+// A nil amount formats as zero.
+func (b *LedgerBalance) MajorUnits(amount *big.Int) string {
+	return FormatMajorUnits(amount, b.PrecisionMultiplier())
+}
+
+// FormatMajorUnits formats minor units as a decimal string using Core's
+// precision multiplier. Powers of ten are formatted exactly; other multipliers
+// are rounded to as many places as the multiplier has digits. A zero precision
+// is treated as 1.
+func FormatMajorUnits(amount *big.Int, precision int64) string {
+	if precision <= 0 {
+		precision = 1
+	}
+	p := big.NewInt(precision).String()
+	places := len(p) - 1
+	if strings.TrimLeft(p[1:], "0") != "" || p[0] != '1' {
+		places++
+	}
+	return new(big.Rat).SetFrac(cloneBigInt(amount), big.NewInt(precision)).FloatString(places)
+}
@@ -0,0 +1,42 @@
+package blnkgo_test
+
+import (
+	"math/big"
+	"testing"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLedgerBalance_DerivedFigures(t *testing.T) {
+	b := &blnkgo.LedgerBalance{
+		Balance:               big.NewInt(10000),
+		InflightDebitBalance:  big.NewInt(2500),
+		QueuedDebitBalance:    big.NewInt(500),
+		InflightCreditBalance: big.NewInt(1200),
+		Precision:             100,
+	}
+	assert.Equal(t, "7000", b.AvailableBalance().String())
+	assert.Equal(t, "1200", b.PendingCredits().String())
+	assert.Equal(t, "3000", b.PendingDebits().String())
+	assert.Equal(t, "70.00", b.MajorUnits(b.AvailableBalance()))
+	assert.Equal(t, "-0.05", b.MajorUnits(big.NewInt(-5)))
+	assert.Equal(t, "0.00", b.MajorUnits(nil))
+
+	var missing *blnkgo.LedgerBalance
+	assert.Equal(t, "0", missing.AvailableBalance().String())
+	assert.Equal(t, "0", missing.PendingCredits().String())
+	assert.Equal(t, "12", missing.MajorUnits(big.NewInt(12)))
+
+	empty := &blnkgo.LedgerBalance{CurrencyMultiplier: 1000}
+	assert.Equal(t, "0", empty.AvailableBalance().String())
+	assert.Equal(t, int64(1000), empty.PrecisionMultiplier())
+	assert.Equal(t, "1.234", empty.MajorUnits(big.NewInt(1234)))
+}
+
+func TestFormatMajorUnits(t *testing.T) {
+	assert.Equal(t, "12345", blnkgo.FormatMajorUnits(big.NewInt(12345), 0))
+	assert.Equal(t, "1.2345", blnkgo.FormatMajorUnits(big.NewInt(12345), 10000))
+	assert.Equal(t, "0.3", blnkgo.FormatMajorUnits(big.NewInt(1), 3))
+	assert.Equal(t, "0.008", blnkgo.FormatMajorUnits(big.NewInt(1), 120))
+}
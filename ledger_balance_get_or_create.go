@@ -0,0 +1,117 @@
+package blnkgo
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// BalanceIDCache maps indicator/currency keys (see BalanceIndicatorKey) to
+// balance IDs. Balance IDs never change, so entries need no expiry.
+type BalanceIDCache interface {
+	Get(key string) (string, bool)
+	Set(key, balanceID string)
+}
+
+// BalanceIndicatorKey is the cache key for an indicator and currency.
+func BalanceIndicatorKey(indicator, currency string) string {
+	return indicator + "|" + currency
+}
+
+// MemoryBalanceIDCache is an in-memory BalanceIDCache safe for concurrent use.
+type MemoryBalanceIDCache struct {
+	ids sync.Map
+}
+
+func NewMemoryBalanceIDCache() *MemoryBalanceIDCache {
+	return &MemoryBalanceIDCache{}
+}
+
+func (c *MemoryBalanceIDCache) Get(key string) (string, bool) {
+	id, ok := c.ids.Load(key)
+	if !ok {
+		return "", false
+	}
+	return id.(string), true
+}
+
+func (c *MemoryBalanceIDCache) Set(key, balanceID string) {
+	c.ids.Store(key, balanceID)
+}
+
+// GetOrCreateBalanceRequest resolves the balance for Indicator and Currency,
+// creating it from Defaults when it does not exist. Defaults.Indicator and
+// Defaults.Currency are overwritten.
+type GetOrCreateBalanceRequest struct {
+	Indicator string
+	Currency  string
+	Defaults  CreateLedgerBalanceRequest
+	// Cache, when set, records the resolved balance ID. GetOrCreate always
+	// fetches the balance; ResolveBalanceID answers from the cache.
+	Cache BalanceIDCache
+}
+
+// GetOrCreate returns the balance for the indicator and currency, creating it
+// when GetByIndicator returns 404. If the create fails because another worker
+// created the balance first, the balance is fetched again. created reports
+// whether this call created the balance.
+func (s *LedgerBalanceService) GetOrCreate(r GetOrCreateBalanceRequest) (balance *LedgerBalance, created bool, resp *http.Response, err error) {
+	if r.Indicator == "" || r.Currency == "" {
+		return nil, false, nil, errors.New("validation error: indicator and currency are required")
+	}
+
+	balance, resp, err = s.GetByIndicator(r.Indicator, r.Currency)
+	if err == nil {
+		s.cacheBalanceID(r, balance)
+		return balance, false, resp, nil
+	}
+	if !isNotFound(resp, err) {
+		return nil, false, resp, err
+	}
+
+	body := r.Defaults
+	body.Indicator = r.Indicator
+	body.Currency = r.Currency
+	balance, resp, createErr := s.Create(body)
+	if createErr == nil {
+		s.cacheBalanceID(r, balance)
+		return balance, true, resp, nil
+	}
+
+	// Lost a race with another creator: the balance exists now.
+	balance, refetchResp, err := s.GetByIndicator(r.Indicator, r.Currency)
+	if err != nil {
+		return nil, false, resp, createErr
+	}
+	s.cacheBalanceID(r, balance)
+	return balance, false, refetchResp, nil
+}
+
+// ResolveBalanceID returns the balance ID for the indicator and currency,
+// answering from r.Cache when possible and calling GetOrCreate otherwise.
+func (s *LedgerBalanceService) ResolveBalanceID(r GetOrCreateBalanceRequest) (string, error) {
+	if r.Cache != nil {
+		if id, ok := r.Cache.Get(BalanceIndicatorKey(r.Indicator, r.Currency)); ok {
+			return id, nil
+		}
+	}
+	balance, _, _, err := s.GetOrCreate(r)
+	if err != nil {
+		return "", err
+	}
+	return balance.BalanceID, nil
+}
+
+func (s *LedgerBalanceService) cacheBalanceID(r GetOrCreateBalanceRequest, balance *LedgerBalance) {
+	if r.Cache != nil && balance != nil && balance.BalanceID != "" {
+		r.Cache.Set(BalanceIndicatorKey(r.Indicator, r.Currency), balance.BalanceID)
+	}
+}
+
+func isNotFound(resp *http.Response, err error) bool {
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return true
+	}
+	apiErr, ok := AsApiErrorResponse(err)
+	return ok && apiErr.Status == http.StatusNotFound
+}
@@ -0,0 +1,86 @@
+package blnkgo_test
+
+import (
+	"net/http"
+	"testing"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const merchantIndicatorPath = "balances/indicator/@merchant-123/currency/USD"
+
+func merchantBalanceRequest(cache blnkgo.BalanceIDCache) blnkgo.GetOrCreateBalanceRequest {
+	return blnkgo.GetOrCreateBalanceRequest{
+		Indicator: "@merchant-123",
+		Currency:  "USD",
+		Defaults:  blnkgo.CreateLedgerBalanceRequest{LedgerID: "ldg_merchants"},
+		Cache:     cache,
+	}
+}
+
+func notFound() error {
+	return &blnkgo.ApiErrorResponse{Status: http.StatusNotFound, Message: "balance not found"}
+}
+
+func fillBalance(id string) func(mock.Arguments) {
+	return func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.LedgerBalance).BalanceID = id
+	}
+}
+
+func TestLedgerBalanceService_GetOrCreate_Existing(t *testing.T) {
+	mockClient, svc := setupLedgerBalanceService()
+	mockClient.On("NewRequest", merchantIndicatorPath, http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(fillBalance("bln_existing"))
+
+	balance, created, _, err := svc.GetOrCreate(merchantBalanceRequest(nil))
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "bln_existing", balance.BalanceID)
+	mockClient.AssertNotCalled(t, "NewRequest", "balances", http.MethodPost, mock.Anything)
+}
+
+func TestLedgerBalanceService_GetOrCreate_Creates(t *testing.T) {
+	mockClient, svc := setupLedgerBalanceService()
+	cache := blnkgo.NewMemoryBalanceIDCache()
+	var sent blnkgo.CreateLedgerBalanceRequest
+	mockClient.On("NewRequest", merchantIndicatorPath, http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("NewRequest", "balances", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		sent = args.Get(2).(blnkgo.CreateLedgerBalanceRequest)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusNotFound}, notFound()).Once()
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Run(fillBalance("bln_new")).Once()
+
+	balance, created, _, err := svc.GetOrCreate(merchantBalanceRequest(cache))
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "bln_new", balance.BalanceID)
+	assert.Equal(t, "@merchant-123", sent.Indicator)
+	assert.Equal(t, "USD", sent.Currency)
+	assert.Equal(t, "ldg_merchants", sent.LedgerID)
+
+	id, err := svc.ResolveBalanceID(merchantBalanceRequest(cache))
+	require.NoError(t, err)
+	assert.Equal(t, "bln_new", id)
+	mockClient.AssertNumberOfCalls(t, "CallWithRetry", 2)
+}
+
+func TestLedgerBalanceService_GetOrCreate_LostRace(t *testing.T) {
+	mockClient, svc := setupLedgerBalanceService()
+	mockClient.On("NewRequest", merchantIndicatorPath, http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("NewRequest", "balances", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusNotFound}, notFound()).Once()
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusConflict}, &blnkgo.ApiErrorResponse{Status: http.StatusConflict, Message: "balance already exists"}).Once()
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(fillBalance("bln_other_worker")).Once()
+
+	balance, created, _, err := svc.GetOrCreate(merchantBalanceRequest(nil))
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "bln_other_worker", balance.BalanceID)
+
+	_, _, _, err = svc.GetOrCreate(blnkgo.GetOrCreateBalanceRequest{Indicator: "@merchant-123"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,185 @@
+package blnkgo
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// LineageReportOptions selects the balances in a lineage report: the listed
+// BalanceIDs plus every lineage-tracking balance matching LedgerID, IdentityID
+// and Filters (when any of them is set).
+type LineageReportOptions struct {
+	BalanceIDs []string
+	LedgerID   string
+	IdentityID string
+	Filters    []Filter
+	// FollowShadowBalances fetches each provider's shadow balance with Get.
+	FollowShadowBalances bool
+}
+
+// LineageReportEntry is one provider's funds in one balance, in minor units.
+// ShadowBalance is set when shadow balances are followed.
+type LineageReportEntry struct {
+	BalanceID       string   `json:"balance_id"`
+	Currency        string   `json:"currency"`
+	Provider        string   `json:"provider"`
+	Amount          *big.Int `json:"amount"`
+	Available       *big.Int `json:"available"`
+	Spent           *big.Int `json:"spent"`
+	ShadowBalanceID string   `json:"shadow_balance_id,omitempty"`
+	ShadowBalance   *big.Int `json:"shadow_balance,omitempty"`
+}
+
+// LineageProviderTotal is a provider's exposure in one currency across the
+// report's balances.
+type LineageProviderTotal struct {
+	Provider  string   `json:"provider"`
+	Currency  string   `json:"currency"`
+	Balances  int      `json:"balances"`
+	Amount    *big.Int `json:"amount"`
+	Available *big.Int `json:"available"`
+	Spent     *big.Int `json:"spent"`
+}
+
+// LineageReport aggregates fund lineage across balances.
+type LineageReport struct {
+	GeneratedAt time.Time              `json:"generated_at"`
+	Entries     []LineageReportEntry   `json:"entries"`
+	Providers   []LineageProviderTotal `json:"providers"`
+}
+
+// ValidateLineageReportOptions checks that some balances are selected.
+func ValidateLineageReportOptions(options LineageReportOptions) error {
+	if len(options.BalanceIDs) == 0 && options.LedgerID == "" && options.IdentityID == "" && len(options.Filters) == 0 {
+		return errors.New("validation error: balance ids, a ledger, an identity or filters are required")
+	}
+	for i, id := range options.BalanceIDs {
+		if id == "" {
+			return fmt.Errorf("validation error: balance id at index %d is empty", i)
+		}
+	}
+	return nil
+}
+
+// LineageReport calls GetLineage for every selected balance and totals each
+// provider's received, available and spent funds per currency.
+func (s *LedgerBalanceService) LineageReport(options LineageReportOptions) (*LineageReport, error) {
+	if err := ValidateLineageReportOptions(options); err != nil {
+		return nil, err
+	}
+	balances, err := s.lineageBalances(options)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &LineageReport{GeneratedAt: time.Now().UTC()}
+	totals := map[string]*LineageProviderTotal{}
+	for _, b := range balances {
+		lineage, _, err := s.GetLineage(b.BalanceID)
+		if err != nil {
+			return nil, fmt.Errorf("lineage report: %s: %w", b.BalanceID, err)
+		}
+		for _, p := range lineage.Providers {
+			entry := LineageReportEntry{
+				BalanceID:       b.BalanceID,
+				Currency:        b.Currency,
+				Provider:        p.Provider,
+				Amount:          cloneBigInt(p.Amount),
+				Available:       cloneBigInt(p.Available),
+				Spent:           cloneBigInt(p.Spent),
+				ShadowBalanceID: p.ShadowBalanceID,
+			}
+			if options.FollowShadowBalances && p.ShadowBalanceID != "" {
+				shadow, _, err := s.Get(p.ShadowBalanceID)
+				if err != nil {
+					return nil, fmt.Errorf("lineage report: shadow balance %s: %w", p.ShadowBalanceID, err)
+				}
+				entry.ShadowBalance = cloneBigInt(shadow.Balance)
+			}
+			report.Entries = append(report.Entries, entry)
+
+			key := p.Provider + "|" + b.Currency
+			total, ok := totals[key]
+			if !ok {
+				total = &LineageProviderTotal{
+					Provider:  p.Provider,
+					Currency:  b.Currency,
+					Amount:    big.NewInt(0),
+					Available: big.NewInt(0),
+					Spent:     big.NewInt(0),
+				}
+				totals[key] = total
+			}
+			total.Balances++
+			total.Amount.Add(total.Amount, entry.Amount)
+			total.Available.Add(total.Available, entry.Available)
+			total.Spent.Add(total.Spent, entry.Spent)
+		}
+	}
+	for _, key := range sortedKeys(totals) {
+		report.Providers = append(report.Providers, *totals[key])
+	}
+	return report, nil
+}
+
+func (s *LedgerBalanceService) lineageBalances(options LineageReportOptions) ([]LedgerBalance, error) {
+	scope := append([]Filter(nil), options.Filters...)
+	if options.LedgerID != "" {
+		scope = append(scope, Filter{Field: "ledger_id", Operator: OpEqual, Value: options.LedgerID})
+	}
+	if options.IdentityID != "" {
+		scope = append(scope, Filter{Field: "identity_id", Operator: OpEqual, Value: options.IdentityID})
+	}
+	if len(scope) == 0 {
+		scope = nil
+	}
+	return s.selectBalances(options.BalanceIDs, scope, func(b LedgerBalance) bool { return b.TrackFundLineage })
+}
+
+// WriteCSV writes one row per balance and provider.
+func (r *LineageReport) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"balance_id", "currency", "provider", "amount", "available", "spent", "shadow_balance_id", "shadow_balance"}); err != nil {
+		return err
+	}
+	for _, e := range r.Entries {
+		shadow := ""
+		if e.ShadowBalance != nil {
+			shadow = e.ShadowBalance.String()
+		}
+		if err := out.Write([]string{
+			e.BalanceID, e.Currency, e.Provider, e.Amount.String(), e.Available.String(), e.Spent.String(), e.ShadowBalanceID, shadow,
+		}); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// WriteProvidersCSV writes one row per provider and currency, largest
+// available exposure first.
+func (r *LineageReport) WriteProvidersCSV(w io.Writer) error {
+	providers := append([]LineageProviderTotal(nil), r.Providers...)
+	sort.SliceStable(providers, func(i, j int) bool { return providers[i].Available.Cmp(providers[j].Available) > 0 })
+
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"provider", "currency", "balances", "amount", "available", "spent"}); err != nil {
+		return err
+	}
+	for _, p := range providers {
+		if err := out.Write([]string{
+			p.Provider, p.Currency, strconv.Itoa(p.Balances), p.Amount.String(), p.Available.String(), p.Spent.String(),
+		}); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
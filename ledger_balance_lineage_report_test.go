@@ -0,0 +1,87 @@
+package blnkgo_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedgerBalanceService_LineageReport(t *testing.T) {
+	mockClient, svc := setupLedgerBalanceService()
+
+	var params blnkgo.FilterParams
+	mockClient.On("NewRequest", "balances/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		params = args.Get(2).(blnkgo.FilterParams)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		data := []interface{}{
+			map[string]interface{}{"balance_id": "bln_a", "currency": "USD", "track_fund_lineage": true},
+			map[string]interface{}{"balance_id": "bln_untracked", "currency": "USD"},
+		}
+		if params.Filters[0].Field == "balance_id" {
+			data = []interface{}{map[string]interface{}{"balance_id": "bln_b", "currency": "USD"}}
+		}
+		args.Get(1).(*blnkgo.FilterResponse).Data = data
+	})
+
+	var path string
+	mockClient.On("NewRequest", mock.MatchedBy(func(p string) bool { return strings.HasPrefix(p, "balances/bln_") }), http.MethodGet, nil).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		path = args.String(0)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.BalanceLineage")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		lineage := args.Get(1).(*blnkgo.BalanceLineage)
+		lineage.Providers = []blnkgo.LineageProviderBreakdown{
+			{Provider: "stripe", Amount: big.NewInt(10000), Available: big.NewInt(7500), Spent: big.NewInt(2500), ShadowBalanceID: "bln_shadow_stripe"},
+		}
+		if path == "balances/bln_a/lineage" {
+			lineage.Providers = append(lineage.Providers, blnkgo.LineageProviderBreakdown{
+				Provider: "paystack", Amount: big.NewInt(4000), Available: big.NewInt(4000), Spent: big.NewInt(0),
+			})
+		}
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.LedgerBalance).Balance = big.NewInt(-10000)
+	})
+
+	report, err := svc.LineageReport(blnkgo.LineageReportOptions{
+		BalanceIDs:           []string{"bln_b"},
+		LedgerID:             "ldg_wallets",
+		FollowShadowBalances: true,
+	})
+	require.NoError(t, err)
+	require.Len(t, report.Entries, 3)
+	assert.Equal(t, "bln_b", report.Entries[0].BalanceID)
+	assert.Equal(t, "-10000", report.Entries[0].ShadowBalance.String())
+	assert.Nil(t, report.Entries[2].ShadowBalance)
+
+	require.Len(t, report.Providers, 2)
+	paystack, stripe := report.Providers[0], report.Providers[1]
+	assert.Equal(t, "paystack", paystack.Provider)
+	assert.Equal(t, 2, stripe.Balances)
+	assert.Equal(t, "15000", stripe.Available.String())
+	assert.Equal(t, "5000", stripe.Spent.String())
+
+	var out bytes.Buffer
+	require.NoError(t, report.WriteProvidersCSV(&out))
+	rows, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, []string{"stripe", "USD", "2", "20000", "15000", "5000"}, rows[1])
+
+	out.Reset()
+	require.NoError(t, report.WriteCSV(&out))
+	rows, err = csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, rows, 4)
+
+	_, err = svc.LineageReport(blnkgo.LineageReportOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,250 @@
+package blnkgo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const defaultSeriesConcurrency = 4
+
+// maxSeriesPoints caps the samples per balance in one request.
+const maxSeriesPoints = 10000
+
+// BalanceSeriesRequest samples balances from From to To (inclusive) every
+// Interval, or at every local midnight when Daily is set.
+type BalanceSeriesRequest struct {
+	BalanceIDs []string
+	From       time.Time
+	To         time.Time
+	Interval   time.Duration
+	// Daily samples at midnight in Location, so each point is the balance at
+	// the end of the previous local day. Days are stepped on the calendar, so
+	// daylight saving changes are handled.
+	Daily bool
+	// Location is used for Daily sampling and for the returned times. Nil uses UTC.
+	Location   *time.Location
+	FromSource bool
+	// Concurrency bounds parallel GetHistorical calls. Zero uses 4.
+	Concurrency int
+	// Cache, when set, is consulted before calling Core and filled with
+	// samples taken in the past.
+	Cache BalanceSeriesCache
+}
+
+// BalancePoint is a balance at one instant, in minor units.
+type BalancePoint struct {
+	At            time.Time `json:"at"`
+	Balance       *big.Int  `json:"balance"`
+	CreditBalance *big.Int  `json:"credit_balance"`
+	DebitBalance  *big.Int  `json:"debit_balance"`
+}
+
+// BalanceSeries is the samples of one balance in time order.
+type BalanceSeries struct {
+	BalanceID string         `json:"balance_id"`
+	Currency  string         `json:"currency"`
+	Points    []BalancePoint `json:"points"`
+}
+
+// Average returns the mean of the sampled balances. For daily samples it is
+// the average daily balance.
+func (s BalanceSeries) Average() *big.Rat {
+	if len(s.Points) == 0 {
+		return new(big.Rat)
+	}
+	sum := big.NewInt(0)
+	for _, p := range s.Points {
+		sum.Add(sum, cloneBigInt(p.Balance))
+	}
+	return new(big.Rat).SetFrac(sum, big.NewInt(int64(len(s.Points))))
+}
+
+// Min returns the lowest sampled balance, or nil for an empty series.
+func (s BalanceSeries) Min() *big.Int {
+	var lowest *big.Int
+	for _, p := range s.Points {
+		if b := cloneBigInt(p.Balance); lowest == nil || b.Cmp(lowest) < 0 {
+			lowest = b
+		}
+	}
+	return lowest
+}
+
+// BalanceSeriesCache stores historical samples between requests.
+type BalanceSeriesCache interface {
+	Get(balanceID string, at time.Time, fromSource bool) (*LedgerBalanceHistorical, bool)
+	Set(balanceID string, at time.Time, fromSource bool, value *LedgerBalanceHistorical)
+}
+
+// MemoryBalanceSeriesCache is an unbounded in-memory BalanceSeriesCache.
+type MemoryBalanceSeriesCache struct {
+	values map[string]*LedgerBalanceHistorical
+	mu     sync.RWMutex
+}
+
+func NewMemoryBalanceSeriesCache() *MemoryBalanceSeriesCache {
+	return &MemoryBalanceSeriesCache{values: make(map[string]*LedgerBalanceHistorical)}
+}
+
+func seriesCacheKey(balanceID string, at time.Time, fromSource bool) string {
+	return fmt.Sprintf("%s|%d|%t", balanceID, at.UnixNano(), fromSource)
+}
+
+func (c *MemoryBalanceSeriesCache) Get(balanceID string, at time.Time, fromSource bool) (*LedgerBalanceHistorical, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.values[seriesCacheKey(balanceID, at, fromSource)]
+	return v, ok
+}
+
+func (c *MemoryBalanceSeriesCache) Set(balanceID string, at time.Time, fromSource bool, value *LedgerBalanceHistorical) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[seriesCacheKey(balanceID, at, fromSource)] = value
+}
+
+// ValidateBalanceSeriesRequest checks the balances, range and step.
+func ValidateBalanceSeriesRequest(r BalanceSeriesRequest) error {
+	if len(r.BalanceIDs) == 0 {
+		return errors.New("validation error: at least one balance id is required")
+	}
+	for i, id := range r.BalanceIDs {
+		if id == "" {
+			return fmt.Errorf("validation error: balance id at index %d is empty", i)
+		}
+	}
+	if r.From.IsZero() || r.To.Before(r.From) {
+		return errors.New("validation error: series start must not be after its end")
+	}
+	if !r.Daily && r.Interval <= 0 {
+		return errors.New("validation error: interval must be positive unless daily sampling is used")
+	}
+	if r.Concurrency < 0 {
+		return errors.New("validation error: concurrency must be non-negative")
+	}
+	return nil
+}
+
+// SeriesTimes returns the sample times of r.
+func SeriesTimes(r BalanceSeriesRequest) ([]time.Time, error) {
+	if err := ValidateBalanceSeriesRequest(r); err != nil {
+		return nil, err
+	}
+	loc := r.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	var times []time.Time
+	if r.Daily {
+		from := r.From.In(loc)
+		day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+		if day.Before(from) {
+			day = day.AddDate(0, 0, 1)
+		}
+		for ; !day.After(r.To); day = day.AddDate(0, 0, 1) {
+			times = append(times, day)
+			if len(times) > maxSeriesPoints {
+				break
+			}
+		}
+	} else {
+		for at := r.From.In(loc); !at.After(r.To); at = at.Add(r.Interval) {
+			times = append(times, at)
+			if len(times) > maxSeriesPoints {
+				break
+			}
+		}
+	}
+	if len(times) > maxSeriesPoints {
+		return nil, fmt.Errorf("validation error: series exceeds %d points per balance", maxSeriesPoints)
+	}
+	return times, nil
+}
+
+// Series samples each balance with GetHistorical at every time in the request,
+// running at most Concurrency calls at once. Series are returned in the order
+// of BalanceIDs.
+func (s *LedgerBalanceService) Series(r BalanceSeriesRequest) ([]BalanceSeries, error) {
+	times, err := SeriesTimes(r)
+	if err != nil {
+		return nil, err
+	}
+	concurrency := r.Concurrency
+	if concurrency == 0 {
+		concurrency = defaultSeriesConcurrency
+	}
+
+	series := make([]BalanceSeries, len(r.BalanceIDs))
+	samples := make([][]*LedgerBalanceHistorical, len(r.BalanceIDs))
+	for i, id := range r.BalanceIDs {
+		series[i] = BalanceSeries{BalanceID: id, Points: make([]BalancePoint, len(times))}
+		samples[i] = make([]*LedgerBalanceHistorical, len(times))
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		slots    = make(chan struct{}, concurrency)
+		now      = time.Now()
+	)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+	for i, id := range r.BalanceIDs {
+		for j, at := range times {
+			if r.Cache != nil {
+				if cached, ok := r.Cache.Get(id, at, r.FromSource); ok {
+					samples[i][j] = cached
+					continue
+				}
+			}
+			if failed() {
+				break
+			}
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(i, j int, id string, at time.Time) {
+				defer func() { <-slots; wg.Done() }()
+				historical, _, err := s.GetHistorical(id, at, r.FromSource)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("balance series: %s at %s: %w", id, at.Format(time.RFC3339), err)
+					}
+					mu.Unlock()
+					return
+				}
+				samples[i][j] = historical
+				if r.Cache != nil && at.Before(now) {
+					r.Cache.Set(id, at, r.FromSource, historical)
+				}
+			}(i, j, id, at)
+		}
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	for i := range series {
+		for j, at := range times {
+			h := samples[i][j]
+			if series[i].Currency == "" {
+				series[i].Currency = h.Balance.Currency
+			}
+			series[i].Points[j] = BalancePoint{
+				At:            at,
+				Balance:       cloneBigInt(h.Balance.Balance),
+				CreditBalance: cloneBigInt(h.Balance.CreditBalance),
+				DebitBalance:  cloneBigInt(h.Balance.DebitBalance),
+			}
+		}
+	}
+	return series, nil
+}
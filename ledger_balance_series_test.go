@@ -0,0 +1,106 @@
+package blnkgo_test
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockSeries answers GetHistorical for every sample time with value(id, at).
+// Each path gets its own request so concurrent calls can be told apart.
+func mockSeries(t *testing.T, mockClient *MockClient, r blnkgo.BalanceSeriesRequest, value func(id string, at time.Time) int64) {
+	times, err := blnkgo.SeriesTimes(r)
+	require.NoError(t, err)
+	values := map[string]int64{}
+	for _, id := range r.BalanceIDs {
+		for _, at := range times {
+			path := fmt.Sprintf("balances/%s/at?timestamp=%s", id, at.Format(time.RFC3339))
+			u, err := url.Parse(path)
+			require.NoError(t, err)
+			values[u.String()] = value(id, at)
+			mockClient.On("NewRequest", path, http.MethodGet, nil).Return(&http.Request{URL: u}, nil)
+		}
+	}
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalanceHistorical")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		req := args.Get(0).(*http.Request)
+		h := args.Get(1).(*blnkgo.LedgerBalanceHistorical)
+		h.Balance.Currency = "USD"
+		h.Balance.Balance = big.NewInt(values[req.URL.String()])
+	})
+}
+
+func TestSeriesTimes_DailyAcrossDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	times, err := blnkgo.SeriesTimes(blnkgo.BalanceSeriesRequest{
+		BalanceIDs: []string{"bln_a"},
+		From:       time.Date(2024, 3, 9, 12, 0, 0, 0, ny),
+		To:         time.Date(2024, 3, 12, 0, 0, 0, 0, ny),
+		Daily:      true,
+		Location:   ny,
+	})
+	require.NoError(t, err)
+	require.Len(t, times, 3)
+	for _, at := range times {
+		assert.Equal(t, 0, at.Hour())
+	}
+	assert.Equal(t, 23*time.Hour, times[1].Sub(times[0]))
+
+	_, err = blnkgo.SeriesTimes(blnkgo.BalanceSeriesRequest{BalanceIDs: []string{"bln_a"}, From: time.Now(), To: time.Now()})
+	assert.Error(t, err)
+}
+
+func TestLedgerBalanceService_Series(t *testing.T) {
+	mockClient, svc := setupLedgerBalanceService()
+	cache := blnkgo.NewMemoryBalanceSeriesCache()
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	request := blnkgo.BalanceSeriesRequest{
+		BalanceIDs:  []string{"bln_a", "bln_b"},
+		From:        from,
+		To:          from.Add(3 * time.Hour),
+		Interval:    time.Hour,
+		Concurrency: 3,
+		Cache:       cache,
+	}
+	mockSeries(t, mockClient, request, func(id string, at time.Time) int64 {
+		hours := int64(at.Sub(from) / time.Hour)
+		if id == "bln_b" {
+			return -hours
+		}
+		return 100 * (hours + 1)
+	})
+
+	series, err := svc.Series(request)
+	require.NoError(t, err)
+	require.Len(t, series, 2)
+	assert.Equal(t, "bln_a", series[0].BalanceID)
+	assert.Equal(t, "USD", series[0].Currency)
+	require.Len(t, series[0].Points, 4)
+	assert.Equal(t, "400", series[0].Points[3].Balance.String())
+	assert.Equal(t, "250", series[0].Average().RatString())
+	assert.Equal(t, "-3", series[1].Min().String())
+	mockClient.AssertNumberOfCalls(t, "CallWithRetry", 8)
+
+	_, err = svc.Series(request)
+	require.NoError(t, err)
+	mockClient.AssertNumberOfCalls(t, "CallWithRetry", 8)
+}
+
+func TestLedgerBalanceService_Series_Error(t *testing.T) {
+	mockClient, svc := setupLedgerBalanceService()
+	mockClient.On("NewRequest", mock.Anything, http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.Anything).Return(nil, errors.New("core unavailable"))
+
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	_, err := svc.Series(blnkgo.BalanceSeriesRequest{BalanceIDs: []string{"bln_a"}, From: from, To: from.AddDate(0, 0, 5), Daily: true})
+	assert.ErrorContains(t, err, "core unavailable")
+}
@@ -0,0 +1,201 @@
+package blnkgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWatchMinInterval = time.Second
+	defaultWatchMaxInterval = 30 * time.Second
+)
+
+// BalanceChangeEvent reports a balance that changed between two polls. Old is
+// nil for the first observation when EmitInitial is set.
+type BalanceChangeEvent struct {
+	BalanceID     string         `json:"balance_id"`
+	Old           *LedgerBalance `json:"old,omitempty"`
+	New           *LedgerBalance `json:"new"`
+	BalanceDelta  *big.Int       `json:"balance_delta"`
+	InflightDelta *big.Int       `json:"inflight_delta"`
+	VersionDelta  int64          `json:"version_delta"`
+	ObservedAt    time.Time      `json:"observed_at"`
+}
+
+// BalanceWatchOptions configures a BalanceWatcher. Set BalanceIDs, Filters, or
+// both; balances matching either are watched.
+type BalanceWatchOptions struct {
+	BalanceIDs []string
+	Filters    []Filter
+	// MinInterval is the delay after a poll that saw changes; each quiet or
+	// failed poll doubles the delay up to MaxInterval. Zero values use 1s and 30s.
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// EmitInitial emits an event for every balance on the first poll.
+	EmitInitial bool
+	Logger      Logger
+}
+
+// BalanceWatcher polls balances and emits an event whenever one changes.
+type BalanceWatcher struct {
+	balances *LedgerBalanceService
+	options  BalanceWatchOptions
+	last     map[string]LedgerBalance
+	polled   bool
+	mu       sync.Mutex
+}
+
+func NewBalanceWatcher(balances *LedgerBalanceService, options BalanceWatchOptions) (*BalanceWatcher, error) {
+	if err := ValidateBalanceWatchOptions(options); err != nil {
+		return nil, err
+	}
+	if options.MinInterval == 0 {
+		options.MinInterval = defaultWatchMinInterval
+	}
+	if options.MaxInterval == 0 {
+		options.MaxInterval = defaultWatchMaxInterval
+	}
+	if options.MaxInterval < options.MinInterval {
+		options.MaxInterval = options.MinInterval
+	}
+	if options.Logger == nil {
+		options.Logger = NewDefaultLogger()
+	}
+	return &BalanceWatcher{balances: balances, options: options, last: make(map[string]LedgerBalance)}, nil
+}
+
+// ValidateBalanceWatchOptions checks there is something to watch.
+func ValidateBalanceWatchOptions(options BalanceWatchOptions) error {
+	if len(options.BalanceIDs) == 0 && len(options.Filters) == 0 {
+		return errors.New("validation error: balance ids or filters are required")
+	}
+	for i, id := range options.BalanceIDs {
+		if id == "" {
+			return fmt.Errorf("validation error: balance id at index %d is empty", i)
+		}
+	}
+	if options.MinInterval < 0 || options.MaxInterval < 0 {
+		return errors.New("validation error: watch intervals must be non-negative")
+	}
+	return nil
+}
+
+// Poll fetches the watched balances once and returns the ones that changed
+// since the previous poll. The first poll only records a baseline unless
+// EmitInitial is set.
+func (w *BalanceWatcher) Poll() ([]BalanceChangeEvent, error) {
+	current, err := w.fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	var events []BalanceChangeEvent
+	for i := range current {
+		b := current[i]
+		old, seen := w.last[b.BalanceID]
+		w.last[b.BalanceID] = b
+		switch {
+		case !seen && (w.polled || w.options.EmitInitial):
+			events = append(events, balanceChange(nil, &current[i], now))
+		case seen && balanceChanged(old, b):
+			events = append(events, balanceChange(&old, &current[i], now))
+		}
+	}
+	w.polled = true
+	return events, nil
+}
+
+// fetch reads the watched balances with one paged Filter call per poll rather
+// than one Get per balance.
+func (w *BalanceWatcher) fetch() ([]LedgerBalance, error) {
+	var scope []Filter
+	if len(w.options.Filters) > 0 {
+		scope = w.options.Filters
+	}
+	return w.balances.selectBalances(w.options.BalanceIDs, scope, nil)
+}
+
+// Watch polls until ctx is cancelled and delivers events on the returned
+// channel, which is closed when watching stops.
+func (w *BalanceWatcher) Watch(ctx context.Context) <-chan BalanceChangeEvent {
+	events := make(chan BalanceChangeEvent)
+	go func() {
+		defer close(events)
+		_ = w.Run(ctx, func(e BalanceChangeEvent) {
+			select {
+			case events <- e:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return events
+}
+
+// Run polls until ctx is cancelled, calling onChange for every event. Failed
+// polls are logged and retried with backoff.
+func (w *BalanceWatcher) Run(ctx context.Context, onChange func(BalanceChangeEvent)) error {
+	interval := w.options.MinInterval
+	for {
+		events, err := w.Poll()
+		if err != nil {
+			w.options.Logger.Error(fmt.Sprintf("balance watcher: %v", err))
+		}
+		for _, e := range events {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			onChange(e)
+		}
+		interval = w.nextInterval(interval, err == nil && len(events) > 0)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (w *BalanceWatcher) nextInterval(current time.Duration, changed bool) time.Duration {
+	if changed {
+		return w.options.MinInterval
+	}
+	next := current * 2
+	if next > w.options.MaxInterval {
+		next = w.options.MaxInterval
+	}
+	return next
+}
+
+func balanceChanged(prev, next LedgerBalance) bool {
+	return prev.Version != next.Version ||
+		cloneBigInt(prev.Balance).Cmp(cloneBigInt(next.Balance)) != 0 ||
+		cloneBigInt(prev.InflightBalance).Cmp(cloneBigInt(next.InflightBalance)) != 0
+}
+
+func balanceChange(prev, next *LedgerBalance, at time.Time) BalanceChangeEvent {
+	event := BalanceChangeEvent{
+		BalanceID:     next.BalanceID,
+		Old:           prev,
+		New:           next,
+		BalanceDelta:  cloneBigInt(next.Balance),
+		InflightDelta: cloneBigInt(next.InflightBalance),
+		VersionDelta:  next.Version,
+		ObservedAt:    at,
+	}
+	if prev != nil {
+		event.BalanceDelta.Sub(event.BalanceDelta, cloneBigInt(prev.Balance))
+		event.InflightDelta.Sub(event.InflightDelta, cloneBigInt(prev.InflightBalance))
+		event.VersionDelta -= prev.Version
+	}
+	return event
+}
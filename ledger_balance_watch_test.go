@@ -0,0 +1,105 @@
+package blnkgo_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockBalancePolls serves successive balance pages from polls, repeating the
+// last one once they run out.
+func mockBalancePolls(mockClient *MockClient, polls ...[]interface{}) *[]blnkgo.FilterParams {
+	var (
+		mu   sync.Mutex
+		sent []blnkgo.FilterParams
+		call int
+	)
+	mockClient.On("NewRequest", "balances/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, args.Get(2).(blnkgo.FilterParams))
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		mu.Lock()
+		defer mu.Unlock()
+		page := polls[len(polls)-1]
+		if call < len(polls) {
+			page = polls[call]
+		}
+		call++
+		args.Get(1).(*blnkgo.FilterResponse).Data = page
+	})
+	return &sent
+}
+
+func watchedBalance(id string, balance, inflight, version int64) map[string]interface{} {
+	return map[string]interface{}{"balance_id": id, "balance": balance, "inflight_balance": inflight, "version": version}
+}
+
+func TestBalanceWatcher_Poll(t *testing.T) {
+	mockClient := &MockClient{}
+	sent := mockBalancePolls(mockClient,
+		[]interface{}{watchedBalance("bln_a", 1000, 0, 1), watchedBalance("bln_b", 500, 0, 1)},
+		[]interface{}{watchedBalance("bln_a", 1000, 0, 1), watchedBalance("bln_b", 300, -200, 3)},
+	)
+	watcher, err := blnkgo.NewBalanceWatcher(blnkgo.NewLedgerBalanceService(mockClient), blnkgo.BalanceWatchOptions{
+		BalanceIDs: []string{"bln_a", "bln_b"},
+	})
+	require.NoError(t, err)
+
+	events, err := watcher.Poll()
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	require.Len(t, *sent, 1)
+	assert.Equal(t, blnkgo.OpIn, (*sent)[0].Filters[0].Operator)
+
+	events, err = watcher.Poll()
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "bln_b", events[0].BalanceID)
+	assert.Equal(t, "-200", events[0].BalanceDelta.String())
+	assert.Equal(t, "-200", events[0].InflightDelta.String())
+	assert.Equal(t, int64(2), events[0].VersionDelta)
+	assert.Equal(t, "500", events[0].Old.Balance.String())
+
+	_, err = blnkgo.NewBalanceWatcher(blnkgo.NewLedgerBalanceService(mockClient), blnkgo.BalanceWatchOptions{})
+	assert.Error(t, err)
+}
+
+func TestBalanceWatcher_Watch(t *testing.T) {
+	mockClient := &MockClient{}
+	mockBalancePolls(mockClient,
+		[]interface{}{watchedBalance("bln_a", 1000, 0, 1)},
+		[]interface{}{watchedBalance("bln_a", 1500, 0, 2)},
+	)
+	watcher, err := blnkgo.NewBalanceWatcher(blnkgo.NewLedgerBalanceService(mockClient), blnkgo.BalanceWatchOptions{
+		Filters:     []blnkgo.Filter{{Field: "ledger_id", Operator: blnkgo.OpEqual, Value: "ldg_wallets"}},
+		MinInterval: time.Millisecond,
+		MaxInterval: 5 * time.Millisecond,
+		EmitInitial: true,
+		Logger:      silentLogger{},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := watcher.Watch(ctx)
+
+	initial := <-events
+	assert.Nil(t, initial.Old)
+	assert.Equal(t, "1000", initial.BalanceDelta.String())
+
+	change := <-events
+	assert.Equal(t, "500", change.BalanceDelta.String())
+	assert.Equal(t, int64(1), change.VersionDelta)
+
+	cancel()
+	for range events {
+	}
+}
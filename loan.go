@@ -0,0 +1,526 @@
+package blnkgo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata keys recording loan postings.
+const (
+	LoanIDMetaKey        = "loan_id"
+	LoanEventMetaKey     = "loan_event"
+	LoanPrincipalMetaKey = "loan_principal"
+	LoanInterestMetaKey  = "loan_interest"
+	LoanFeeMetaKey       = "loan_fee"
+)
+
+// Loan events recorded under LoanEventMetaKey.
+const (
+	LoanEventDisbursement = "disbursement"
+	LoanEventRepayment    = "repayment"
+)
+
+// AmortizationMethod determines how principal is repaid.
+type AmortizationMethod string
+
+const (
+	// AmortizationAnnuity repays with equal installments of principal and interest.
+	AmortizationAnnuity AmortizationMethod = "annuity"
+	// AmortizationStraightLine repays equal principal plus interest on the
+	// outstanding balance.
+	AmortizationStraightLine AmortizationMethod = "straight_line"
+	// AmortizationInterestOnly pays interest only and all principal at the end.
+	AmortizationInterestOnly AmortizationMethod = "interest_only"
+	// AmortizationBalloon pays equal installments with BalloonAmount of
+	// principal left for the final installment.
+	AmortizationBalloon AmortizationMethod = "balloon"
+)
+
+// LoanTerms describes a loan. Amounts are in minor units and AnnualRate is a
+// percent (12 means 12%). Installments fall every IntervalMonths (default 1)
+// from FirstDue.
+type LoanTerms struct {
+	ID             string
+	Currency       string
+	Precision      int64
+	Principal      *big.Int
+	AnnualRate     float64
+	Installments   int
+	IntervalMonths int
+	FirstDue       time.Time
+	Method         AmortizationMethod
+	BalloonAmount  *big.Int
+	// Fee is charged with every installment.
+	Fee      *big.Int
+	Rounding RoundingMode
+}
+
+// LoanInstallment is one scheduled payment. Remaining is the principal still
+// outstanding after it.
+type LoanInstallment struct {
+	Number    int       `json:"number"`
+	DueDate   time.Time `json:"due_date"`
+	Principal *big.Int  `json:"principal"`
+	Interest  *big.Int  `json:"interest"`
+	Fee       *big.Int  `json:"fee"`
+	Total     *big.Int  `json:"total"`
+	Remaining *big.Int  `json:"remaining"`
+}
+
+// LoanSchedule is the amortization schedule of a loan.
+type LoanSchedule struct {
+	Terms         LoanTerms         `json:"terms"`
+	Installments  []LoanInstallment `json:"installments"`
+	TotalInterest *big.Int          `json:"total_interest"`
+	TotalFees     *big.Int          `json:"total_fees"`
+	TotalPayable  *big.Int          `json:"total_payable"`
+}
+
+// ValidateLoanTerms checks the loan amount, rate, term and method.
+func ValidateLoanTerms(t LoanTerms) error {
+	if strings.TrimSpace(t.ID) == "" {
+		return errors.New("validation error: loan id is required")
+	}
+	if t.Principal == nil || t.Principal.Sign() <= 0 {
+		return errors.New("validation error: loan principal must be positive")
+	}
+	if t.AnnualRate < 0 {
+		return errors.New("validation error: loan rate must be non-negative")
+	}
+	if t.Installments <= 0 {
+		return errors.New("validation error: loan must have at least one installment")
+	}
+	if t.IntervalMonths < 0 {
+		return errors.New("validation error: loan interval must be positive")
+	}
+	if t.FirstDue.IsZero() {
+		return errors.New("validation error: first due date is required")
+	}
+	if isNegative(t.Fee) {
+		return errors.New("validation error: loan fee must be non-negative")
+	}
+	switch t.Method {
+	case AmortizationAnnuity, AmortizationStraightLine, AmortizationInterestOnly:
+	case AmortizationBalloon:
+		if t.BalloonAmount == nil || t.BalloonAmount.Sign() <= 0 || t.BalloonAmount.Cmp(t.Principal) > 0 {
+			return errors.New("validation error: balloon amount must be positive and at most the principal")
+		}
+	default:
+		return fmt.Errorf("validation error: invalid amortization method: %s", t.Method)
+	}
+	return nil
+}
+
+// BuildLoanSchedule generates the amortization schedule. Interest for each
+// period is the outstanding principal times the periodic rate, rounded with
+// Rounding; the final installment absorbs any rounding difference.
+func BuildLoanSchedule(t LoanTerms) (*LoanSchedule, error) {
+	if err := ValidateLoanTerms(t); err != nil {
+		return nil, err
+	}
+	if t.IntervalMonths == 0 {
+		t.IntervalMonths = 1
+	}
+	annual, ok := new(big.Rat).SetString(strconv.FormatFloat(t.AnnualRate, 'f', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("invalid loan rate: %v", t.AnnualRate)
+	}
+	rate := annual.Mul(annual, big.NewRat(int64(t.IntervalMonths), 1200))
+
+	n := t.Installments
+	fee := cloneBigInt(t.Fee)
+	var payment *big.Int
+	switch t.Method {
+	case AmortizationAnnuity:
+		payment = t.Rounding.Round(annuityPayment(new(big.Rat).SetInt(t.Principal), rate, n))
+	case AmortizationBalloon:
+		// Discount the balloon to today and amortize the rest.
+		growth := ratPow(new(big.Rat).Add(big.NewRat(1, 1), rate), n)
+		pv := new(big.Rat).Quo(new(big.Rat).SetInt(t.BalloonAmount), growth)
+		payment = t.Rounding.Round(annuityPayment(new(big.Rat).Sub(new(big.Rat).SetInt(t.Principal), pv), rate, n))
+	}
+
+	schedule := &LoanSchedule{Terms: t, TotalInterest: big.NewInt(0), TotalFees: big.NewInt(0), TotalPayable: big.NewInt(0)}
+	remaining := new(big.Int).Set(t.Principal)
+	straight := new(big.Int).Quo(t.Principal, big.NewInt(int64(n)))
+
+	for i := 1; i <= n; i++ {
+		interestRat := new(big.Rat).Mul(new(big.Rat).SetInt(remaining), rate)
+		interest := t.Rounding.Round(interestRat)
+
+		var principal *big.Int
+		switch {
+		case i == n:
+			principal = new(big.Int).Set(remaining)
+		case t.Method == AmortizationStraightLine:
+			principal = new(big.Int).Set(straight)
+		case t.Method == AmortizationInterestOnly:
+			principal = big.NewInt(0)
+		default:
+			principal = new(big.Int).Sub(payment, interest)
+			if principal.Sign() < 0 {
+				principal.SetInt64(0)
+			}
+			if principal.Cmp(remaining) > 0 {
+				principal.Set(remaining)
+			}
+		}
+		remaining.Sub(remaining, principal)
+
+		total := new(big.Int).Add(principal, interest)
+		total.Add(total, fee)
+		schedule.Installments = append(schedule.Installments, LoanInstallment{
+			Number:    i,
+			DueDate:   t.FirstDue.AddDate(0, (i-1)*t.IntervalMonths, 0),
+			Principal: principal,
+			Interest:  interest,
+			Fee:       new(big.Int).Set(fee),
+			Total:     total,
+			Remaining: new(big.Int).Set(remaining),
+		})
+		schedule.TotalInterest.Add(schedule.TotalInterest, interest)
+		schedule.TotalFees.Add(schedule.TotalFees, fee)
+		schedule.TotalPayable.Add(schedule.TotalPayable, total)
+	}
+	return schedule, nil
+}
+
+// annuityPayment returns p * r / (1 - (1+r)^-n), or p / n when r is zero.
+func annuityPayment(p, r *big.Rat, n int) *big.Rat {
+	if r.Sign() == 0 {
+		return new(big.Rat).Quo(p, big.NewRat(int64(n), 1))
+	}
+	growth := ratPow(new(big.Rat).Add(big.NewRat(1, 1), r), n)
+	discount := new(big.Rat).Sub(big.NewRat(1, 1), new(big.Rat).Inv(growth))
+	payment := new(big.Rat).Mul(p, r)
+	return payment.Quo(payment, discount)
+}
+
+func ratPow(x *big.Rat, n int) *big.Rat {
+	out := big.NewRat(1, 1)
+	for i := 0; i < n; i++ {
+		out.Mul(out, x)
+	}
+	return out
+}
+
+// LoanAccounts are the balances a loan posts to. Principal carries the
+// outstanding loan (it goes negative on disbursement), Interest and Fee
+// receive those parts of repayments, and Borrower is the borrower's wallet.
+type LoanAccounts struct {
+	Borrower  string
+	Principal string
+	Interest  string
+	Fee       string
+}
+
+// LoanAllocation splits a repayment into its components.
+type LoanAllocation struct {
+	Principal *big.Int `json:"principal"`
+	Interest  *big.Int `json:"interest"`
+	Fee       *big.Int `json:"fee"`
+}
+
+// Total returns the sum of the components.
+func (a LoanAllocation) Total() *big.Int {
+	total := new(big.Int).Add(cloneBigInt(a.Principal), cloneBigInt(a.Interest))
+	return total.Add(total, cloneBigInt(a.Fee))
+}
+
+// LoanRepayments sums a loan's repayments recorded in Core. Paid counts
+// settled repayments only; Pending holds repayments that are still queued or
+// inflight. Rejected, voided and expired repayments are ignored.
+type LoanRepayments struct {
+	Paid    LoanAllocation `json:"paid"`
+	Pending LoanAllocation `json:"pending"`
+}
+
+// Committed returns Paid plus Pending, the part of the loan a new repayment
+// must not be allocated to again.
+func (r LoanRepayments) Committed() LoanAllocation {
+	return LoanAllocation{
+		Principal: new(big.Int).Add(cloneBigInt(r.Paid.Principal), cloneBigInt(r.Pending.Principal)),
+		Interest:  new(big.Int).Add(cloneBigInt(r.Paid.Interest), cloneBigInt(r.Pending.Interest)),
+		Fee:       new(big.Int).Add(cloneBigInt(r.Paid.Fee), cloneBigInt(r.Pending.Fee)),
+	}
+}
+
+// LoanArrearsInstallment is the unpaid part of an installment that is due.
+type LoanArrearsInstallment struct {
+	Number      int            `json:"number"`
+	DueDate     time.Time      `json:"due_date"`
+	DaysPastDue int            `json:"days_past_due"`
+	Outstanding LoanAllocation `json:"outstanding"`
+}
+
+// LoanArrears compares what was due by AsOf with what was repaid.
+type LoanArrears struct {
+	LoanID       string                   `json:"loan_id"`
+	AsOf         time.Time                `json:"as_of"`
+	Due          LoanAllocation           `json:"due"`
+	Paid         LoanAllocation           `json:"paid"`
+	Overdue      LoanAllocation           `json:"overdue"`
+	DaysPastDue  int                      `json:"days_past_due"`
+	Installments []LoanArrearsInstallment `json:"installments"`
+}
+
+// InArrears reports whether any due amount is unpaid.
+func (a *LoanArrears) InArrears() bool {
+	return a.Overdue.Total().Sign() > 0
+}
+
+// LoanServicer posts a loan's disbursement and repayments and reports arrears.
+type LoanServicer struct {
+	transactions *TransactionService
+	schedule     *LoanSchedule
+	accounts     LoanAccounts
+}
+
+func NewLoanServicer(transactions *TransactionService, schedule *LoanSchedule, accounts LoanAccounts) (*LoanServicer, error) {
+	if schedule == nil {
+		return nil, errors.New("validation error: loan schedule is required")
+	}
+	if accounts.Borrower == "" || accounts.Principal == "" || accounts.Interest == "" {
+		return nil, errors.New("validation error: borrower, principal and interest accounts are required")
+	}
+	if schedule.TotalFees.Sign() > 0 && accounts.Fee == "" {
+		return nil, errors.New("validation error: fee account is required for loans with fees")
+	}
+	return &LoanServicer{transactions: transactions, schedule: schedule, accounts: accounts}, nil
+}
+
+// Disburse moves the principal from the principal account to the borrower.
+func (l *LoanServicer) Disburse(effective *time.Time) (*Transaction, *http.Response, error) {
+	t := l.schedule.Terms
+	return l.transactions.Create(CreateTransactionRequest{
+		ParentTransaction: ParentTransaction{
+			PreciseAmount: new(big.Int).Set(t.Principal),
+			Precision:     loanPrecision(t),
+			Reference:     t.ID + "_disbursement",
+			Description:   fmt.Sprintf("Disbursement of loan %s", t.ID),
+			Currency:      t.Currency,
+			Source:        l.accounts.Principal,
+			Destination:   l.accounts.Borrower,
+			EffectiveDate: effective,
+			MetaData:      MetaData{LoanIDMetaKey: t.ID, LoanEventMetaKey: LoanEventDisbursement},
+		},
+		AllowOverdraft: true,
+	})
+}
+
+// Allocate splits amount across outstanding installments oldest first, paying
+// each installment's fee, then interest, then principal. paid is what earlier
+// repayments already covered.
+func (l *LoanServicer) Allocate(amount *big.Int, paid LoanAllocation) (LoanAllocation, error) {
+	if amount == nil || amount.Sign() <= 0 {
+		return LoanAllocation{}, errors.New("validation error: repayment amount must be positive")
+	}
+	left := new(big.Int).Set(amount)
+	out := LoanAllocation{Principal: big.NewInt(0), Interest: big.NewInt(0), Fee: big.NewInt(0)}
+	prior := LoanAllocation{Principal: cloneBigInt(paid.Principal), Interest: cloneBigInt(paid.Interest), Fee: cloneBigInt(paid.Fee)}
+
+	take := func(due, alreadyPaid, into *big.Int) {
+		owed := new(big.Int).Set(due)
+		covered := minBigInt(alreadyPaid, owed)
+		alreadyPaid.Sub(alreadyPaid, covered)
+		owed.Sub(owed, covered)
+		portion := minBigInt(left, owed)
+		into.Add(into, portion)
+		left.Sub(left, portion)
+	}
+	for _, inst := range l.schedule.Installments {
+		take(inst.Fee, prior.Fee, out.Fee)
+		take(inst.Interest, prior.Interest, out.Interest)
+		take(inst.Principal, prior.Principal, out.Principal)
+		if left.Sign() == 0 {
+			return out, nil
+		}
+	}
+	return LoanAllocation{}, fmt.Errorf("validation error: repayment exceeds the outstanding loan by %s", left)
+}
+
+// Repay allocates amount and posts it from the borrower as one transaction
+// split across the principal, interest and fee accounts. Repayments still
+// queued or inflight count as already allocated, so two repayments in
+// progress do not pay the same installment.
+func (l *LoanServicer) Repay(amount *big.Int, reference string, effective *time.Time) (*Transaction, LoanAllocation, *http.Response, error) {
+	if reference == "" {
+		return nil, LoanAllocation{}, nil, errors.New("validation error: repayment reference is required")
+	}
+	repayments, err := l.Repayments()
+	if err != nil {
+		return nil, LoanAllocation{}, nil, err
+	}
+	allocation, err := l.Allocate(amount, repayments.Committed())
+	if err != nil {
+		return nil, LoanAllocation{}, nil, err
+	}
+
+	t := l.schedule.Terms
+	var destinations []Source
+	for _, leg := range []struct {
+		account string
+		amount  *big.Int
+	}{
+		{l.accounts.Fee, allocation.Fee},
+		{l.accounts.Interest, allocation.Interest},
+		{l.accounts.Principal, allocation.Principal},
+	} {
+		if leg.amount.Sign() > 0 {
+			destinations = append(destinations, Source{Identifier: leg.account, PreciseDistribution: leg.amount.String()})
+		}
+	}
+	body := CreateTransactionRequest{
+		ParentTransaction: ParentTransaction{
+			PreciseAmount: new(big.Int).Set(amount),
+			Precision:     loanPrecision(t),
+			Reference:     reference,
+			Description:   fmt.Sprintf("Repayment of loan %s", t.ID),
+			Currency:      t.Currency,
+			Source:        l.accounts.Borrower,
+			EffectiveDate: effective,
+			MetaData: MetaData{
+				LoanIDMetaKey:        t.ID,
+				LoanEventMetaKey:     LoanEventRepayment,
+				LoanPrincipalMetaKey: allocation.Principal.String(),
+				LoanInterestMetaKey:  allocation.Interest.String(),
+				LoanFeeMetaKey:       allocation.Fee.String(),
+			},
+		},
+	}
+	if len(destinations) == 1 {
+		body.Destination = destinations[0].Identifier
+	} else {
+		body.Destinations = destinations
+	}
+	transaction, resp, err := l.transactions.Create(body)
+	return transaction, allocation, resp, err
+}
+
+// Repayments sums the allocations of the loan's repayments recorded in Core,
+// split into settled (APPLIED or COMMIT) and pending (QUEUED or INFLIGHT).
+func (l *LoanServicer) Repayments() (*LoanRepayments, error) {
+	repayments, err := filterAll[Transaction](l.transactions.Filter, FilterParams{
+		Filters: []Filter{
+			{Field: "meta_data." + LoanIDMetaKey, Operator: OpEqual, Value: l.schedule.Terms.ID},
+			{Field: "meta_data." + LoanEventMetaKey, Operator: OpEqual, Value: LoanEventRepayment},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	summary := &LoanRepayments{
+		Paid:    LoanAllocation{Principal: big.NewInt(0), Interest: big.NewInt(0), Fee: big.NewInt(0)},
+		Pending: LoanAllocation{Principal: big.NewInt(0), Interest: big.NewInt(0), Fee: big.NewInt(0)},
+	}
+	for _, txn := range repayments {
+		var into LoanAllocation
+		switch {
+		case txn.Status.IsSettled():
+			into = summary.Paid
+		case txn.Status == PryTransactionStatusQueued || txn.Status == PryTransactionStatusInFlight:
+			into = summary.Pending
+		default:
+			continue
+		}
+		for key, component := range map[string]*big.Int{
+			LoanPrincipalMetaKey: into.Principal,
+			LoanInterestMetaKey:  into.Interest,
+			LoanFeeMetaKey:       into.Fee,
+		} {
+			if v, ok := txn.MetaData[key]; ok {
+				n, ok := new(big.Int).SetString(fmt.Sprint(v), 10)
+				if !ok {
+					return nil, fmt.Errorf("invalid %s on transaction %s", key, txn.TransactionID)
+				}
+				component.Add(component, n)
+			}
+		}
+	}
+	return summary, nil
+}
+
+// Paid sums the allocations of the loan's settled (APPLIED or COMMIT)
+// repayments recorded in Core. Queued, inflight, rejected and voided
+// repayments are ignored.
+func (l *LoanServicer) Paid() (LoanAllocation, error) {
+	repayments, err := l.Repayments()
+	if err != nil {
+		return LoanAllocation{}, err
+	}
+	return repayments.Paid, nil
+}
+
+// Arrears compares installments due on or before asOf with repayments from
+// Filter and lists each installment still partly unpaid.
+func (l *LoanServicer) Arrears(asOf time.Time) (*LoanArrears, error) {
+	paid, err := l.Paid()
+	if err != nil {
+		return nil, err
+	}
+	return loanArrears(l.schedule, paid, asOf), nil
+}
+
+func loanArrears(schedule *LoanSchedule, paid LoanAllocation, asOf time.Time) *LoanArrears {
+	report := &LoanArrears{
+		LoanID:  schedule.Terms.ID,
+		AsOf:    asOf,
+		Due:     LoanAllocation{Principal: big.NewInt(0), Interest: big.NewInt(0), Fee: big.NewInt(0)},
+		Paid:    paid,
+		Overdue: LoanAllocation{Principal: big.NewInt(0), Interest: big.NewInt(0), Fee: big.NewInt(0)},
+	}
+	prior := LoanAllocation{Principal: cloneBigInt(paid.Principal), Interest: cloneBigInt(paid.Interest), Fee: cloneBigInt(paid.Fee)}
+	unpaid := func(due, alreadyPaid *big.Int) *big.Int {
+		covered := minBigInt(alreadyPaid, due)
+		alreadyPaid.Sub(alreadyPaid, covered)
+		return new(big.Int).Sub(due, covered)
+	}
+
+	for _, inst := range schedule.Installments {
+		if inst.DueDate.After(asOf) {
+			break
+		}
+		report.Due.Principal.Add(report.Due.Principal, inst.Principal)
+		report.Due.Interest.Add(report.Due.Interest, inst.Interest)
+		report.Due.Fee.Add(report.Due.Fee, inst.Fee)
+
+		outstanding := LoanAllocation{
+			Fee:       unpaid(inst.Fee, prior.Fee),
+			Interest:  unpaid(inst.Interest, prior.Interest),
+			Principal: unpaid(inst.Principal, prior.Principal),
+		}
+		if outstanding.Total().Sign() == 0 {
+			continue
+		}
+		days := int(asOf.Sub(inst.DueDate).Hours() / 24)
+		if len(report.Installments) == 0 {
+			report.DaysPastDue = days
+		}
+		report.Installments = append(report.Installments, LoanArrearsInstallment{
+			Number: inst.Number, DueDate: inst.DueDate, DaysPastDue: days, Outstanding: outstanding,
+		})
+		report.Overdue.Principal.Add(report.Overdue.Principal, outstanding.Principal)
+		report.Overdue.Interest.Add(report.Overdue.Interest, outstanding.Interest)
+		report.Overdue.Fee.Add(report.Overdue.Fee, outstanding.Fee)
+	}
+	return report
+}
+
+func loanPrecision(t LoanTerms) int64 {
+	if t.Precision == 0 {
+		return 1
+	}
+	return t.Precision
+}
+
+func minBigInt(a, b *big.Int) *big.Int {
+	if a.Cmp(b) < 0 {
+		return new(big.Int).Set(a)
+	}
+	return new(big.Int).Set(b)
+}
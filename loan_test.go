@@ -0,0 +1,166 @@
+package blnkgo_test
+
+import (
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var loanFirstDue = time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+func loanTerms(method blnkgo.AmortizationMethod) blnkgo.LoanTerms {
+	return blnkgo.LoanTerms{
+		ID:           "loan_1",
+		Currency:     "USD",
+		Precision:    100,
+		Principal:    big.NewInt(100000),
+		AnnualRate:   12,
+		Installments: 12,
+		FirstDue:     loanFirstDue,
+		Method:       method,
+	}
+}
+
+func sumPrincipal(s *blnkgo.LoanSchedule) *big.Int {
+	total := big.NewInt(0)
+	for _, inst := range s.Installments {
+		total.Add(total, inst.Principal)
+	}
+	return total
+}
+
+func TestBuildLoanSchedule(t *testing.T) {
+	annuity, err := blnkgo.BuildLoanSchedule(loanTerms(blnkgo.AmortizationAnnuity))
+	require.NoError(t, err)
+	require.Len(t, annuity.Installments, 12)
+	first := annuity.Installments[0]
+	assert.Equal(t, "1000", first.Interest.String())
+	assert.Equal(t, "8885", first.Total.String())
+	assert.Equal(t, "92115", first.Remaining.String())
+	assert.Equal(t, loanFirstDue.AddDate(0, 11, 0), annuity.Installments[11].DueDate)
+	assert.Equal(t, "0", annuity.Installments[11].Remaining.String())
+	assert.Equal(t, "100000", sumPrincipal(annuity).String())
+
+	straight := loanTerms(blnkgo.AmortizationStraightLine)
+	straight.Installments = 3
+	schedule, err := blnkgo.BuildLoanSchedule(straight)
+	require.NoError(t, err)
+	assert.Equal(t, "33333", schedule.Installments[0].Principal.String())
+	assert.Equal(t, "33334", schedule.Installments[2].Principal.String())
+	assert.Equal(t, "667", schedule.Installments[1].Interest.String())
+
+	interestOnly := loanTerms(blnkgo.AmortizationInterestOnly)
+	interestOnly.Installments = 3
+	schedule, err = blnkgo.BuildLoanSchedule(interestOnly)
+	require.NoError(t, err)
+	assert.Equal(t, "0", schedule.Installments[1].Principal.String())
+	assert.Equal(t, "100000", schedule.Installments[2].Principal.String())
+	assert.Equal(t, "3000", schedule.TotalInterest.String())
+
+	balloon := loanTerms(blnkgo.AmortizationBalloon)
+	balloon.BalloonAmount = big.NewInt(40000)
+	schedule, err = blnkgo.BuildLoanSchedule(balloon)
+	require.NoError(t, err)
+	assert.True(t, schedule.Installments[0].Total.Cmp(first.Total) < 0)
+	assert.True(t, schedule.Installments[11].Principal.Cmp(big.NewInt(40000)) >= 0)
+	assert.Equal(t, "100000", sumPrincipal(schedule).String())
+
+	balloon.BalloonAmount = nil
+	_, err = blnkgo.BuildLoanSchedule(balloon)
+	assert.Error(t, err)
+}
+
+func setupLoanServicer(t *testing.T, repayments []interface{}) (*MockClient, *blnkgo.LoanServicer) {
+	terms := loanTerms(blnkgo.AmortizationStraightLine)
+	terms.Installments = 3
+	terms.Fee = big.NewInt(100)
+	schedule, err := blnkgo.BuildLoanSchedule(terms)
+	require.NoError(t, err)
+
+	mockClient := &MockClient{}
+	servicer, err := blnkgo.NewLoanServicer(blnkgo.NewTransactionService(mockClient), schedule, blnkgo.LoanAccounts{
+		Borrower: "bln_wallet", Principal: "bln_loan_principal", Interest: "bln_loan_interest", Fee: "bln_loan_fees",
+	})
+	require.NoError(t, err)
+
+	mockClient.On("NewRequest", "transactions/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.FilterResponse).Data = repayments
+	})
+	return mockClient, servicer
+}
+
+func TestLoanServicer_Repay(t *testing.T) {
+	// First installment: fee 100, interest 1000, principal 33333.
+	mockClient, servicer := setupLoanServicer(t, []interface{}{
+		map[string]interface{}{"transaction_id": "txn_1", "status": "APPLIED", "meta_data": map[string]interface{}{
+			"loan_fee": "100", "loan_interest": "1000", "loan_principal": "10000",
+		}},
+		map[string]interface{}{"transaction_id": "txn_2", "status": "REJECTED", "meta_data": map[string]interface{}{
+			"loan_fee": "100", "loan_interest": "667", "loan_principal": "33333",
+		}},
+		map[string]interface{}{"transaction_id": "txn_3", "status": "QUEUED", "meta_data": map[string]interface{}{
+			"loan_fee": "100", "loan_interest": "667", "loan_principal": "33333",
+		}},
+	})
+	var sent blnkgo.CreateTransactionRequest
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		sent = args.Get(2).(blnkgo.CreateTransactionRequest)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusCreated}, nil)
+
+	repayments, err := servicer.Repayments()
+	require.NoError(t, err)
+	assert.Equal(t, "10000", repayments.Paid.Principal.String())
+	assert.Equal(t, "33333", repayments.Pending.Principal.String())
+	paid, err := servicer.Paid()
+	require.NoError(t, err)
+	assert.Equal(t, "10000", paid.Principal.String())
+
+	_, allocation, _, err := servicer.Repay(big.NewInt(25000), "loan_1_repayment_3", nil)
+	require.NoError(t, err)
+	// The queued txn_3 counts as allocated: it finishes installment one and
+	// pays 10000 of installment two. 23333 finishes installment two, the rest
+	// goes to installment three.
+	assert.Equal(t, "100", allocation.Fee.String())
+	assert.Equal(t, "333", allocation.Interest.String())
+	assert.Equal(t, "24567", allocation.Principal.String())
+
+	assert.Equal(t, "bln_wallet", sent.Source)
+	require.Len(t, sent.Destinations, 3)
+	assert.Equal(t, "bln_loan_principal", sent.Destinations[2].Identifier)
+	assert.Equal(t, "24567", sent.Destinations[2].PreciseDistribution)
+	assert.Equal(t, "24567", sent.MetaData[blnkgo.LoanPrincipalMetaKey])
+
+	_, _, _, err = servicer.Repay(big.NewInt(1000000), "loan_1_repayment_4", nil)
+	assert.Error(t, err)
+}
+
+func TestLoanServicer_Arrears(t *testing.T) {
+	_, servicer := setupLoanServicer(t, []interface{}{
+		map[string]interface{}{"transaction_id": "txn_1", "status": "APPLIED", "meta_data": map[string]interface{}{
+			"loan_fee": "100", "loan_interest": "1000", "loan_principal": "10000",
+		}},
+	})
+
+	arrears, err := servicer.Arrears(loanFirstDue.AddDate(0, 1, 10))
+	require.NoError(t, err)
+	assert.True(t, arrears.InArrears())
+	require.Len(t, arrears.Installments, 2)
+	assert.Equal(t, 1, arrears.Installments[0].Number)
+	assert.Equal(t, "23333", arrears.Installments[0].Outstanding.Principal.String())
+	assert.Equal(t, 39, arrears.DaysPastDue)
+	assert.Equal(t, "56666", arrears.Overdue.Principal.String())
+	assert.Equal(t, "667", arrears.Overdue.Interest.String())
+	assert.Equal(t, "100", arrears.Overdue.Fee.String())
+
+	current, err := servicer.Arrears(loanFirstDue.AddDate(0, 0, -1))
+	require.NoError(t, err)
+	assert.False(t, current.InArrears())
+}
@@ -0,0 +1,514 @@
+package blnkgo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SplitsMetaKey records the allocation of a split payment on its transaction.
+const SplitsMetaKey = "splits"
+
+// SplitRole labels who receives a share of a split payment.
+type SplitRole string
+
+const (
+	SplitRoleSeller   SplitRole = "seller"
+	SplitRolePlatform SplitRole = "platform"
+	SplitRoleTax      SplitRole = "tax"
+)
+
+// SplitRule routes part of a payment to Destination. Exactly one of Amount
+// (minor units), Percentage (2.5 means 2.5%) or Remainder must be set; at most
+// one rule may take the remainder. Seller identifies the seller in positions
+// and reports and defaults to Destination.
+type SplitRule struct {
+	Role        SplitRole
+	Seller      string
+	Destination string
+	Amount      *big.Int
+	Percentage  float64
+	Remainder   bool
+	Narration   string
+}
+
+// SplitPayment is a customer payment split across seller, platform and tax
+// balances. Amount is in minor units. When HoldSellerFunds is set the seller
+// legs are posted as a separate inflight hold, so sellers see them as pending
+// until Release; platform and tax legs settle immediately.
+type SplitPayment struct {
+	Reference       string
+	Description     string
+	Currency        string
+	Precision       int64
+	Amount          *big.Int
+	Source          string
+	Rules           []SplitRule
+	HoldSellerFunds bool
+	HoldUntil       *time.Time
+	MetaData        MetaData
+	SkipQueue       bool
+}
+
+// SplitAllocation is the amount one rule received.
+type SplitAllocation struct {
+	Role        SplitRole `json:"role"`
+	Seller      string    `json:"seller,omitempty"`
+	Destination string    `json:"destination"`
+	Amount      *big.Int  `json:"amount"`
+}
+
+// SplitPaymentPlan is a split payment resolved into the transactions that post
+// it. Without HoldSellerFunds, Payment carries every leg and Hold is nil. With
+// it, Hold carries the seller legs (reference "<reference>_hold") and Payment
+// the platform and tax legs, or is nil when there are none.
+type SplitPaymentPlan struct {
+	Payment     *CreateTransactionRequest
+	Hold        *CreateTransactionRequest
+	Allocations []SplitAllocation
+}
+
+// SplitPaymentResult is a posted split payment. Hold is the inflight seller
+// transaction to pass to Release or Cancel. BatchID is set when the hold and
+// the payment were posted together.
+type SplitPaymentResult struct {
+	Transaction *Transaction
+	Hold        *Transaction
+	BatchID     string
+	Allocations []SplitAllocation
+}
+
+// SellerPosition is a seller balance split into funds still held inflight and
+// funds available for payout, in minor units.
+type SellerPosition struct {
+	BalanceID string   `json:"balance_id"`
+	Currency  string   `json:"currency"`
+	Pending   *big.Int `json:"pending"`
+	Available *big.Int `json:"available"`
+}
+
+// Payout moves a seller's funds to Destination. A nil Amount pays out the
+// seller's full available balance.
+type Payout struct {
+	Seller      string
+	Balance     string
+	Destination string
+	Amount      *big.Int
+	Reference   string
+}
+
+// PayoutOptions configures a payout run. References default to
+// "payout_<seller>_<YYYYMMDD>" using Date, so re-running the same day is
+// rejected by Core as a duplicate rather than paying twice.
+type PayoutOptions struct {
+	Currency    string
+	Precision   int64
+	Description string
+	Date        time.Time
+	SkipQueue   bool
+}
+
+// PayoutResult reports the outcome of one seller payout. Status is the status
+// of the seller's own payout transaction once it is found by reference.
+type PayoutResult struct {
+	Seller        string   `json:"seller"`
+	Balance       string   `json:"balance"`
+	Reference     string   `json:"reference,omitempty"`
+	Amount        *big.Int `json:"amount,omitempty"`
+	BatchID       string   `json:"batch_id,omitempty"`
+	TransactionID string   `json:"transaction_id,omitempty"`
+	Status        string   `json:"status"`
+	Error         string   `json:"error,omitempty"`
+}
+
+// Payout result statuses set by the SDK; other values are transaction
+// statuses from Core. PayoutStatusUnknown means the batch was accepted but the
+// payout transaction could not be read back.
+const (
+	PayoutStatusSkipped = "skipped"
+	PayoutStatusFailed  = "failed"
+	PayoutStatusUnknown = "unknown"
+)
+
+// PayoutReport lists every requested payout in order.
+type PayoutReport struct {
+	Results []PayoutResult `json:"results"`
+}
+
+// Marketplace posts split payments and batches seller payouts.
+type Marketplace struct {
+	transactions *TransactionService
+	balances     *LedgerBalanceService
+}
+
+func NewMarketplace(transactions *TransactionService, balances *LedgerBalanceService) *Marketplace {
+	return &Marketplace{transactions: transactions, balances: balances}
+}
+
+// ValidateSplitPayment checks the payment has an amount, a source and
+// well-formed rules with distinct destinations.
+func ValidateSplitPayment(p SplitPayment) error {
+	if p.Amount == nil || p.Amount.Sign() <= 0 {
+		return errors.New("validation error: split payment amount must be positive")
+	}
+	if strings.TrimSpace(p.Source) == "" {
+		return errors.New("validation error: split payment source is required")
+	}
+	if len(p.Rules) == 0 {
+		return errors.New("validation error: at least one split rule is required")
+	}
+	destinations := make(map[string]struct{}, len(p.Rules))
+	remainder := false
+	for i, r := range p.Rules {
+		if strings.TrimSpace(r.Destination) == "" {
+			return fmt.Errorf("validation error: split rule at index %d must have a destination", i)
+		}
+		if _, dup := destinations[r.Destination]; dup {
+			return fmt.Errorf("validation error: duplicate split destination %s", r.Destination)
+		}
+		destinations[r.Destination] = struct{}{}
+
+		set := 0
+		if r.Amount != nil {
+			set++
+			if r.Amount.Sign() < 0 {
+				return fmt.Errorf("validation error: split rule %s amount must be non-negative", r.Destination)
+			}
+		}
+		if r.Percentage != 0 {
+			set++
+			if r.Percentage < 0 || r.Percentage > 100 {
+				return fmt.Errorf("validation error: split rule %s percentage must be between 0 and 100", r.Destination)
+			}
+		}
+		if r.Remainder {
+			set++
+			if remainder {
+				return errors.New("validation error: only one split rule may take the remainder")
+			}
+			remainder = true
+		}
+		if set != 1 {
+			return fmt.Errorf("validation error: split rule %s must set exactly one of amount, percentage or remainder", r.Destination)
+		}
+	}
+	return nil
+}
+
+// BuildSplitPayment resolves the split rules into amounts and returns the
+// transactions that apply them.
+func BuildSplitPayment(p SplitPayment) (*SplitPaymentPlan, error) {
+	if err := ValidateSplitPayment(p); err != nil {
+		return nil, err
+	}
+
+	allocations := make([]SplitAllocation, len(p.Rules))
+	allocated := big.NewInt(0)
+	remainderIndex := -1
+	for i, r := range p.Rules {
+		seller := r.Seller
+		if seller == "" && r.Role == SplitRoleSeller {
+			seller = r.Destination
+		}
+		allocations[i] = SplitAllocation{Role: r.Role, Seller: seller, Destination: r.Destination}
+		switch {
+		case r.Remainder:
+			remainderIndex = i
+			continue
+		case r.Amount != nil:
+			allocations[i].Amount = new(big.Int).Set(r.Amount)
+		default:
+			amount, err := percentOf(p.Amount, r.Percentage)
+			if err != nil {
+				return nil, err
+			}
+			allocations[i].Amount = amount
+		}
+		allocated.Add(allocated, allocations[i].Amount)
+	}
+
+	remaining := new(big.Int).Sub(p.Amount, allocated)
+	if remaining.Sign() < 0 {
+		return nil, fmt.Errorf("validation error: split rules allocate %s, more than the payment amount %s", allocated, p.Amount)
+	}
+	if remainderIndex >= 0 {
+		allocations[remainderIndex].Amount = remaining
+	} else if remaining.Sign() != 0 {
+		return nil, fmt.Errorf("validation error: split rules leave %s unallocated; add a remainder rule", remaining)
+	}
+
+	splits := make([]map[string]interface{}, 0, len(allocations))
+	for _, a := range allocations {
+		splits = append(splits, map[string]interface{}{
+			"role":        string(a.Role),
+			"seller":      a.Seller,
+			"destination": a.Destination,
+			"amount":      a.Amount.String(),
+		})
+	}
+
+	plan := &SplitPaymentPlan{Allocations: allocations}
+	var paid, held []int
+	for i, r := range p.Rules {
+		if p.HoldSellerFunds && r.Role == SplitRoleSeller {
+			held = append(held, i)
+		} else {
+			paid = append(paid, i)
+		}
+	}
+	var err error
+	if len(paid) > 0 {
+		if plan.Payment, err = splitTransaction(p, p.Reference, paid, allocations, splits); err != nil {
+			return nil, err
+		}
+	}
+	if len(held) > 0 {
+		if plan.Hold, err = splitTransaction(p, p.Reference+"_hold", held, allocations, splits); err != nil {
+			return nil, err
+		}
+		plan.Hold.Inflight = true
+		plan.Hold.InflightExpiryDate = p.HoldUntil
+	}
+	return plan, nil
+}
+
+// splitTransaction builds the transaction paying the rules at indexes.
+func splitTransaction(p SplitPayment, reference string, indexes []int, allocations []SplitAllocation, splits []map[string]interface{}) (*CreateTransactionRequest, error) {
+	precision := p.Precision
+	if precision == 0 {
+		precision = 1
+	}
+	meta := make(MetaData, len(p.MetaData)+1)
+	for k, v := range p.MetaData {
+		meta[k] = v
+	}
+	meta[SplitsMetaKey] = splits
+
+	amount := big.NewInt(0)
+	body := &CreateTransactionRequest{
+		ParentTransaction: ParentTransaction{
+			Precision:   precision,
+			Reference:   reference,
+			Description: p.Description,
+			Currency:    p.Currency,
+			Source:      p.Source,
+			SkipQueue:   p.SkipQueue,
+			MetaData:    meta,
+		},
+	}
+	for _, i := range indexes {
+		a := allocations[i]
+		amount.Add(amount, a.Amount)
+		body.Destinations = append(body.Destinations, Source{
+			Identifier:          a.Destination,
+			PreciseDistribution: a.Amount.String(),
+			Narration:           p.Rules[i].Narration,
+		})
+	}
+	body.PreciseAmount = amount
+
+	if err := ValidateCreateTransacation(*body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Pay posts a split payment. Without a hold every party is credited by one
+// transaction. With HoldSellerFunds the seller hold and the platform and tax
+// transaction are submitted together as one atomic bulk request, so either
+// both post or neither does, and are then read back by reference.
+func (m *Marketplace) Pay(p SplitPayment) (*SplitPaymentResult, *http.Response, error) {
+	plan, err := BuildSplitPayment(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	result := &SplitPaymentResult{Allocations: plan.Allocations}
+
+	if plan.Hold == nil || plan.Payment == nil {
+		body, into := plan.Payment, &result.Transaction
+		if body == nil {
+			body, into = plan.Hold, &result.Hold
+		}
+		transaction, resp, err := m.transactions.Create(*body)
+		if err != nil {
+			return nil, resp, err
+		}
+		*into = transaction
+		return result, resp, nil
+	}
+
+	batch, resp, err := m.transactions.CreateBulk(CreateBulkTransactionRequest{
+		Transactions: []CreateTransactionRequest{*plan.Hold, *plan.Payment},
+		Atomic:       true,
+		SkipQueue:    p.SkipQueue,
+	})
+	if err != nil {
+		return nil, resp, err
+	}
+	result.BatchID = batch.BatchID
+	if result.Hold, _, err = m.transactions.GetByReference(plan.Hold.Reference); err != nil {
+		return result, resp, fmt.Errorf("split payment posted in batch %s, reading hold %s failed: %w", batch.BatchID, plan.Hold.Reference, err)
+	}
+	if result.Transaction, _, err = m.transactions.GetByReference(plan.Payment.Reference); err != nil {
+		return result, resp, fmt.Errorf("split payment posted in batch %s, reading payment %s failed: %w", batch.BatchID, plan.Payment.Reference, err)
+	}
+	return result, resp, nil
+}
+
+// Release commits the seller hold of a split payment, making seller funds
+// available.
+func (m *Marketplace) Release(transactionID string) (*Transaction, *http.Response, error) {
+	return m.transactions.Update(transactionID, UpdateStatus{Status: InflightStatusCommit})
+}
+
+// Cancel voids the seller hold of a split payment, returning the seller share
+// to the customer. Platform and tax legs have already settled and must be
+// refunded separately.
+func (m *Marketplace) Cancel(transactionID string) (*Transaction, *http.Response, error) {
+	return m.transactions.Update(transactionID, UpdateStatus{Status: InflightStatusVoid})
+}
+
+// SellerPosition returns a seller's pending (held inflight) and available
+// (balance less outgoing inflight) amounts.
+func (m *Marketplace) SellerPosition(balanceID string) (*SellerPosition, *http.Response, error) {
+	balance, resp, err := m.balances.Get(balanceID)
+	if err != nil {
+		return nil, resp, err
+	}
+	return sellerPosition(balance), resp, nil
+}
+
+func sellerPosition(b *LedgerBalance) *SellerPosition {
+	available := new(big.Int).Sub(cloneBigInt(b.Balance), cloneBigInt(b.InflightDebitBalance))
+	if available.Sign() < 0 {
+		available.SetInt64(0)
+	}
+	return &SellerPosition{
+		BalanceID: b.BalanceID,
+		Currency:  b.Currency,
+		Pending:   cloneBigInt(b.InflightCreditBalance),
+		Available: available,
+	}
+}
+
+// Payouts pays sellers through CreateBulk, in batches of MaxBulkCreateItems.
+// Payouts are not atomic: each seller's payout is read back by reference and
+// reported with its own transaction status, and sellers with nothing
+// available are skipped.
+func (m *Marketplace) Payouts(payouts []Payout, options PayoutOptions) (*PayoutReport, error) {
+	if len(payouts) == 0 {
+		return nil, errors.New("validation error: at least one payout is required")
+	}
+	date := options.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	precision := options.Precision
+	if precision == 0 {
+		precision = 1
+	}
+
+	report := &PayoutReport{Results: make([]PayoutResult, len(payouts))}
+	var pending []int
+	var batch []CreateTransactionRequest
+
+	for i, p := range payouts {
+		seller := p.Seller
+		if seller == "" {
+			seller = p.Balance
+		}
+		result := &report.Results[i]
+		*result = PayoutResult{Seller: seller, Balance: p.Balance}
+		if p.Balance == "" || p.Destination == "" {
+			result.Status = PayoutStatusFailed
+			result.Error = "balance and destination are required"
+			continue
+		}
+
+		amount, currency := p.Amount, options.Currency
+		if amount == nil || currency == "" {
+			balance, _, err := m.balances.Get(p.Balance)
+			if err != nil {
+				result.Status = PayoutStatusFailed
+				result.Error = err.Error()
+				continue
+			}
+			if amount == nil {
+				amount = sellerPosition(balance).Available
+			}
+			if currency == "" {
+				currency = balance.Currency
+			}
+		}
+		if amount.Sign() <= 0 {
+			result.Status = PayoutStatusSkipped
+			continue
+		}
+
+		reference := p.Reference
+		if reference == "" {
+			reference = fmt.Sprintf("payout_%s_%s", seller, date.UTC().Format("20060102"))
+		}
+		description := options.Description
+		if description == "" {
+			description = fmt.Sprintf("Payout to %s", seller)
+		}
+		result.Reference = reference
+		result.Amount = new(big.Int).Set(amount)
+		pending = append(pending, i)
+		batch = append(batch, CreateTransactionRequest{
+			ParentTransaction: ParentTransaction{
+				PreciseAmount: new(big.Int).Set(amount),
+				Precision:     precision,
+				Reference:     reference,
+				Description:   description,
+				Currency:      currency,
+				Source:        p.Balance,
+				Destination:   p.Destination,
+				MetaData:      MetaData{"payout_seller": seller},
+			},
+		})
+	}
+
+	for start := 0; start < len(batch); start += MaxBulkCreateItems {
+		end := start + MaxBulkCreateItems
+		if end > len(batch) {
+			end = len(batch)
+		}
+		response, _, err := m.transactions.CreateBulk(CreateBulkTransactionRequest{
+			Transactions: batch[start:end],
+			SkipQueue:    options.SkipQueue,
+		})
+		for _, i := range pending[start:end] {
+			result := &report.Results[i]
+			if err != nil {
+				result.Status = PayoutStatusFailed
+				result.Error = err.Error()
+				continue
+			}
+			result.BatchID = response.BatchID
+			m.payoutStatus(result)
+		}
+	}
+	return report, nil
+}
+
+// payoutStatus fills a payout result from the transaction posted under its
+// reference.
+func (m *Marketplace) payoutStatus(result *PayoutResult) {
+	txn, resp, err := m.transactions.GetByReference(result.Reference)
+	switch {
+	case isNotFound(resp, err):
+		result.Status = PayoutStatusFailed
+		result.Error = "payout was not recorded"
+	case err != nil:
+		result.Status = PayoutStatusUnknown
+		result.Error = err.Error()
+	default:
+		result.TransactionID = txn.TransactionID
+		result.Status = string(txn.Status)
+	}
+}
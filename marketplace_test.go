@@ -0,0 +1,248 @@
+package blnkgo_test
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func setupMarketplace() (*MockClient, *blnkgo.Marketplace) {
+	mockClient := &MockClient{}
+	return mockClient, blnkgo.NewMarketplace(blnkgo.NewTransactionService(mockClient), blnkgo.NewLedgerBalanceService(mockClient))
+}
+
+func orderPayment() blnkgo.SplitPayment {
+	return blnkgo.SplitPayment{
+		Reference:   "order_7",
+		Description: "Order 7",
+		Currency:    "USD",
+		Precision:   100,
+		Amount:      big.NewInt(10999),
+		Source:      "bln_customer",
+		Rules: []blnkgo.SplitRule{
+			{Role: blnkgo.SplitRoleTax, Destination: "@sales_tax", Amount: big.NewInt(999)},
+			{Role: blnkgo.SplitRolePlatform, Destination: "@platform", Percentage: 10},
+			{Role: blnkgo.SplitRoleSeller, Seller: "seller_a", Destination: "bln_seller_a", Percentage: 45},
+			{Role: blnkgo.SplitRoleSeller, Destination: "bln_seller_b", Remainder: true},
+		},
+		HoldSellerFunds: true,
+	}
+}
+
+func TestValidateSplitPayment(t *testing.T) {
+	assert.NoError(t, blnkgo.ValidateSplitPayment(orderPayment()))
+
+	p := orderPayment()
+	p.Rules[0].Percentage = 5
+	assert.Error(t, blnkgo.ValidateSplitPayment(p))
+
+	p = orderPayment()
+	p.Rules[1].Remainder, p.Rules[1].Percentage = true, 0
+	assert.Error(t, blnkgo.ValidateSplitPayment(p))
+
+	p = orderPayment()
+	p.Rules[1].Destination = "@sales_tax"
+	assert.Error(t, blnkgo.ValidateSplitPayment(p))
+}
+
+func TestBuildSplitPayment(t *testing.T) {
+	plan, err := blnkgo.BuildSplitPayment(orderPayment())
+	require.NoError(t, err)
+
+	body := plan.Payment
+	assert.False(t, body.Atomic)
+	assert.False(t, body.Inflight)
+	assert.Equal(t, "order_7", body.Reference)
+	assert.Equal(t, "2099", body.PreciseAmount.String())
+	require.Len(t, body.Destinations, 2)
+	assert.Equal(t, "999", body.Destinations[0].PreciseDistribution)
+	assert.Equal(t, "1100", body.Destinations[1].PreciseDistribution)
+
+	hold := plan.Hold
+	assert.True(t, hold.Inflight)
+	assert.Equal(t, "order_7_hold", hold.Reference)
+	assert.Equal(t, "8900", hold.PreciseAmount.String())
+	require.Len(t, hold.Destinations, 2)
+	assert.Equal(t, "4950", hold.Destinations[0].PreciseDistribution)
+	assert.Equal(t, "3950", hold.Destinations[1].PreciseDistribution)
+
+	allocations := plan.Allocations
+	assert.Equal(t, "seller_a", allocations[2].Seller)
+	assert.Equal(t, "bln_seller_b", allocations[3].Seller)
+	assert.Empty(t, allocations[1].Seller)
+	assert.Len(t, body.MetaData[blnkgo.SplitsMetaKey], 4)
+
+	p := orderPayment()
+	p.HoldSellerFunds = false
+	plan, err = blnkgo.BuildSplitPayment(p)
+	require.NoError(t, err)
+	assert.Nil(t, plan.Hold)
+	assert.Equal(t, "10999", plan.Payment.PreciseAmount.String())
+	assert.Len(t, plan.Payment.Destinations, 4)
+
+	p = orderPayment()
+	p.Rules = p.Rules[:3]
+	_, err = blnkgo.BuildSplitPayment(p)
+	assert.ErrorContains(t, err, "unallocated")
+}
+
+func TestMarketplace_PayAndRelease(t *testing.T) {
+	mockClient, market := setupMarketplace()
+	var sent blnkgo.CreateBulkTransactionRequest
+	mockClient.On("NewRequest", "transactions/bulk", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		sent = args.Get(2).(blnkgo.CreateBulkTransactionRequest)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.CreateBulkTransactionResponse")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.CreateBulkTransactionResponse).BatchID = "batch_order_7"
+	})
+	var reference string
+	mockClient.On("NewRequest", mock.MatchedBy(func(p string) bool { return strings.HasPrefix(p, "transactions/reference/") }), http.MethodGet, nil).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		reference = strings.TrimPrefix(args.String(0), "transactions/reference/")
+	})
+	mockClient.On("NewRequest", "transactions/inflight/txn_hold", http.MethodPut, blnkgo.UpdateStatus{Status: blnkgo.InflightStatusCommit}).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		id := "txn_fees"
+		if reference == "order_7_hold" {
+			id = "txn_hold"
+		}
+		args.Get(1).(*blnkgo.Transaction).TransactionID = id
+	})
+
+	result, _, err := market.Pay(orderPayment())
+	require.NoError(t, err)
+	assert.True(t, sent.Atomic)
+	assert.False(t, sent.Inflight)
+	require.Len(t, sent.Transactions, 2)
+	assert.True(t, sent.Transactions[0].Inflight)
+	assert.Equal(t, "order_7_hold", sent.Transactions[0].Reference)
+	assert.False(t, sent.Transactions[1].Inflight)
+	assert.Equal(t, "batch_order_7", result.BatchID)
+	assert.Equal(t, "txn_hold", result.Hold.TransactionID)
+	assert.Equal(t, "txn_fees", result.Transaction.TransactionID)
+	assert.Len(t, result.Allocations, 4)
+
+	_, _, err = market.Release(result.Hold.TransactionID)
+	require.NoError(t, err)
+	mockClient.AssertNotCalled(t, "NewRequest", "transactions", http.MethodPost, mock.Anything)
+}
+
+func TestMarketplace_PayFailsWithoutPartialSplit(t *testing.T) {
+	mockClient, market := setupMarketplace()
+	mockClient.On("NewRequest", "transactions/bulk", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.CreateBulkTransactionResponse")).Return(&http.Response{StatusCode: http.StatusBadRequest}, errors.New("insufficient funds"))
+
+	_, _, err := market.Pay(orderPayment())
+	assert.EqualError(t, err, "insufficient funds")
+	mockClient.AssertNotCalled(t, "NewRequest", "transactions", http.MethodPost, mock.Anything)
+	mockClient.AssertNotCalled(t, "NewRequest", mock.Anything, http.MethodPut, mock.Anything)
+}
+
+func TestMarketplace_PayWithoutHold(t *testing.T) {
+	mockClient, market := setupMarketplace()
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.Transaction).TransactionID = "txn_1"
+	})
+
+	p := orderPayment()
+	p.HoldSellerFunds = false
+	result, _, err := market.Pay(p)
+	require.NoError(t, err)
+	assert.Equal(t, "txn_1", result.Transaction.TransactionID)
+	assert.Nil(t, result.Hold)
+}
+
+func TestMarketplace_SellerPosition(t *testing.T) {
+	mockClient, market := setupMarketplace()
+	mockClient.On("NewRequest", "balances/bln_seller_a", http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*blnkgo.LedgerBalance) = blnkgo.LedgerBalance{
+			BalanceID:             "bln_seller_a",
+			Currency:              "USD",
+			Balance:               big.NewInt(20000),
+			InflightCreditBalance: big.NewInt(4950),
+			InflightDebitBalance:  big.NewInt(5000),
+		}
+	})
+
+	position, _, err := market.SellerPosition("bln_seller_a")
+	require.NoError(t, err)
+	assert.Equal(t, "4950", position.Pending.String())
+	assert.Equal(t, "15000", position.Available.String())
+}
+
+func TestMarketplace_Payouts(t *testing.T) {
+	mockClient, market := setupMarketplace()
+	var path string
+	mockClient.On("NewRequest", mock.MatchedBy(func(p string) bool { return strings.HasPrefix(p, "balances/") }), http.MethodGet, nil).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		path = args.String(0)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		b := args.Get(1).(*blnkgo.LedgerBalance)
+		b.Currency = "USD"
+		switch path {
+		case "balances/bln_seller_a":
+			b.Balance = big.NewInt(15000)
+		case "balances/bln_seller_b":
+			b.Balance = big.NewInt(0)
+		}
+	})
+	var sent blnkgo.CreateBulkTransactionRequest
+	mockClient.On("NewRequest", "transactions/bulk", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		sent = args.Get(2).(blnkgo.CreateBulkTransactionRequest)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.CreateBulkTransactionResponse")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*blnkgo.CreateBulkTransactionResponse) = blnkgo.CreateBulkTransactionResponse{BatchID: "batch_1", Status: "applied"}
+	})
+	mockClient.On("NewRequest", "transactions/reference/payout_seller_a_20240603", http.MethodGet, nil).Return(&http.Request{URL: &url.URL{Path: "ref_a"}}, nil)
+	mockClient.On("NewRequest", "transactions/reference/payout_seller_c_20240603", http.MethodGet, nil).Return(&http.Request{URL: &url.URL{Path: "ref_c"}}, nil)
+	mockClient.On("CallWithRetry", mock.MatchedBy(func(r *http.Request) bool { return r.URL != nil && r.URL.Path == "ref_a" }), mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*blnkgo.Transaction) = blnkgo.Transaction{TransactionID: "txn_payout_a", ParentTransaction: blnkgo.ParentTransaction{Status: blnkgo.PryTransactionStatusApplied}}
+	})
+	mockClient.On("CallWithRetry", mock.MatchedBy(func(r *http.Request) bool { return r.URL != nil && r.URL.Path == "ref_c" }), mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusNotFound}, notFound())
+
+	report, err := market.Payouts([]blnkgo.Payout{
+		{Seller: "seller_a", Balance: "bln_seller_a", Destination: "@bank_payouts"},
+		{Seller: "seller_b", Balance: "bln_seller_b", Destination: "@bank_payouts"},
+		{Seller: "seller_c", Balance: "bln_seller_c", Destination: "@bank_payouts", Amount: big.NewInt(700)},
+		{Seller: "seller_d", Destination: "@bank_payouts"},
+	}, blnkgo.PayoutOptions{Precision: 100, Date: time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	require.Len(t, report.Results, 4)
+
+	assert.Equal(t, "payout_seller_a_20240603", report.Results[0].Reference)
+	assert.Equal(t, "15000", report.Results[0].Amount.String())
+	assert.Equal(t, "batch_1", report.Results[0].BatchID)
+	assert.Equal(t, "txn_payout_a", report.Results[0].TransactionID)
+	assert.Equal(t, "APPLIED", report.Results[0].Status)
+	assert.Equal(t, blnkgo.PayoutStatusSkipped, report.Results[1].Status)
+	assert.Equal(t, "700", report.Results[2].Amount.String())
+	assert.Equal(t, blnkgo.PayoutStatusFailed, report.Results[2].Status)
+	assert.Equal(t, blnkgo.PayoutStatusFailed, report.Results[3].Status)
+
+	require.Len(t, sent.Transactions, 2)
+	assert.False(t, sent.Atomic)
+	assert.Equal(t, "bln_seller_c", sent.Transactions[1].Source)
+	assert.Equal(t, "USD", sent.Transactions[1].Currency)
+}
+
+func TestMarketplace_Payouts_BulkFailure(t *testing.T) {
+	mockClient, market := setupMarketplace()
+	mockClient.On("NewRequest", "transactions/bulk", http.MethodPost, mock.Anything).Return(nil, errors.New("core down"))
+
+	report, err := market.Payouts([]blnkgo.Payout{
+		{Seller: "seller_a", Balance: "bln_seller_a", Destination: "@bank_payouts", Amount: big.NewInt(100)},
+	}, blnkgo.PayoutOptions{Currency: "USD"})
+	require.NoError(t, err)
+	assert.Equal(t, blnkgo.PayoutStatusFailed, report.Results[0].Status)
+	assert.Equal(t, "core down", report.Results[0].Error)
+}
@@ -0,0 +1,494 @@
+package blnkgo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboxEntryStatus is the delivery state of a queued transaction.
+type OutboxEntryStatus string
+
+const (
+	OutboxEntryPending   OutboxEntryStatus = "PENDING"
+	OutboxEntrySubmitted OutboxEntryStatus = "SUBMITTED"
+	OutboxEntryFailed    OutboxEntryStatus = "FAILED"
+)
+
+// ErrCoreUnavailable is returned by Outbox.Flush when the health check fails.
+var ErrCoreUnavailable = errors.New("blnk core is unavailable")
+
+// OutboxEntry is a transaction accepted by the outbox and its delivery state.
+type OutboxEntry struct {
+	ID            string                   `json:"id"`
+	Request       CreateTransactionRequest `json:"request"`
+	Status        OutboxEntryStatus        `json:"status"`
+	Attempts      int                      `json:"attempts"`
+	LastError     string                   `json:"last_error,omitempty"`
+	TransactionID string                   `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time                `json:"created_at"`
+	UpdatedAt     time.Time                `json:"updated_at"`
+}
+
+// OutboxStore persists outbox entries. Save is called with the full entry every
+// time it changes; List returns the latest state of every entry in the order
+// entries were first saved.
+type OutboxStore interface {
+	Save(entry OutboxEntry) error
+	List() ([]OutboxEntry, error)
+}
+
+// OutboxOptions configures delivery behaviour.
+type OutboxOptions struct {
+	// MaxAttempts is the number of transient failures tolerated before an entry
+	// is marked FAILED. Zero uses 5.
+	MaxAttempts int
+	// Logger receives delivery progress. Nil uses the default logger.
+	Logger Logger
+}
+
+// OutboxFlushResult summarises one Flush call.
+type OutboxFlushResult struct {
+	Submitted int `json:"submitted"`
+	Failed    int `json:"failed"`
+	Pending   int `json:"pending"`
+}
+
+// Outbox durably queues CreateTransactionRequests and submits them to Core in
+// order once the health check passes. Every entry carries a reference, so a
+// submission that reached Core before a failure is detected by reference rather
+// than posted twice.
+type Outbox struct {
+	transactions *TransactionService
+	health       *HealthService
+	store        OutboxStore
+	options      OutboxOptions
+	// mu guards read-modify-write access to the store; it is never held
+	// across calls to Core.
+	mu sync.Mutex
+	// flushing serializes Flush so each pending entry is submitted once and
+	// in order.
+	flushing sync.Mutex
+}
+
+const defaultOutboxMaxAttempts = 5
+
+func NewOutbox(transactions *TransactionService, health *HealthService, store OutboxStore, options OutboxOptions) *Outbox {
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = defaultOutboxMaxAttempts
+	}
+	if options.Logger == nil {
+		options.Logger = NewDefaultLogger()
+	}
+	return &Outbox{
+		transactions: transactions,
+		health:       health,
+		store:        store,
+		options:      options,
+	}
+}
+
+// Enqueue validates and persists a transaction for later submission. A missing
+// Reference is replaced with one derived from the entry ID so retries stay
+// idempotent.
+func (o *Outbox) Enqueue(body CreateTransactionRequest) (*OutboxEntry, error) {
+	if err := ValidateCreateTransacation(body); err != nil {
+		return nil, err
+	}
+
+	id, err := newOutboxID()
+	if err != nil {
+		return nil, err
+	}
+	if body.Reference == "" {
+		body.Reference = "outbox_" + id
+	}
+
+	now := time.Now().UTC()
+	entry := OutboxEntry{
+		ID:        id,
+		Request:   body,
+		Status:    OutboxEntryPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.store.Save(entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Flush submits pending entries in order. It stops at the first transient
+// failure so later entries are never posted ahead of earlier ones, and returns
+// ErrCoreUnavailable without submitting anything when the health check fails.
+// Entries enqueued while a flush is running are picked up by the next one;
+// Enqueue does not wait for Core.
+func (o *Outbox) Flush() (*OutboxFlushResult, error) {
+	o.flushing.Lock()
+	defer o.flushing.Unlock()
+
+	o.mu.Lock()
+	entries, err := o.store.List()
+	o.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &OutboxFlushResult{}
+	pending := make([]OutboxEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Status == OutboxEntryPending {
+			pending = append(pending, entry)
+		}
+	}
+	if len(pending) == 0 {
+		return result, nil
+	}
+
+	if err := o.checkHealth(); err != nil {
+		result.Pending = len(pending)
+		return result, err
+	}
+
+	for i, entry := range pending {
+		transient, err := o.submit(&entry)
+		o.mu.Lock()
+		saveErr := o.store.Save(entry)
+		o.mu.Unlock()
+		if saveErr != nil {
+			return result, saveErr
+		}
+
+		switch entry.Status {
+		case OutboxEntrySubmitted:
+			result.Submitted++
+		case OutboxEntryFailed:
+			result.Failed++
+		}
+
+		if transient {
+			result.Pending = len(pending) - i
+			if entry.Status == OutboxEntryFailed {
+				result.Pending--
+			}
+			o.options.Logger.Error(fmt.Sprintf("outbox: stopping flush at entry %s: %v", entry.ID, err))
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// Run calls Flush every interval until ctx is cancelled. Flush errors are logged
+// and retried on the next tick.
+func (o *Outbox) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("validation error: outbox flush interval must be positive")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := o.Flush(); err != nil {
+			o.options.Logger.Error(fmt.Sprintf("outbox: flush failed: %v", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Pending returns entries that have not been submitted yet.
+func (o *Outbox) Pending() ([]OutboxEntry, error) {
+	return o.entriesWithStatus(OutboxEntryPending)
+}
+
+// Failed returns entries that were rejected by Core or exhausted their attempts.
+func (o *Outbox) Failed() ([]OutboxEntry, error) {
+	return o.entriesWithStatus(OutboxEntryFailed)
+}
+
+// Requeue moves a FAILED entry back to PENDING and resets its attempt counter.
+func (o *Outbox) Requeue(id string) (*OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries, err := o.store.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.ID != id {
+			continue
+		}
+		if entry.Status != OutboxEntryFailed {
+			return nil, fmt.Errorf("outbox entry %s is %s, only FAILED entries can be requeued", id, entry.Status)
+		}
+		entry.Status = OutboxEntryPending
+		entry.Attempts = 0
+		entry.LastError = ""
+		entry.UpdatedAt = time.Now().UTC()
+		if err := o.store.Save(entry); err != nil {
+			return nil, err
+		}
+		return &entry, nil
+	}
+	return nil, fmt.Errorf("outbox entry %s not found", id)
+}
+
+func (o *Outbox) entriesWithStatus(status OutboxEntryStatus) ([]OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries, err := o.store.List()
+	if err != nil {
+		return nil, err
+	}
+	var filtered []OutboxEntry
+	for _, entry := range entries {
+		if entry.Status == status {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered, nil
+}
+
+func (o *Outbox) checkHealth() error {
+	health, _, err := o.health.Check()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCoreUnavailable, err)
+	}
+	if health.Status != "" && !strings.EqualFold(health.Status, "UP") {
+		return fmt.Errorf("%w: status %s", ErrCoreUnavailable, health.Status)
+	}
+	return nil
+}
+
+// submit posts one entry and updates it in place. It reports whether the
+// failure was transient, in which case the flush should stop.
+func (o *Outbox) submit(entry *OutboxEntry) (bool, error) {
+	entry.UpdatedAt = time.Now().UTC()
+
+	// A previous attempt may have reached Core before failing on our side.
+	if entry.Attempts > 0 {
+		if existing, _, err := o.transactions.GetByReference(entry.Request.Reference); err == nil {
+			entry.Status = OutboxEntrySubmitted
+			entry.TransactionID = existing.TransactionID
+			entry.LastError = ""
+			return false, nil
+		}
+	}
+
+	entry.Attempts++
+	transaction, resp, err := o.transactions.Create(entry.Request)
+	if err == nil {
+		entry.Status = OutboxEntrySubmitted
+		entry.TransactionID = transaction.TransactionID
+		entry.LastError = ""
+		return false, nil
+	}
+
+	entry.LastError = err.Error()
+	if isPermanentOutboxError(resp, err) {
+		if existing, _, lookupErr := o.transactions.GetByReference(entry.Request.Reference); lookupErr == nil {
+			entry.Status = OutboxEntrySubmitted
+			entry.TransactionID = existing.TransactionID
+			entry.LastError = ""
+			return false, nil
+		}
+		entry.Status = OutboxEntryFailed
+		return false, err
+	}
+
+	if entry.Attempts >= o.options.MaxAttempts {
+		entry.Status = OutboxEntryFailed
+	}
+	return true, err
+}
+
+func isPermanentOutboxError(resp *http.Response, err error) bool {
+	// Retrying cannot reopen a closed period.
+	if errors.Is(err, ErrPeriodClosed) {
+		return true
+	}
+	if apiErr, ok := AsApiErrorResponse(err); ok {
+		return apiErr.Status >= 400 && apiErr.Status < 500 && apiErr.Status != http.StatusTooManyRequests
+	}
+	// Validation errors are returned before any request is sent.
+	return resp == nil && strings.HasPrefix(err.Error(), "validation error")
+}
+
+func newOutboxID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// FileOutboxStore is an append-only JSON lines log. Every Save appends the full
+// entry and syncs the file; List replays the log so the last record for an ID
+// wins. A final record torn by a crash during Save is ignored by List and cut
+// off by the next Save.
+type FileOutboxStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileOutboxStore(path string) *FileOutboxStore {
+	return &FileOutboxStore{path: path}
+}
+
+func (s *FileOutboxStore) Save(entry OutboxEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := truncateTornTail(f); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *FileOutboxStore) List() ([]OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	index := make(map[string]int)
+	var entries []OutboxEntry
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		final := err == io.EOF
+		if !final {
+			_, peekErr := reader.Peek(1)
+			final = peekErr == io.EOF
+		}
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			var entry OutboxEntry
+			if decodeErr := json.Unmarshal(line, &entry); decodeErr != nil {
+				if final {
+					break
+				}
+				return nil, fmt.Errorf("failed to read outbox log %s: %w", s.path, decodeErr)
+			}
+			if i, ok := index[entry.ID]; ok {
+				entries[i] = entry
+			} else {
+				index[entry.ID] = len(entries)
+				entries = append(entries, entry)
+			}
+		}
+		if final {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// truncateTornTail cuts off a trailing record without its newline, left by a
+// crash during an earlier Save, so the next append starts on its own line.
+func truncateTornTail(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		n := min(int64(len(buf)), end)
+		if _, err := f.ReadAt(buf[:n], end-n); err != nil {
+			return err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			if cut := end - n + int64(i) + 1; cut < size {
+				return f.Truncate(cut)
+			}
+			return nil
+		}
+		end -= n
+	}
+	if size > 0 {
+		return f.Truncate(0)
+	}
+	return nil
+}
+
+// MemoryOutboxStore keeps entries in memory; useful for tests and for callers
+// that provide durability elsewhere.
+type MemoryOutboxStore struct {
+	entries []OutboxEntry
+	mu      sync.Mutex
+}
+
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{}
+}
+
+func (s *MemoryOutboxStore) Save(entry OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.entries {
+		if s.entries[i].ID == entry.ID {
+			s.entries[i] = entry
+			return nil
+		}
+	}
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *MemoryOutboxStore) List() ([]OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make([]OutboxEntry, len(s.entries))
+	copy(entries, s.entries)
+	return entries, nil
+}
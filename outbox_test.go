@@ -0,0 +1,287 @@
+package blnkgo_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type silentLogger struct{}
+
+func (silentLogger) Info(string)  {}
+func (silentLogger) Error(string) {}
+
+func setupOutbox(store blnkgo.OutboxStore) (*MockClient, *blnkgo.Outbox) {
+	mockClient := &MockClient{}
+	outbox := blnkgo.NewOutbox(
+		blnkgo.NewTransactionService(mockClient),
+		blnkgo.NewHealthService(mockClient),
+		store,
+		blnkgo.OutboxOptions{MaxAttempts: 2, Logger: silentLogger{}},
+	)
+	return mockClient, outbox
+}
+
+func outboxRequest(reference string) blnkgo.CreateTransactionRequest {
+	return blnkgo.CreateTransactionRequest{
+		ParentTransaction: blnkgo.ParentTransaction{
+			Amount:      10,
+			Precision:   100,
+			Currency:    "USD",
+			Reference:   reference,
+			Source:      "bln_source",
+			Destination: "bln_dest",
+		},
+	}
+}
+
+func mockHealthy(mockClient *MockClient) {
+	mockClient.On("NewRequest", "health", http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.HealthResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.HealthResponse).Status = "UP"
+	})
+}
+
+func TestOutbox_EnqueueAndFlush(t *testing.T) {
+	mockClient, outbox := setupOutbox(blnkgo.NewMemoryOutboxStore())
+	mockHealthy(mockClient)
+
+	first, err := outbox.Enqueue(outboxRequest("ref_outbox_1"))
+	require.NoError(t, err)
+	second, err := outbox.Enqueue(outboxRequest(""))
+	require.NoError(t, err)
+	assert.Equal(t, "outbox_"+second.ID, second.Request.Reference)
+
+	var posted []string
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		posted = append(posted, args.Get(2).(blnkgo.CreateTransactionRequest).Reference)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.Transaction).TransactionID = "txn_123"
+	})
+
+	result, err := outbox.Flush()
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Submitted)
+	assert.Equal(t, []string{first.Request.Reference, second.Request.Reference}, posted)
+
+	pending, err := outbox.Pending()
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestOutbox_FlushSkipsWhenUnhealthy(t *testing.T) {
+	mockClient, outbox := setupOutbox(blnkgo.NewMemoryOutboxStore())
+
+	_, err := outbox.Enqueue(outboxRequest("ref_outbox_down"))
+	require.NoError(t, err)
+
+	mockClient.On("NewRequest", "health", http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.HealthResponse")).Return((*http.Response)(nil), errors.New("connection refused"))
+
+	result, err := outbox.Flush()
+	assert.ErrorIs(t, err, blnkgo.ErrCoreUnavailable)
+	assert.Equal(t, 1, result.Pending)
+	mockClient.AssertNotCalled(t, "NewRequest", "transactions", http.MethodPost, mock.Anything)
+}
+
+func TestOutbox_TransientFailureStopsAndEventuallyFails(t *testing.T) {
+	mockClient, outbox := setupOutbox(blnkgo.NewMemoryOutboxStore())
+	mockHealthy(mockClient)
+
+	_, err := outbox.Enqueue(outboxRequest("ref_outbox_a"))
+	require.NoError(t, err)
+	_, err = outbox.Enqueue(outboxRequest("ref_outbox_b"))
+	require.NoError(t, err)
+
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusBadGateway}, &blnkgo.ApiErrorResponse{Status: http.StatusBadGateway})
+	mockClient.On("NewRequest", "transactions/reference/ref_outbox_a", http.MethodGet, nil).Return(&http.Request{}, nil)
+
+	result, err := outbox.Flush()
+	assert.Error(t, err)
+	assert.Equal(t, 2, result.Pending)
+	mockClient.AssertNumberOfCalls(t, "NewRequest", 2)
+
+	result, err = outbox.Flush()
+	assert.Error(t, err)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, 1, result.Pending)
+
+	failed, err := outbox.Failed()
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, "ref_outbox_a", failed[0].Request.Reference)
+	assert.Equal(t, 2, failed[0].Attempts)
+
+	requeued, err := outbox.Requeue(failed[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, blnkgo.OutboxEntryPending, requeued.Status)
+	assert.Equal(t, 0, requeued.Attempts)
+}
+
+func TestOutbox_RetryDetectsAlreadyPosted(t *testing.T) {
+	mockClient, outbox := setupOutbox(blnkgo.NewMemoryOutboxStore())
+	mockHealthy(mockClient)
+
+	_, err := outbox.Enqueue(outboxRequest("ref_outbox_dup"))
+	require.NoError(t, err)
+
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Once()
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return((*http.Response)(nil), errors.New("read: connection reset")).Once()
+
+	_, err = outbox.Flush()
+	assert.Error(t, err)
+
+	mockClient.On("NewRequest", "transactions/reference/ref_outbox_dup", http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.Transaction).TransactionID = "txn_existing"
+	})
+
+	result, err := outbox.Flush()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Submitted)
+	mockClient.AssertNumberOfCalls(t, "NewRequest", 4)
+}
+
+func TestOutbox_PermanentFailure(t *testing.T) {
+	mockClient, outbox := setupOutbox(blnkgo.NewMemoryOutboxStore())
+	mockHealthy(mockClient)
+
+	_, err := outbox.Enqueue(outboxRequest("ref_outbox_bad"))
+	require.NoError(t, err)
+	_, err = outbox.Enqueue(outboxRequest("ref_outbox_good"))
+	require.NoError(t, err)
+
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("NewRequest", "transactions/reference/ref_outbox_bad", http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusBadRequest}, &blnkgo.ApiErrorResponse{Status: http.StatusBadRequest}).Twice()
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusCreated}, nil)
+
+	result, err := outbox.Flush()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, 1, result.Submitted)
+}
+
+func TestFileOutboxStore_ReplaysLatestState(t *testing.T) {
+	store := blnkgo.NewFileOutboxStore(filepath.Join(t.TempDir(), "outbox.log"))
+
+	entries, err := store.List()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	require.NoError(t, store.Save(blnkgo.OutboxEntry{ID: "a", Status: blnkgo.OutboxEntryPending, Request: outboxRequest("ref_a")}))
+	require.NoError(t, store.Save(blnkgo.OutboxEntry{ID: "b", Status: blnkgo.OutboxEntryPending, Request: outboxRequest("ref_b")}))
+	require.NoError(t, store.Save(blnkgo.OutboxEntry{ID: "a", Status: blnkgo.OutboxEntrySubmitted, TransactionID: "txn_a", Request: outboxRequest("ref_a")}))
+
+	entries, err = store.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "a", entries[0].ID)
+	assert.Equal(t, blnkgo.OutboxEntrySubmitted, entries[0].Status)
+	assert.Equal(t, "txn_a", entries[0].TransactionID)
+	assert.Equal(t, "b", entries[1].ID)
+	assert.Equal(t, "ref_b", entries[1].Request.Reference)
+}
+
+func TestFileOutboxStore_RecoversFromTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	store := blnkgo.NewFileOutboxStore(path)
+	require.NoError(t, store.Save(blnkgo.OutboxEntry{ID: "a", Status: blnkgo.OutboxEntryPending, Request: outboxRequest("ref_a")}))
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"id":"b","request":{"amou`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	entries, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "a", entries[0].ID)
+
+	require.NoError(t, store.Save(blnkgo.OutboxEntry{ID: "c", Status: blnkgo.OutboxEntryPending, Request: outboxRequest("ref_c")}))
+	entries, err = store.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "c", entries[1].ID)
+
+	// A corrupt record followed by good ones is not a torn write.
+	require.NoError(t, os.WriteFile(path, []byte("{broken\n"+`{"id":"d"}`+"\n"), 0o600))
+	_, err = store.List()
+	assert.Error(t, err)
+}
+
+func TestOutbox_EnqueueDoesNotWaitForFlush(t *testing.T) {
+	mockClient, outbox := setupOutbox(blnkgo.NewMemoryOutboxStore())
+	mockHealthy(mockClient)
+	_, err := outbox.Enqueue(outboxRequest("ref_slow"))
+	require.NoError(t, err)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Run(func(args mock.Arguments) {
+		close(started)
+		<-release
+	}).Once()
+
+	done := make(chan error)
+	go func() {
+		_, err := outbox.Flush()
+		done <- err
+	}()
+	<-started
+
+	_, err = outbox.Enqueue(outboxRequest("ref_during_flush"))
+	require.NoError(t, err)
+	close(release)
+	require.NoError(t, <-done)
+
+	pending, err := outbox.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "ref_during_flush", pending[0].Request.Reference)
+}
+
+func TestOutbox_ClosedPeriodIsPermanent(t *testing.T) {
+	store := blnkgo.NewMemoryOutboxStore()
+	mockClient := &MockClient{}
+	transactions := blnkgo.NewTransactionService(mockClient)
+	closes := blnkgo.NewMemoryPeriodCloseStore()
+	require.NoError(t, closes.Save(blnkgo.PeriodCloseRecord{ID: "2024-06", Start: juneStart, End: juneEnd}))
+	transactions.SetClosedPeriods(closes)
+	outbox := blnkgo.NewOutbox(transactions, blnkgo.NewHealthService(mockClient), store, blnkgo.OutboxOptions{Logger: silentLogger{}})
+	mockHealthy(mockClient)
+
+	backdated := juneStart.AddDate(0, 0, 3)
+	late := outboxRequest("ref_outbox_late")
+	late.EffectiveDate = &backdated
+	_, err := outbox.Enqueue(late)
+	require.NoError(t, err)
+	_, err = outbox.Enqueue(outboxRequest("ref_outbox_next"))
+	require.NoError(t, err)
+
+	mockClient.On("NewRequest", "transactions/reference/ref_outbox_late", http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusNotFound}, &blnkgo.ApiErrorResponse{Status: http.StatusNotFound}).Once()
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusCreated}, nil)
+
+	result, err := outbox.Flush()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, 1, result.Submitted)
+}
+
+func TestOutbox_RunRejectsNonPositiveInterval(t *testing.T) {
+	_, outbox := setupOutbox(blnkgo.NewMemoryOutboxStore())
+	assert.ErrorContains(t, outbox.Run(context.Background(), 0), "interval must be positive")
+}
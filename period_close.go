@@ -0,0 +1,494 @@
+package blnkgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PeriodCloseMetaKey links closing entries to their period close.
+const PeriodCloseMetaKey = "period_close_id"
+
+// ErrPeriodClosed is returned when a posting is effective inside a closed
+// period, or when a period overlaps one already closed.
+var ErrPeriodClosed = errors.New("accounting period is closed")
+
+// ClosingRule moves the period-end balance of every balance it matches into
+// Target, e.g. income and expense balances into retained earnings.
+type ClosingRule struct {
+	Name        string
+	Match       func(LedgerBalance) bool
+	Target      string
+	Description string
+}
+
+// PeriodCloseRequest closes [Start, End) for every balance in LedgerID.
+type PeriodCloseRequest struct {
+	ID       string
+	LedgerID string
+	Start    time.Time
+	End      time.Time
+	Rules    []ClosingRule
+	// Precision is used for closing entries; zero uses 1.
+	Precision int64
+	// FromSource reconstructs historical balances from transactions.
+	FromSource   bool
+	SkipSnapshot bool
+}
+
+// PeriodCloseBalance is a balance as of the period end.
+type PeriodCloseBalance struct {
+	BalanceID     string   `json:"balance_id"`
+	Indicator     string   `json:"indicator,omitempty"`
+	Currency      string   `json:"currency"`
+	Balance       *big.Int `json:"balance"`
+	CreditBalance *big.Int `json:"credit_balance"`
+	DebitBalance  *big.Int `json:"debit_balance"`
+}
+
+// PeriodCloseRecord is the stored result of a period close.
+type PeriodCloseRecord struct {
+	ID              string                     `json:"id"`
+	LedgerID        string                     `json:"ledger_id"`
+	Start           time.Time                  `json:"start"`
+	End             time.Time                  `json:"end"`
+	ClosedAt        time.Time                  `json:"closed_at"`
+	SnapshotMessage string                     `json:"snapshot_message,omitempty"`
+	Balances        []PeriodCloseBalance       `json:"balances"`
+	Entries         []CreateTransactionRequest `json:"entries,omitempty"`
+	BatchID         string                     `json:"batch_id,omitempty"`
+}
+
+// Contains reports whether t falls inside the closed period.
+func (r PeriodCloseRecord) Contains(t time.Time) bool {
+	return !t.Before(r.Start) && t.Before(r.End)
+}
+
+// Covers reports whether the close applies to balances of ledgerID. A record
+// without a LedgerID covers every ledger.
+func (r PeriodCloseRecord) Covers(ledgerID string) bool {
+	return r.LedgerID == "" || r.LedgerID == ledgerID
+}
+
+// PeriodCloseStore persists close records.
+type PeriodCloseStore interface {
+	Save(record PeriodCloseRecord) error
+	List() ([]PeriodCloseRecord, error)
+}
+
+// SetClosedPeriods makes Create and CreateBulk reject transactions whose
+// EffectiveDate falls inside a period recorded in store for the ledger of any
+// balance the transaction touches. Records are read once and cached; a Close
+// through a PeriodCloser built on this service refreshes them, and calling
+// SetClosedPeriods again picks up closes made elsewhere. Pass nil to disable.
+func (s *TransactionService) SetClosedPeriods(store PeriodCloseStore) {
+	if store == nil {
+		s.closedPeriods = nil
+		return
+	}
+	s.closedPeriods = &closedPeriodIndex{store: store, balances: NewLedgerBalanceService(s.client)}
+}
+
+func (s *TransactionService) invalidateClosedPeriods() {
+	if s.closedPeriods != nil {
+		s.closedPeriods.invalidate()
+	}
+}
+
+func (s *TransactionService) checkClosedPeriods(transactions ...CreateTransactionRequest) error {
+	if s.closedPeriods == nil {
+		return nil
+	}
+	for _, t := range transactions {
+		if t.EffectiveDate == nil {
+			continue
+		}
+		closed, err := s.closedPeriods.containing(*t.EffectiveDate)
+		if err != nil {
+			return err
+		}
+		if len(closed) == 0 {
+			continue
+		}
+		r, err := s.closedPeriods.covering(closed, t)
+		if err != nil {
+			return err
+		}
+		if r != nil {
+			return fmt.Errorf("%w: %s is effective %s, inside period %s (%s to %s)", ErrPeriodClosed,
+				t.Reference, t.EffectiveDate.Format(time.RFC3339), r.ID, r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// closedPeriodIndex caches close records by ledger, sorted by start, and the
+// ledger of every balance looked up while checking postings.
+type closedPeriodIndex struct {
+	store    PeriodCloseStore
+	balances *LedgerBalanceService
+
+	mu       sync.Mutex
+	byLedger map[string][]PeriodCloseRecord
+	ledgers  map[string]string
+}
+
+func (x *closedPeriodIndex) invalidate() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.byLedger = nil
+}
+
+// containing returns, per ledger, the closed period that contains at.
+func (x *closedPeriodIndex) containing(at time.Time) (map[string]PeriodCloseRecord, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.byLedger == nil {
+		records, err := x.store.List()
+		if err != nil {
+			return nil, err
+		}
+		byLedger := make(map[string][]PeriodCloseRecord)
+		for _, r := range records {
+			byLedger[r.LedgerID] = append(byLedger[r.LedgerID], r)
+		}
+		for _, rs := range byLedger {
+			sort.Slice(rs, func(i, j int) bool { return rs[i].End.Before(rs[j].End) })
+		}
+		x.byLedger = byLedger
+	}
+
+	var out map[string]PeriodCloseRecord
+	for ledger, rs := range x.byLedger {
+		i := sort.Search(len(rs), func(i int) bool { return at.Before(rs[i].End) })
+		for ; i < len(rs); i++ {
+			if rs[i].Contains(at) {
+				if out == nil {
+					out = make(map[string]PeriodCloseRecord)
+				}
+				out[ledger] = rs[i]
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// covering returns the record in closed that covers the ledger of one of the
+// transaction's balances, or nil.
+func (x *closedPeriodIndex) covering(closed map[string]PeriodCloseRecord, t CreateTransactionRequest) (*PeriodCloseRecord, error) {
+	if r, ok := closed[""]; ok {
+		return &r, nil
+	}
+	ids := []string{t.Source, t.Destination}
+	for _, leg := range t.Sources {
+		ids = append(ids, leg.Identifier)
+	}
+	for _, leg := range t.Destinations {
+		ids = append(ids, leg.Identifier)
+	}
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		ledger, err := x.ledgerOf(id, t.Currency)
+		if err != nil {
+			return nil, err
+		}
+		if r, ok := closed[ledger]; ok {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+// ledgerOf looks up the ledger of a balance ID or indicator. A balance that
+// does not exist yet belongs to no closed ledger and is not cached.
+func (x *closedPeriodIndex) ledgerOf(id, currency string) (string, error) {
+	key := id
+	if strings.HasPrefix(id, "@") {
+		key = id + "/" + currency
+	}
+	x.mu.Lock()
+	ledger, ok := x.ledgers[key]
+	x.mu.Unlock()
+	if ok {
+		return ledger, nil
+	}
+
+	var (
+		balance *LedgerBalance
+		resp    *http.Response
+		err     error
+	)
+	if strings.HasPrefix(id, "@") {
+		balance, resp, err = x.balances.GetByIndicator(id, currency)
+	} else {
+		balance, resp, err = x.balances.Get(id)
+	}
+	if isNotFound(resp, err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("period close: ledger of balance %s: %w", id, err)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.ledgers == nil {
+		x.ledgers = make(map[string]string)
+	}
+	x.ledgers[key] = balance.LedgerID
+	return balance.LedgerID, nil
+}
+
+// PeriodCloser snapshots a ledger at a period end, posts closing entries and
+// records the close.
+type PeriodCloser struct {
+	transactions *TransactionService
+	balances     *LedgerBalanceService
+	store        PeriodCloseStore
+}
+
+func NewPeriodCloser(transactions *TransactionService, balances *LedgerBalanceService, store PeriodCloseStore) *PeriodCloser {
+	return &PeriodCloser{transactions: transactions, balances: balances, store: store}
+}
+
+// ValidatePeriodCloseRequest checks the period and rules.
+func ValidatePeriodCloseRequest(r PeriodCloseRequest) error {
+	if strings.TrimSpace(r.ID) == "" {
+		return errors.New("validation error: period close id is required")
+	}
+	if r.LedgerID == "" {
+		return errors.New("validation error: ledger id is required")
+	}
+	if r.Start.IsZero() || !r.Start.Before(r.End) {
+		return errors.New("validation error: period start must be before its end")
+	}
+	for i, rule := range r.Rules {
+		if rule.Match == nil || rule.Target == "" {
+			return fmt.Errorf("validation error: closing rule at index %d needs a match and a target", i)
+		}
+	}
+	return nil
+}
+
+// Close runs the close: it takes a balance snapshot, captures every ledger
+// balance as of End, posts closing entries atomically with an effective date
+// just before End, and saves the record. Transaction services configured with
+// SetClosedPeriods(store) then reject back-dated postings into the period.
+//
+// Closing entry references are deterministic, so if a previous attempt posted
+// the entries but failed to save the record, a retry finds them by reference,
+// treats the batch as already posted and saves the record.
+func (c *PeriodCloser) Close(r PeriodCloseRequest) (*PeriodCloseRecord, error) {
+	if err := ValidatePeriodCloseRequest(r); err != nil {
+		return nil, err
+	}
+	existing, err := c.store.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range existing {
+		if e.ID == r.ID {
+			return nil, fmt.Errorf("%w: %s already recorded", ErrPeriodClosed, r.ID)
+		}
+		if e.LedgerID == r.LedgerID && r.Start.Before(e.End) && e.Start.Before(r.End) {
+			return nil, fmt.Errorf("%w: period overlaps %s", ErrPeriodClosed, e.ID)
+		}
+	}
+
+	record := &PeriodCloseRecord{ID: r.ID, LedgerID: r.LedgerID, Start: r.Start, End: r.End}
+	if !r.SkipSnapshot {
+		snapshot, _, err := c.balances.CreateSnapshot(CreateBalanceSnapshotRequest{})
+		if err != nil {
+			return nil, fmt.Errorf("period close: snapshot failed: %w", err)
+		}
+		record.SnapshotMessage = snapshot.Message
+	}
+
+	balances, err := filterAll[LedgerBalance](c.balances.Filter, FilterParams{
+		Filters:   []Filter{{Field: "ledger_id", Operator: OpEqual, Value: r.LedgerID}},
+		SortBy:    "created_at",
+		SortOrder: "asc",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	effective := r.End.Add(-time.Second)
+	for _, b := range balances {
+		historical, _, err := c.balances.GetHistorical(b.BalanceID, r.End, r.FromSource)
+		if err != nil {
+			return nil, fmt.Errorf("period close: historical balance %s: %w", b.BalanceID, err)
+		}
+		at := PeriodCloseBalance{
+			BalanceID:     b.BalanceID,
+			Indicator:     b.Indicator,
+			Currency:      b.Currency,
+			Balance:       cloneBigInt(historical.Balance.Balance),
+			CreditBalance: cloneBigInt(historical.Balance.CreditBalance),
+			DebitBalance:  cloneBigInt(historical.Balance.DebitBalance),
+		}
+		record.Balances = append(record.Balances, at)
+
+		for _, rule := range r.Rules {
+			if !rule.Match(b) {
+				continue
+			}
+			if entry, ok := closingEntry(r, rule, at, effective); ok {
+				record.Entries = append(record.Entries, entry)
+			}
+			break
+		}
+	}
+
+	if len(record.Entries) > 0 {
+		batch, _, err := c.transactions.CreateBulk(CreateBulkTransactionRequest{Transactions: record.Entries, Atomic: true})
+		if err != nil {
+			if !c.entriesPosted(record.Entries) {
+				return nil, fmt.Errorf("period close: closing entries failed: %w", err)
+			}
+		} else {
+			record.BatchID = batch.BatchID
+		}
+	}
+
+	record.ClosedAt = time.Now().UTC()
+	if err := c.store.Save(*record); err != nil {
+		return nil, err
+	}
+	c.transactions.invalidateClosedPeriods()
+	return record, nil
+}
+
+// entriesPosted reports whether every closing entry already exists in Core,
+// as after an earlier Close that posted the batch but did not save its record.
+func (c *PeriodCloser) entriesPosted(entries []CreateTransactionRequest) bool {
+	for _, e := range entries {
+		if _, _, err := c.transactions.GetByReference(e.Reference); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// closingEntry zeroes b against the rule target: positive balances are moved
+// out to the target and negative balances are refilled from it.
+func closingEntry(r PeriodCloseRequest, rule ClosingRule, b PeriodCloseBalance, effective time.Time) (CreateTransactionRequest, bool) {
+	if b.Balance.Sign() == 0 || b.BalanceID == rule.Target {
+		return CreateTransactionRequest{}, false
+	}
+	precision := r.Precision
+	if precision == 0 {
+		precision = 1
+	}
+	source, destination := b.BalanceID, rule.Target
+	if b.Balance.Sign() < 0 {
+		source, destination = destination, source
+	}
+	description := rule.Description
+	if description == "" {
+		description = fmt.Sprintf("Closing entry %s for %s", rule.Name, r.ID)
+	}
+	return CreateTransactionRequest{
+		ParentTransaction: ParentTransaction{
+			PreciseAmount: new(big.Int).Abs(b.Balance),
+			Precision:     precision,
+			Reference:     fmt.Sprintf("%s_close_%s", r.ID, b.BalanceID),
+			Description:   description,
+			Currency:      b.Currency,
+			Source:        source,
+			Destination:   destination,
+			SkipQueue:     true,
+			EffectiveDate: &effective,
+			MetaData:      MetaData{PeriodCloseMetaKey: r.ID, "closing_rule": rule.Name},
+		},
+		AllowOverdraft: true,
+	}, true
+}
+
+// MemoryPeriodCloseStore keeps close records in memory.
+type MemoryPeriodCloseStore struct {
+	records []PeriodCloseRecord
+	mu      sync.Mutex
+}
+
+func NewMemoryPeriodCloseStore() *MemoryPeriodCloseStore {
+	return &MemoryPeriodCloseStore{}
+}
+
+func (s *MemoryPeriodCloseStore) Save(record PeriodCloseRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *MemoryPeriodCloseStore) List() ([]PeriodCloseRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]PeriodCloseRecord, len(s.records))
+	copy(out, s.records)
+	return out, nil
+}
+
+// FilePeriodCloseStore keeps close records in a JSON file, rewritten atomically
+// on every save.
+type FilePeriodCloseStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFilePeriodCloseStore(path string) *FilePeriodCloseStore {
+	return &FilePeriodCloseStore{path: path}
+}
+
+func (s *FilePeriodCloseStore) read() ([]PeriodCloseRecord, error) {
+	var records []PeriodCloseRecord
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(data) == 0) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to read period close records %s: %w", s.path, err)
+	}
+	return records, nil
+}
+
+func (s *FilePeriodCloseStore) Save(record PeriodCloseRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, err := s.read()
+	if err != nil {
+		return err
+	}
+	records = append(records, record)
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Start.Before(records[j].Start) })
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *FilePeriodCloseStore) List() ([]PeriodCloseRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read()
+}
@@ -0,0 +1,235 @@
+package blnkgo_test
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	juneStart = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	juneEnd   = time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func juneClose() blnkgo.PeriodCloseRequest {
+	return blnkgo.PeriodCloseRequest{
+		ID:        "2024-06",
+		LedgerID:  "ldg_gl",
+		Start:     juneStart,
+		End:       juneEnd,
+		Precision: 100,
+		Rules: []blnkgo.ClosingRule{{
+			Name: "income_summary",
+			Match: func(b blnkgo.LedgerBalance) bool {
+				return b.MetaData["type"] == "income" || b.MetaData["type"] == "expense"
+			},
+			Target: "bln_retained_earnings",
+		}},
+	}
+}
+
+func mockPeriodClose(mockClient *MockClient) *blnkgo.CreateBulkTransactionRequest {
+	mockClient.On("NewRequest", "balances-snapshots", http.MethodPost, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.CreateBalanceSnapshotResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.CreateBalanceSnapshotResponse).Message = "snapshot started"
+	})
+	mockClient.On("NewRequest", "balances/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.FilterResponse).Data = []interface{}{
+			map[string]interface{}{"balance_id": "bln_sales", "currency": "USD", "meta_data": map[string]interface{}{"type": "income"}},
+			map[string]interface{}{"balance_id": "bln_rent", "currency": "USD", "meta_data": map[string]interface{}{"type": "expense"}},
+			map[string]interface{}{"balance_id": "bln_cash", "currency": "USD", "meta_data": map[string]interface{}{"type": "asset"}},
+		}
+	})
+
+	var path string
+	mockClient.On("NewRequest", mock.MatchedBy(func(p string) bool { return strings.Contains(p, "/at?timestamp=") }), http.MethodGet, nil).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		path = args.String(0)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalanceHistorical")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		h := args.Get(1).(*blnkgo.LedgerBalanceHistorical)
+		switch {
+		case strings.HasPrefix(path, "balances/bln_sales/"):
+			h.Balance.Balance = big.NewInt(50000)
+		case strings.HasPrefix(path, "balances/bln_rent/"):
+			h.Balance.Balance = big.NewInt(-20000)
+		default:
+			h.Balance.Balance = big.NewInt(90000)
+		}
+	})
+
+	sent := &blnkgo.CreateBulkTransactionRequest{}
+	mockClient.On("NewRequest", "transactions/bulk", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		*sent = args.Get(2).(blnkgo.CreateBulkTransactionRequest)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.CreateBulkTransactionResponse")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.CreateBulkTransactionResponse).BatchID = "batch_close"
+	})
+	return sent
+}
+
+func TestPeriodCloser_Close(t *testing.T) {
+	mockClient := &MockClient{}
+	transactions := blnkgo.NewTransactionService(mockClient)
+	store := blnkgo.NewMemoryPeriodCloseStore()
+	closer := blnkgo.NewPeriodCloser(transactions, blnkgo.NewLedgerBalanceService(mockClient), store)
+	sent := mockPeriodClose(mockClient)
+
+	record, err := closer.Close(juneClose())
+	require.NoError(t, err)
+	assert.Equal(t, "snapshot started", record.SnapshotMessage)
+	assert.Len(t, record.Balances, 3)
+	assert.Equal(t, "batch_close", record.BatchID)
+
+	require.Len(t, sent.Transactions, 2)
+	assert.True(t, sent.Atomic)
+	sales, rent := sent.Transactions[0], sent.Transactions[1]
+	assert.Equal(t, "bln_sales", sales.Source)
+	assert.Equal(t, "bln_retained_earnings", sales.Destination)
+	assert.Equal(t, "50000", sales.PreciseAmount.String())
+	assert.Equal(t, "bln_retained_earnings", rent.Source)
+	assert.Equal(t, "bln_rent", rent.Destination)
+	assert.Equal(t, "20000", rent.PreciseAmount.String())
+	assert.Equal(t, juneEnd.Add(-time.Second), *rent.EffectiveDate)
+
+	records, _ := store.List()
+	assert.Len(t, records, 1)
+
+	overlapping := juneClose()
+	overlapping.ID = "2024-06-late"
+	overlapping.Start = juneStart.AddDate(0, 0, 15)
+	overlapping.End = juneEnd.AddDate(0, 0, 15)
+	_, err = closer.Close(overlapping)
+	assert.True(t, errors.Is(err, blnkgo.ErrPeriodClosed))
+}
+
+func TestPeriodCloser_CloseResumesAfterPostedBatch(t *testing.T) {
+	mockClient := &MockClient{}
+	store := blnkgo.NewMemoryPeriodCloseStore()
+	closer := blnkgo.NewPeriodCloser(blnkgo.NewTransactionService(mockClient), blnkgo.NewLedgerBalanceService(mockClient), store)
+	mockClient.On("NewRequest", "transactions/bulk", http.MethodPost, mock.Anything).Return(nil, errors.New("reference 2024-06_close_bln_sales already exists"))
+	mockPeriodClose(mockClient)
+	mockClient.On("NewRequest", mock.MatchedBy(func(p string) bool { return strings.HasPrefix(p, "transactions/reference/2024-06_close_") }), http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusOK}, nil)
+
+	record, err := closer.Close(juneClose())
+	require.NoError(t, err)
+	assert.Len(t, record.Entries, 2)
+	assert.Empty(t, record.BatchID)
+	records, _ := store.List()
+	assert.Len(t, records, 1)
+	mockClient.AssertNumberOfCalls(t, "CallWithRetry", 1+1+3+2)
+}
+
+// countingPeriodCloseStore counts List calls to check that records are cached.
+type countingPeriodCloseStore struct {
+	blnkgo.PeriodCloseStore
+	lists int
+}
+
+func (s *countingPeriodCloseStore) List() ([]blnkgo.PeriodCloseRecord, error) {
+	s.lists++
+	return s.PeriodCloseStore.List()
+}
+
+// mockBalanceLedgers answers balance lookups by ID or indicator with the
+// given ledger.
+func mockBalanceLedgers(mockClient *MockClient, ledgers map[string]string) {
+	for id, ledger := range ledgers {
+		path := "balances/" + id
+		if strings.HasPrefix(id, "@") {
+			path = "balances/indicator/" + id + "/currency/USD"
+		}
+		ledger := ledger
+		mockClient.On("NewRequest", path, http.MethodGet, nil).Return(&http.Request{URL: &url.URL{Path: path}}, nil)
+		mockClient.On("CallWithRetry", onChartPath(path), mock.AnythingOfType("*blnkgo.LedgerBalance")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+			args.Get(1).(*blnkgo.LedgerBalance).LedgerID = ledger
+		})
+	}
+}
+
+func TestTransactionService_RejectsClosedPeriods(t *testing.T) {
+	mockClient, svc := setupTransactionService()
+	store := &countingPeriodCloseStore{PeriodCloseStore: blnkgo.NewFilePeriodCloseStore(filepath.Join(t.TempDir(), "closes.json"))}
+	require.NoError(t, store.Save(blnkgo.PeriodCloseRecord{
+		ID: "2024-06", LedgerID: "ldg_gl", Start: juneStart, End: juneEnd,
+		Balances: []blnkgo.PeriodCloseBalance{{BalanceID: "bln_a"}, {BalanceID: "bln_fees", Indicator: "@fees"}},
+	}))
+	svc.SetClosedPeriods(store)
+	mockBalanceLedgers(mockClient, map[string]string{
+		"bln_a": "ldg_gl", "bln_b": "ldg_gl", "bln_c": "ldg_other", "bln_d": "ldg_other",
+		"@fees": "ldg_gl", "bln_new": "ldg_gl",
+	})
+
+	backdated := juneStart.AddDate(0, 0, 10)
+	body := blnkgo.CreateTransactionRequest{ParentTransaction: blnkgo.ParentTransaction{
+		Amount: 10, Precision: 100, Currency: "USD", Reference: "late_invoice",
+		Source: "bln_a", Destination: "bln_b", EffectiveDate: &backdated,
+	}}
+	_, _, err := svc.Create(body)
+	assert.True(t, errors.Is(err, blnkgo.ErrPeriodClosed))
+
+	_, _, err = svc.CreateBulk(blnkgo.CreateBulkTransactionRequest{Transactions: []blnkgo.CreateTransactionRequest{body}})
+	assert.True(t, errors.Is(err, blnkgo.ErrPeriodClosed))
+	mockClient.AssertNotCalled(t, "NewRequest", mock.Anything, http.MethodPost, mock.Anything)
+
+	indicator := body
+	indicator.Source, indicator.Destination = "bln_c", "@fees"
+	_, _, err = svc.Create(indicator)
+	assert.True(t, errors.Is(err, blnkgo.ErrPeriodClosed))
+
+	// bln_new was created in the closed ledger after the close, so it is not
+	// among the captured balances but is still covered.
+	createdLater := body
+	createdLater.Source, createdLater.Destination = "bln_new", "bln_c"
+	_, _, err = svc.Create(createdLater)
+	assert.True(t, errors.Is(err, blnkgo.ErrPeriodClosed))
+
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusCreated}, nil)
+
+	otherLedger := body
+	otherLedger.Source, otherLedger.Destination = "bln_c", "bln_d"
+	_, _, err = svc.Create(otherLedger)
+	assert.NoError(t, err)
+
+	open := juneEnd
+	body.EffectiveDate = &open
+	_, _, err = svc.Create(body)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, store.lists)
+	// bln_a, bln_c, @fees, bln_new and bln_d are looked up once each.
+	mockClient.AssertNumberOfCalls(t, "NewRequest", 5+2)
+}
+
+func TestPeriodCloser_CloseRefreshesClosedPeriods(t *testing.T) {
+	mockClient := &MockClient{}
+	transactions := blnkgo.NewTransactionService(mockClient)
+	store := blnkgo.NewMemoryPeriodCloseStore()
+	transactions.SetClosedPeriods(store)
+	closer := blnkgo.NewPeriodCloser(transactions, blnkgo.NewLedgerBalanceService(mockClient), store)
+	mockBalanceLedgers(mockClient, map[string]string{"bln_cash": "ldg_gl", "bln_sales": "ldg_gl"})
+
+	backdated := juneStart.AddDate(0, 0, 10)
+	late := blnkgo.CreateTransactionRequest{ParentTransaction: blnkgo.ParentTransaction{
+		Amount: 10, Precision: 100, Currency: "USD", Reference: "late_sale",
+		Source: "bln_cash", Destination: "bln_sales", EffectiveDate: &backdated,
+	}}
+	mockPeriodClose(mockClient)
+	_, err := closer.Close(juneClose())
+	require.NoError(t, err)
+
+	_, _, err = transactions.Create(late)
+	assert.True(t, errors.Is(err, blnkgo.ErrPeriodClosed))
+}
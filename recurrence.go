@@ -0,0 +1,246 @@
+package blnkgo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence produces the occurrences of a repeating schedule.
+type Recurrence interface {
+	// Next returns the first occurrence strictly after the given time, or the
+	// zero time when the schedule has no further occurrences.
+	Next(after time.Time) time.Time
+}
+
+// IntervalRecurrence repeats every Months/Days (calendar arithmetic in Location,
+// so wall-clock times survive DST changes) plus Every (elapsed time), anchored
+// at Start. Start itself is the first occurrence. Monthly steps keep the day of
+// Start, clamped to the last day of shorter months (Jan 31, Feb 28, Mar 31).
+type IntervalRecurrence struct {
+	Start    time.Time
+	Every    time.Duration
+	Days     int
+	Months   int
+	Location *time.Location
+}
+
+// EveryInterval returns an IntervalRecurrence repeating every d from start.
+func EveryInterval(start time.Time, d time.Duration) IntervalRecurrence {
+	return IntervalRecurrence{Start: start, Every: d}
+}
+
+// EveryDays returns an IntervalRecurrence repeating every n days at the wall-clock
+// time of start in loc.
+func EveryDays(start time.Time, n int, loc *time.Location) IntervalRecurrence {
+	return IntervalRecurrence{Start: start, Days: n, Location: loc}
+}
+
+// EveryMonths returns an IntervalRecurrence repeating every n months at the
+// wall-clock time of start in loc.
+func EveryMonths(start time.Time, n int, loc *time.Location) IntervalRecurrence {
+	return IntervalRecurrence{Start: start, Months: n, Location: loc}
+}
+
+func (r IntervalRecurrence) validate() error {
+	if r.Start.IsZero() {
+		return errors.New("recurrence error: start is required")
+	}
+	if r.Every < 0 || r.Days < 0 || r.Months < 0 {
+		return errors.New("recurrence error: interval must be positive")
+	}
+	if r.Every == 0 && r.Days == 0 && r.Months == 0 {
+		return errors.New("recurrence error: interval must be positive")
+	}
+	return nil
+}
+
+func (r IntervalRecurrence) occurrence(n int) time.Time {
+	loc := r.Location
+	if loc == nil {
+		loc = r.Start.Location()
+	}
+	t := r.Start.In(loc)
+	if r.Months != 0 {
+		year, month, day := t.Date()
+		first := time.Date(year, month+time.Month(n*r.Months), 1, 0, 0, 0, 0, loc)
+		if last := first.AddDate(0, 1, -1).Day(); day > last {
+			day = last
+		}
+		t = time.Date(first.Year(), first.Month(), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+	}
+	return t.AddDate(0, 0, n*r.Days).Add(time.Duration(n) * r.Every)
+}
+
+func (r IntervalRecurrence) Next(after time.Time) time.Time {
+	if r.validate() != nil {
+		return time.Time{}
+	}
+	if after.Before(r.Start) {
+		return r.occurrence(0)
+	}
+
+	// Jump using an upper bound on the period so occurrence(n) never overshoots,
+	// then step forward.
+	period := r.Every + time.Duration(r.Days)*25*time.Hour + time.Duration(r.Months)*31*25*time.Hour
+	n := int(after.Sub(r.Start) / period)
+	for {
+		t := r.occurrence(n)
+		if t.After(after) {
+			return t
+		}
+		n++
+	}
+}
+
+// CronRecurrence is a five-field cron expression (minute hour day-of-month month
+// day-of-week) evaluated in Location. Fields accept *, lists, ranges and steps;
+// the descriptors @hourly, @daily, @weekly, @monthly and @yearly are also
+// accepted. As in cron, when both day fields are restricted a day matches if
+// either does.
+type CronRecurrence struct {
+	Expression string
+	Location   *time.Location
+
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a cron expression evaluated in loc (UTC when nil).
+func ParseCron(expr string, loc *time.Location) (*CronRecurrence, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	spec := strings.TrimSpace(expr)
+	if d, ok := cronDescriptors[spec]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("recurrence error: cron expression %q must have 5 fields", expr)
+	}
+
+	c := &CronRecurrence{Expression: expr, Location: loc}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = fields[2] == "*" || fields[2] == "?"
+	c.dowStar = fields[4] == "*" || fields[4] == "?"
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("recurrence error: invalid step in cron field %q", field)
+			}
+			step = s
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		switch {
+		case part == "*" || part == "?":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("recurrence error: invalid range in cron field %q", field)
+			}
+		default:
+			v, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("recurrence error: invalid value in cron field %q", field)
+			}
+			lo = v
+			if step > 1 {
+				hi = max
+			} else {
+				hi = v
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("recurrence error: cron field %q out of range %d-%d", field, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *CronRecurrence) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func (c *CronRecurrence) Next(after time.Time) time.Time {
+	loc := c.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t := after.In(loc).Truncate(time.Second)
+	t = t.Add(time.Duration(60-t.Second()) * time.Second)
+
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,120 @@
+package blnkgo_test
+
+import (
+	"testing"
+	"time"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntervalRecurrence_Next(t *testing.T) {
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	r := blnkgo.EveryInterval(start, 6*time.Hour)
+
+	assert.Equal(t, start, r.Next(start.Add(-time.Minute)))
+	assert.Equal(t, start.Add(6*time.Hour), r.Next(start))
+	assert.Equal(t, start.Add(1000*6*time.Hour), r.Next(start.Add(999*6*time.Hour+time.Second)))
+}
+
+func TestIntervalRecurrence_DaysKeepWallClockAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	start := time.Date(2026, 3, 7, 9, 0, 0, 0, loc)
+	r := blnkgo.EveryDays(start, 1, loc)
+
+	next := r.Next(start)
+	assert.Equal(t, 9, next.In(loc).Hour())
+	assert.Equal(t, 8, next.In(loc).Day())
+	assert.Equal(t, 23*time.Hour, next.Sub(start))
+}
+
+func TestIntervalRecurrence_Months(t *testing.T) {
+	start := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	r := blnkgo.EveryMonths(start, 1, time.UTC)
+
+	assert.Equal(t, time.Date(2026, 4, 15, 0, 0, 0, 0, time.UTC), r.Next(time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestIntervalRecurrence_MonthsClampToMonthEnd(t *testing.T) {
+	start := time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC)
+	r := blnkgo.EveryMonths(start, 1, time.UTC)
+
+	feb := r.Next(start)
+	assert.Equal(t, time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC), feb)
+	mar := r.Next(feb)
+	assert.Equal(t, time.Date(2024, 3, 31, 9, 0, 0, 0, time.UTC), mar)
+	assert.Equal(t, time.Date(2024, 4, 30, 9, 0, 0, 0, time.UTC), r.Next(mar))
+
+	nonLeap := blnkgo.EveryMonths(time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC), 1, time.UTC)
+	assert.Equal(t, time.Date(2025, 2, 28, 9, 0, 0, 0, time.UTC), nonLeap.Next(time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC)))
+	assert.Equal(t, time.Date(2025, 3, 31, 9, 0, 0, 0, time.UTC), nonLeap.Next(time.Date(2025, 2, 28, 9, 0, 0, 0, time.UTC)))
+}
+
+func TestParseCron_Next(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		after    time.Time
+		expected time.Time
+	}{
+		{
+			name:     "daily at 02:30",
+			expr:     "30 2 * * *",
+			after:    time.Date(2026, 5, 1, 3, 0, 0, 0, time.UTC),
+			expected: time.Date(2026, 5, 2, 2, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "every 15 minutes",
+			expr:     "*/15 * * * *",
+			after:    time.Date(2026, 5, 1, 3, 16, 10, 0, time.UTC),
+			expected: time.Date(2026, 5, 1, 3, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekdays at 09:00",
+			expr:     "0 9 * * 1-5",
+			after:    time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC), // Friday
+			expected: time.Date(2026, 5, 4, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "monthly descriptor",
+			expr:     "@monthly",
+			after:    time.Date(2026, 12, 15, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "strictly after",
+			expr:     "0 0 * * *",
+			after:    time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2026, 5, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := blnkgo.ParseCron(tt.expr, time.UTC)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, c.Next(tt.after))
+		})
+	}
+}
+
+func TestParseCron_TimeZone(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	c, err := blnkgo.ParseCron("0 8 * * *", loc)
+	require.NoError(t, err)
+
+	next := c.Next(time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2026, 7, 1, 6, 0, 0, 0, time.UTC), next.UTC())
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "a * * * *"} {
+		_, err := blnkgo.ParseCron(expr, nil)
+		assert.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,350 @@
+package blnkgo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RecurringTransaction is a transaction template posted on every occurrence of
+// Recurrence between StartAt and EndAt (inclusive, when set).
+type RecurringTransaction struct {
+	ID         string
+	Template   CreateTransactionRequest
+	Recurrence Recurrence
+	// StartAt bounds the first occurrence. Zero uses the time the schedule is
+	// first added, so no occurrences before registration are posted; that time
+	// is saved as the schedule's last run so a restarted Scheduler catches up
+	// from it.
+	StartAt time.Time
+	EndAt   *time.Time
+}
+
+// ScheduledOccurrence is one due execution of a RecurringTransaction.
+type ScheduledOccurrence struct {
+	ScheduleID string                   `json:"schedule_id"`
+	At         time.Time                `json:"at"`
+	Request    CreateTransactionRequest `json:"request"`
+}
+
+// SchedulerStore persists the last successfully posted occurrence per schedule
+// so missed runs can be caught up after downtime.
+type SchedulerStore interface {
+	LastRun(scheduleID string) (time.Time, bool, error)
+	SetLastRun(scheduleID string, at time.Time) error
+}
+
+// SchedulerOptions configures a Scheduler.
+type SchedulerOptions struct {
+	// MaxCatchUp caps the number of occurrences posted per schedule in one
+	// RunDue call; the rest are posted on later calls. Zero uses 100.
+	MaxCatchUp int
+	// Logger receives scheduling progress. Nil uses the default logger.
+	Logger Logger
+}
+
+// SchedulerRunResult summarises one RunDue call.
+type SchedulerRunResult struct {
+	Posted       []ScheduledOccurrence `json:"posted"`
+	AlreadyExist []ScheduledOccurrence `json:"already_exist,omitempty"`
+	Errors       map[string]error      `json:"-"`
+}
+
+// Scheduler posts recurring transactions. Each occurrence gets a deterministic
+// reference derived from the schedule and occurrence time, so re-running after a
+// crash never double-posts.
+type Scheduler struct {
+	transactions *TransactionService
+	store        SchedulerStore
+	options      SchedulerOptions
+	schedules    map[string]RecurringTransaction
+	mu           sync.Mutex
+}
+
+const defaultSchedulerMaxCatchUp = 100
+
+func NewScheduler(transactions *TransactionService, store SchedulerStore, options SchedulerOptions) *Scheduler {
+	if options.MaxCatchUp <= 0 {
+		options.MaxCatchUp = defaultSchedulerMaxCatchUp
+	}
+	if options.Logger == nil {
+		options.Logger = NewDefaultLogger()
+	}
+	return &Scheduler{
+		transactions: transactions,
+		store:        store,
+		options:      options,
+		schedules:    make(map[string]RecurringTransaction),
+	}
+}
+
+// Add registers a recurring transaction. The template is validated with a
+// sample reference.
+func (s *Scheduler) Add(r RecurringTransaction) error {
+	if r.ID == "" {
+		return errors.New("validation error: schedule id is required")
+	}
+	if r.Recurrence == nil {
+		return errors.New("validation error: recurrence is required")
+	}
+	if ir, ok := r.Recurrence.(IntervalRecurrence); ok {
+		if err := ir.validate(); err != nil {
+			return err
+		}
+	}
+	sample := r.Template
+	sample.Reference = OccurrenceReference(r, time.Now())
+	if err := ValidateCreateTransacation(sample); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.schedules[r.ID]; exists {
+		return fmt.Errorf("validation error: schedule %s already exists", r.ID)
+	}
+	if r.StartAt.IsZero() {
+		_, ok, err := s.store.LastRun(r.ID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if err := s.store.SetLastRun(r.ID, time.Now()); err != nil {
+				return err
+			}
+		}
+	}
+	s.schedules[r.ID] = r
+	return nil
+}
+
+// Remove unregisters a schedule. Stored last-run state is kept.
+func (s *Scheduler) Remove(scheduleID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.schedules, scheduleID)
+}
+
+// OccurrenceReference returns the deterministic reference used for the
+// occurrence of r at the given time: the template reference (or schedule ID)
+// suffixed with the occurrence time in UTC.
+func OccurrenceReference(r RecurringTransaction, at time.Time) string {
+	base := r.Template.Reference
+	if base == "" {
+		base = r.ID
+	}
+	return fmt.Sprintf("%s_%s", base, at.UTC().Format("20060102T150405Z"))
+}
+
+// Due returns the occurrences that should have run by now and have not been
+// recorded in the store, oldest first, at most MaxCatchUp per schedule.
+func (s *Scheduler) Due(now time.Time) ([]ScheduledOccurrence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.due(now)
+}
+
+func (s *Scheduler) due(now time.Time) ([]ScheduledOccurrence, error) {
+	ids := make([]string, 0, len(s.schedules))
+	for id := range s.schedules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var due []ScheduledOccurrence
+	for _, id := range ids {
+		r := s.schedules[id]
+		cursor := r.StartAt.Add(-time.Nanosecond)
+		last, ok, err := s.store.LastRun(id)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case ok && (r.StartAt.IsZero() || !last.Before(cursor)):
+			cursor = last
+		case r.StartAt.IsZero():
+			cursor = now
+		}
+
+		for n := 0; n < s.options.MaxCatchUp; n++ {
+			at := r.Recurrence.Next(cursor)
+			if at.IsZero() || at.After(now) || (r.EndAt != nil && at.After(*r.EndAt)) {
+				break
+			}
+			due = append(due, ScheduledOccurrence{ScheduleID: id, At: at, Request: renderOccurrence(r, at)})
+			cursor = at
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].At.Before(due[j].At) })
+	return due, nil
+}
+
+func renderOccurrence(r RecurringTransaction, at time.Time) CreateTransactionRequest {
+	req := r.Template
+	req.Reference = OccurrenceReference(r, at)
+	if req.EffectiveDate == nil {
+		effective := at
+		req.EffectiveDate = &effective
+	}
+	meta := make(MetaData, len(r.Template.MetaData)+2)
+	for k, v := range r.Template.MetaData {
+		meta[k] = v
+	}
+	meta["schedule_id"] = r.ID
+	meta["schedule_occurrence"] = at.UTC().Format(time.RFC3339)
+	req.MetaData = meta
+	return req
+}
+
+// RunDue posts every due occurrence. Within a schedule occurrences are posted
+// oldest first and the schedule stops at its first failure so no occurrence is
+// skipped; other schedules continue. A duplicate reference is treated as already
+// posted.
+func (s *Scheduler) RunDue(now time.Time) (*SchedulerRunResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due, err := s.due(now)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SchedulerRunResult{Errors: make(map[string]error)}
+	for _, occ := range due {
+		if _, failed := result.Errors[occ.ScheduleID]; failed {
+			continue
+		}
+
+		_, _, err := s.transactions.Create(occ.Request)
+		if err != nil {
+			if _, _, lookupErr := s.transactions.GetByReference(occ.Request.Reference); lookupErr != nil {
+				s.options.Logger.Error(fmt.Sprintf("scheduler: %s at %s failed: %v", occ.ScheduleID, occ.At.Format(time.RFC3339), err))
+				result.Errors[occ.ScheduleID] = err
+				continue
+			}
+			result.AlreadyExist = append(result.AlreadyExist, occ)
+		} else {
+			result.Posted = append(result.Posted, occ)
+		}
+
+		if err := s.store.SetLastRun(occ.ScheduleID, occ.At); err != nil {
+			return result, err
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		return result, fmt.Errorf("scheduler: %d schedule(s) failed", len(result.Errors))
+	}
+	return result, nil
+}
+
+// Run calls RunDue every interval until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("validation error: scheduler interval must be positive")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.RunDue(time.Now()); err != nil {
+			s.options.Logger.Error(err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// MemorySchedulerStore keeps last-run state in memory.
+type MemorySchedulerStore struct {
+	lastRun map[string]time.Time
+	mu      sync.Mutex
+}
+
+func NewMemorySchedulerStore() *MemorySchedulerStore {
+	return &MemorySchedulerStore{lastRun: make(map[string]time.Time)}
+}
+
+func (s *MemorySchedulerStore) LastRun(scheduleID string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.lastRun[scheduleID]
+	return t, ok, nil
+}
+
+func (s *MemorySchedulerStore) SetLastRun(scheduleID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRun[scheduleID] = at
+	return nil
+}
+
+// FileSchedulerStore keeps last-run state in a JSON file, rewritten atomically
+// on every update.
+type FileSchedulerStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileSchedulerStore(path string) *FileSchedulerStore {
+	return &FileSchedulerStore{path: path}
+}
+
+func (s *FileSchedulerStore) read() (map[string]time.Time, error) {
+	state := make(map[string]time.Time)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return state, nil
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to read scheduler state %s: %w", s.path, err)
+	}
+	return state, nil
+}
+
+func (s *FileSchedulerStore) LastRun(scheduleID string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.read()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	t, ok := state[scheduleID]
+	return t, ok, nil
+}
+
+func (s *FileSchedulerStore) SetLastRun(scheduleID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.read()
+	if err != nil {
+		return err
+	}
+	state[scheduleID] = at
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,180 @@
+package blnkgo_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func setupScheduler(store blnkgo.SchedulerStore) (*MockClient, *blnkgo.Scheduler) {
+	mockClient := &MockClient{}
+	scheduler := blnkgo.NewScheduler(blnkgo.NewTransactionService(mockClient), store, blnkgo.SchedulerOptions{Logger: silentLogger{}})
+	return mockClient, scheduler
+}
+
+func recurringTemplate() blnkgo.CreateTransactionRequest {
+	return blnkgo.CreateTransactionRequest{
+		ParentTransaction: blnkgo.ParentTransaction{
+			Amount:      9.99,
+			Precision:   100,
+			Currency:    "USD",
+			Reference:   "sub_42",
+			Source:      "bln_customer",
+			Destination: "bln_merchant",
+			MetaData:    blnkgo.MetaData{"plan": "pro"},
+		},
+	}
+}
+
+func TestScheduler_CatchesUpMissedRuns(t *testing.T) {
+	store := blnkgo.NewMemorySchedulerStore()
+	mockClient, scheduler := setupScheduler(store)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, scheduler.Add(blnkgo.RecurringTransaction{
+		ID:         "subscription-42",
+		Template:   recurringTemplate(),
+		Recurrence: blnkgo.EveryDays(start, 1, time.UTC),
+		StartAt:    start,
+	}))
+
+	var references []string
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		body := args.Get(2).(blnkgo.CreateTransactionRequest)
+		references = append(references, body.Reference)
+		assert.Equal(t, "subscription-42", body.MetaData["schedule_id"])
+		assert.Equal(t, "pro", body.MetaData["plan"])
+		require.NotNil(t, body.EffectiveDate)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.Anything).Return(&http.Response{StatusCode: http.StatusCreated}, nil)
+
+	result, err := scheduler.RunDue(start.Add(2*24*time.Hour + time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, result.Posted, 3)
+	assert.Equal(t, []string{"sub_42_20260101T000000Z", "sub_42_20260102T000000Z", "sub_42_20260103T000000Z"}, references)
+
+	last, ok, err := store.LastRun("subscription-42")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(2*24*time.Hour), last)
+
+	// Nothing new is due until the next occurrence.
+	due, err := scheduler.Due(start.Add(2*24*time.Hour + 2*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, due)
+}
+
+func TestScheduler_StopsScheduleAtFirstFailure(t *testing.T) {
+	store := blnkgo.NewMemorySchedulerStore()
+	mockClient, scheduler := setupScheduler(store)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, scheduler.Add(blnkgo.RecurringTransaction{
+		ID:         "standing-order",
+		Template:   recurringTemplate(),
+		Recurrence: blnkgo.EveryInterval(start, time.Hour),
+		StartAt:    start,
+	}))
+
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("NewRequest", "transactions/reference/sub_42_20260101T000000Z", http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.Anything).Return((*http.Response)(nil), errors.New("connection refused"))
+
+	result, err := scheduler.RunDue(start.Add(3 * time.Hour))
+	assert.Error(t, err)
+	assert.Empty(t, result.Posted)
+	assert.Contains(t, result.Errors, "standing-order")
+	mockClient.AssertNumberOfCalls(t, "NewRequest", 2)
+
+	_, ok, _ := store.LastRun("standing-order")
+	assert.False(t, ok)
+}
+
+func TestScheduler_DuplicateReferenceTreatedAsPosted(t *testing.T) {
+	mockClient, scheduler := setupScheduler(blnkgo.NewMemorySchedulerStore())
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, scheduler.Add(blnkgo.RecurringTransaction{
+		ID:         "dup",
+		Template:   recurringTemplate(),
+		Recurrence: blnkgo.EveryInterval(start, time.Hour),
+		StartAt:    start,
+	}))
+
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("NewRequest", "transactions/reference/sub_42_20260101T000000Z", http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.Anything).Return(&http.Response{StatusCode: http.StatusBadRequest}, &blnkgo.ApiErrorResponse{Status: http.StatusBadRequest}).Once()
+	mockClient.On("CallWithRetry", mock.Anything, mock.Anything).Return(&http.Response{StatusCode: http.StatusOK}, nil)
+
+	result, err := scheduler.RunDue(start.Add(30 * time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, result.AlreadyExist, 1)
+}
+
+func TestScheduler_AddValidation(t *testing.T) {
+	_, scheduler := setupScheduler(blnkgo.NewMemorySchedulerStore())
+
+	assert.Error(t, scheduler.Add(blnkgo.RecurringTransaction{Template: recurringTemplate(), Recurrence: blnkgo.EveryInterval(time.Now(), time.Hour)}))
+	assert.Error(t, scheduler.Add(blnkgo.RecurringTransaction{ID: "x", Template: recurringTemplate()}))
+	assert.Error(t, scheduler.Add(blnkgo.RecurringTransaction{ID: "x", Template: blnkgo.CreateTransactionRequest{}, Recurrence: blnkgo.EveryInterval(time.Now(), time.Hour)}))
+	assert.Error(t, scheduler.Add(blnkgo.RecurringTransaction{ID: "x", Template: recurringTemplate(), Recurrence: blnkgo.EveryInterval(time.Now(), 0)}))
+
+	require.NoError(t, scheduler.Add(blnkgo.RecurringTransaction{ID: "x", Template: recurringTemplate(), Recurrence: blnkgo.EveryInterval(time.Now(), time.Hour)}))
+	assert.Error(t, scheduler.Add(blnkgo.RecurringTransaction{ID: "x", Template: recurringTemplate(), Recurrence: blnkgo.EveryInterval(time.Now(), time.Hour)}))
+}
+
+func TestScheduler_CatchesUpAfterRestart(t *testing.T) {
+	store := blnkgo.NewMemorySchedulerStore()
+	_, first := setupScheduler(store)
+	anchor := time.Now().Add(-5 * time.Hour).Truncate(time.Hour)
+	schedule := blnkgo.RecurringTransaction{
+		ID:         "hourly-sweep",
+		Template:   recurringTemplate(),
+		Recurrence: blnkgo.EveryInterval(anchor, time.Hour),
+	}
+	require.NoError(t, first.Add(schedule))
+	_, ok, err := store.LastRun("hourly-sweep")
+	require.NoError(t, err)
+	assert.True(t, ok, "defaulted StartAt is persisted")
+
+	// The previous process last posted at anchor, then went down.
+	require.NoError(t, store.SetLastRun("hourly-sweep", anchor))
+
+	_, restarted := setupScheduler(store)
+	require.NoError(t, restarted.Add(schedule))
+	due, err := restarted.Due(time.Now())
+	require.NoError(t, err)
+	require.Len(t, due, 5)
+	assert.Equal(t, anchor.Add(time.Hour), due[0].At)
+}
+
+func TestScheduler_RunRejectsNonPositiveInterval(t *testing.T) {
+	_, scheduler := setupScheduler(blnkgo.NewMemorySchedulerStore())
+	assert.ErrorContains(t, scheduler.Run(context.Background(), 0), "interval must be positive")
+}
+
+func TestFileSchedulerStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	store := blnkgo.NewFileSchedulerStore(path)
+
+	_, ok, err := store.LastRun("a")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	at := time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, store.SetLastRun("a", at))
+
+	reopened := blnkgo.NewFileSchedulerStore(path)
+	last, ok, err := reopened.LastRun("a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, at.Equal(last))
+}
@@ -0,0 +1,447 @@
+package blnkgo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// NettingMode selects how obligations are netted.
+type NettingMode string
+
+const (
+	// NettingBilateral nets each pair of participants separately.
+	NettingBilateral NettingMode = "bilateral"
+	// NettingMultilateral nets every participant against the group, producing
+	// at most one fewer transfer than there are participants per currency.
+	NettingMultilateral NettingMode = "multilateral"
+)
+
+// SettlementOptions configures netting and the settlement transfers generated
+// from it.
+type SettlementOptions struct {
+	Mode NettingMode
+	// Participants limits netting to these balances; empty includes every
+	// balance in the data.
+	Participants []string
+	// Accounts maps a participant to the balance its settlement transfers use,
+	// e.g. its bank clearing balance. Unmapped participants settle from their
+	// own balance.
+	Accounts map[string]string
+	// Offset posts each transfer from payee to payer on the position balances
+	// themselves, bringing the net positions back to zero, instead of moving
+	// funds from payer to payee.
+	Offset bool
+	// Reference prefixes settlement references as "<Reference>_<currency>_<n>".
+	Reference   string
+	Description string
+	Precision   int64
+	SkipQueue   bool
+	// Preview computes the settlement without posting it.
+	Preview bool
+}
+
+// NetPosition is a participant's net position in one currency, in minor units.
+// Positive positions receive funds and negative positions pay.
+type NetPosition struct {
+	Participant string   `json:"participant"`
+	Currency    string   `json:"currency"`
+	Amount      *big.Int `json:"amount"`
+}
+
+// NetObligation is an amount Payer must settle to Payee.
+type NetObligation struct {
+	Payer    string   `json:"payer"`
+	Payee    string   `json:"payee"`
+	Currency string   `json:"currency"`
+	Amount   *big.Int `json:"amount"`
+}
+
+// Settlement is the result of netting. Unmatched holds positions left over
+// when the participants in scope do not net to zero in a currency.
+type Settlement struct {
+	Mode         NettingMode                    `json:"mode"`
+	Preview      bool                           `json:"preview"`
+	Positions    []NetPosition                  `json:"positions"`
+	Obligations  []NetObligation                `json:"obligations"`
+	Unmatched    []NetPosition                  `json:"unmatched,omitempty"`
+	Transactions []CreateTransactionRequest     `json:"transactions"`
+	Batch        *CreateBulkTransactionResponse `json:"batch,omitempty"`
+}
+
+// ValidateSettlementOptions checks the netting mode and reference prefix.
+func ValidateSettlementOptions(o SettlementOptions) error {
+	if o.Mode != NettingBilateral && o.Mode != NettingMultilateral {
+		return fmt.Errorf("validation error: invalid netting mode: %s", o.Mode)
+	}
+	if o.Reference == "" {
+		return errors.New("validation error: settlement reference is required")
+	}
+	return nil
+}
+
+// NetTransactions nets the given transactions, treating each source as owing
+// its destination. Only applied and committed transactions between
+// participants are counted.
+func NetTransactions(transactions []Transaction, options SettlementOptions) (*Settlement, error) {
+	if err := ValidateSettlementOptions(options); err != nil {
+		return nil, err
+	}
+	inScope := participantSet(options.Participants)
+
+	// gross[currency][payer][payee]
+	gross := make(map[string]map[string]map[string]*big.Int)
+	for _, txn := range transactions {
+		if txn.Status != PryTransactionStatusApplied && txn.Status != PryTransactionStatusCommit {
+			continue
+		}
+		if txn.Source == "" || txn.Destination == "" || txn.Source == txn.Destination {
+			continue
+		}
+		if !inScope(txn.Source) || !inScope(txn.Destination) {
+			continue
+		}
+		amount, err := transactionPreciseAmount(txn.ParentTransaction)
+		if err != nil {
+			return nil, err
+		}
+		if gross[txn.Currency] == nil {
+			gross[txn.Currency] = make(map[string]map[string]*big.Int)
+		}
+		if gross[txn.Currency][txn.Source] == nil {
+			gross[txn.Currency][txn.Source] = make(map[string]*big.Int)
+		}
+		owed := gross[txn.Currency][txn.Source][txn.Destination]
+		if owed == nil {
+			owed = big.NewInt(0)
+			gross[txn.Currency][txn.Source][txn.Destination] = owed
+		}
+		owed.Add(owed, amount)
+	}
+
+	positions := make(map[string]map[string]*big.Int)
+	for currency, payers := range gross {
+		positions[currency] = make(map[string]*big.Int)
+		for payer, payees := range payers {
+			for payee, amount := range payees {
+				addPosition(positions[currency], payer, new(big.Int).Neg(amount))
+				addPosition(positions[currency], payee, amount)
+			}
+		}
+	}
+
+	settlement := &Settlement{Mode: options.Mode, Preview: options.Preview, Positions: sortedPositions(positions)}
+	if options.Mode == NettingMultilateral {
+		settlement.Obligations, settlement.Unmatched = multilateralObligations(positions)
+	} else {
+		settlement.Obligations = bilateralObligations(gross)
+	}
+	settlement.Transactions = settlementTransactions(settlement.Obligations, options)
+	return settlement, nil
+}
+
+// NetBalances nets balance positions multilaterally: positive balances receive
+// and negative balances pay. Balances carry no counterparty, so bilateral
+// netting is not supported.
+func NetBalances(balances []LedgerBalance, options SettlementOptions) (*Settlement, error) {
+	if err := ValidateSettlementOptions(options); err != nil {
+		return nil, err
+	}
+	if options.Mode != NettingMultilateral {
+		return nil, errors.New("validation error: balance netting requires multilateral mode")
+	}
+	inScope := participantSet(options.Participants)
+
+	positions := make(map[string]map[string]*big.Int)
+	for _, b := range balances {
+		if !inScope(b.BalanceID) || b.Balance == nil || b.Balance.Sign() == 0 {
+			continue
+		}
+		if positions[b.Currency] == nil {
+			positions[b.Currency] = make(map[string]*big.Int)
+		}
+		addPosition(positions[b.Currency], b.BalanceID, b.Balance)
+	}
+
+	settlement := &Settlement{Mode: options.Mode, Preview: options.Preview, Positions: sortedPositions(positions)}
+	settlement.Obligations, settlement.Unmatched = multilateralObligations(positions)
+	settlement.Transactions = settlementTransactions(settlement.Obligations, options)
+	return settlement, nil
+}
+
+// Netting reads positions from Core, nets them and posts the settlement
+// transfers as one atomic bulk request unless Preview is set.
+type Netting struct {
+	transactions *TransactionService
+	balances     *LedgerBalanceService
+}
+
+func NewNetting(transactions *TransactionService, balances *LedgerBalanceService) *Netting {
+	return &Netting{transactions: transactions, balances: balances}
+}
+
+// NetTransactions nets transactions created in [from, to). An empty Reference
+// defaults to "settlement_<to>" so re-running a period is rejected by Core.
+func (n *Netting) NetTransactions(from, to time.Time, options SettlementOptions) (*Settlement, error) {
+	if !from.Before(to) {
+		return nil, errors.New("validation error: settlement period start must be before its end")
+	}
+	if options.Reference == "" {
+		options.Reference = "settlement_" + to.UTC().Format("20060102T150405Z")
+	}
+	if err := ValidateSettlementOptions(options); err != nil {
+		return nil, err
+	}
+
+	filters := []Filter{
+		{Field: "created_at", Operator: OpGreaterThanOrEqual, Value: from.UTC().Format(time.RFC3339)},
+		{Field: "created_at", Operator: OpLessThan, Value: to.UTC().Format(time.RFC3339)},
+	}
+	if len(options.Participants) > 0 {
+		values := make([]interface{}, len(options.Participants))
+		for i, p := range options.Participants {
+			values[i] = p
+		}
+		filters = append(filters, Filter{Field: "source", Operator: OpIn, Values: values})
+	}
+	transactions, err := filterAll[Transaction](n.transactions.Filter, FilterParams{Filters: filters, SortBy: "created_at", SortOrder: "asc"})
+	if err != nil {
+		return nil, err
+	}
+
+	settlement, err := NetTransactions(transactions, options)
+	if err != nil {
+		return nil, err
+	}
+	return settlement, n.post(settlement, options)
+}
+
+// NetBalances nets the balances matched by filters, e.g. every balance in a
+// partner ledger. Balances have no period to derive a reference from, so
+// options.Reference is required; reuse it when retrying a run so Core rejects
+// the duplicate transfers.
+func (n *Netting) NetBalances(filters []Filter, options SettlementOptions) (*Settlement, error) {
+	if err := ValidateSettlementOptions(options); err != nil {
+		return nil, err
+	}
+	balances, err := filterAll[LedgerBalance](n.balances.Filter, FilterParams{Filters: filters})
+	if err != nil {
+		return nil, err
+	}
+	settlement, err := NetBalances(balances, options)
+	if err != nil {
+		return nil, err
+	}
+	return settlement, n.post(settlement, options)
+}
+
+func (n *Netting) post(settlement *Settlement, options SettlementOptions) error {
+	if options.Preview || len(settlement.Transactions) == 0 {
+		return nil
+	}
+	batch, _, err := n.transactions.CreateBulk(CreateBulkTransactionRequest{
+		Transactions: settlement.Transactions,
+		Atomic:       true,
+		SkipQueue:    options.SkipQueue,
+	})
+	if err != nil {
+		return err
+	}
+	settlement.Batch = batch
+	return nil
+}
+
+func participantSet(participants []string) func(string) bool {
+	if len(participants) == 0 {
+		return func(string) bool { return true }
+	}
+	set := make(map[string]struct{}, len(participants))
+	for _, p := range participants {
+		set[p] = struct{}{}
+	}
+	return func(id string) bool {
+		_, ok := set[id]
+		return ok
+	}
+}
+
+func addPosition(positions map[string]*big.Int, participant string, amount *big.Int) {
+	if positions[participant] == nil {
+		positions[participant] = big.NewInt(0)
+	}
+	positions[participant].Add(positions[participant], amount)
+}
+
+func sortedPositions(positions map[string]map[string]*big.Int) []NetPosition {
+	var out []NetPosition
+	for currency, byParticipant := range positions {
+		for participant, amount := range byParticipant {
+			out = append(out, NetPosition{Participant: participant, Currency: currency, Amount: new(big.Int).Set(amount)})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Currency != out[j].Currency {
+			return out[i].Currency < out[j].Currency
+		}
+		return out[i].Participant < out[j].Participant
+	})
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func bilateralObligations(gross map[string]map[string]map[string]*big.Int) []NetObligation {
+	var out []NetObligation
+	for _, currency := range sortedKeys(gross) {
+		payers := gross[currency]
+		pairs := make(map[[2]string]*big.Int)
+		for payer, payees := range payers {
+			for payee, amount := range payees {
+				a, b, sign := payer, payee, 1
+				if b < a {
+					a, b, sign = b, a, -1
+				}
+				key := [2]string{a, b}
+				if pairs[key] == nil {
+					pairs[key] = big.NewInt(0)
+				}
+				if sign > 0 {
+					pairs[key].Add(pairs[key], amount)
+				} else {
+					pairs[key].Sub(pairs[key], amount)
+				}
+			}
+		}
+		keys := make([][2]string, 0, len(pairs))
+		for k := range pairs {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i][0] != keys[j][0] {
+				return keys[i][0] < keys[j][0]
+			}
+			return keys[i][1] < keys[j][1]
+		})
+		for _, k := range keys {
+			net := pairs[k]
+			switch net.Sign() {
+			case 1:
+				out = append(out, NetObligation{Payer: k[0], Payee: k[1], Currency: currency, Amount: new(big.Int).Set(net)})
+			case -1:
+				out = append(out, NetObligation{Payer: k[1], Payee: k[0], Currency: currency, Amount: new(big.Int).Neg(net)})
+			}
+		}
+	}
+	return out
+}
+
+// multilateralObligations matches the largest payer with the largest payee
+// until one side is exhausted, which needs at most n-1 transfers per currency.
+func multilateralObligations(positions map[string]map[string]*big.Int) ([]NetObligation, []NetPosition) {
+	type party struct {
+		id     string
+		amount *big.Int
+	}
+	byAmount := func(parties []party) {
+		sort.Slice(parties, func(i, j int) bool {
+			if c := parties[i].amount.Cmp(parties[j].amount); c != 0 {
+				return c > 0
+			}
+			return parties[i].id < parties[j].id
+		})
+	}
+
+	var obligations []NetObligation
+	var unmatched []NetPosition
+	for _, currency := range sortedKeys(positions) {
+		var payers, payees []party
+		for id, amount := range positions[currency] {
+			switch amount.Sign() {
+			case -1:
+				payers = append(payers, party{id, new(big.Int).Neg(amount)})
+			case 1:
+				payees = append(payees, party{id, new(big.Int).Set(amount)})
+			}
+		}
+		byAmount(payers)
+		byAmount(payees)
+
+		i, j := 0, 0
+		for i < len(payers) && j < len(payees) {
+			amount := payers[i].amount
+			if payees[j].amount.Cmp(amount) < 0 {
+				amount = payees[j].amount
+			}
+			amount = new(big.Int).Set(amount)
+			obligations = append(obligations, NetObligation{Payer: payers[i].id, Payee: payees[j].id, Currency: currency, Amount: amount})
+			payers[i].amount.Sub(payers[i].amount, amount)
+			payees[j].amount.Sub(payees[j].amount, amount)
+			if payers[i].amount.Sign() == 0 {
+				i++
+			}
+			if payees[j].amount.Sign() == 0 {
+				j++
+			}
+		}
+		for ; i < len(payers); i++ {
+			unmatched = append(unmatched, NetPosition{Participant: payers[i].id, Currency: currency, Amount: new(big.Int).Neg(payers[i].amount)})
+		}
+		for ; j < len(payees); j++ {
+			unmatched = append(unmatched, NetPosition{Participant: payees[j].id, Currency: currency, Amount: payees[j].amount})
+		}
+	}
+	return obligations, unmatched
+}
+
+func settlementTransactions(obligations []NetObligation, options SettlementOptions) []CreateTransactionRequest {
+	precision := options.Precision
+	if precision == 0 {
+		precision = 1
+	}
+	account := func(participant string) string {
+		if a, ok := options.Accounts[participant]; ok && a != "" {
+			return a
+		}
+		return participant
+	}
+
+	counts := make(map[string]int)
+	out := make([]CreateTransactionRequest, 0, len(obligations))
+	for _, o := range obligations {
+		counts[o.Currency]++
+		source, destination := account(o.Payer), account(o.Payee)
+		if options.Offset {
+			source, destination = o.Payee, o.Payer
+		}
+		description := options.Description
+		if description == "" {
+			description = fmt.Sprintf("Settlement from %s to %s", o.Payer, o.Payee)
+		}
+		out = append(out, CreateTransactionRequest{
+			ParentTransaction: ParentTransaction{
+				PreciseAmount: new(big.Int).Set(o.Amount),
+				Precision:     precision,
+				Reference:     fmt.Sprintf("%s_%s_%d", options.Reference, o.Currency, counts[o.Currency]),
+				Description:   description,
+				Currency:      o.Currency,
+				Source:        source,
+				Destination:   destination,
+				MetaData: MetaData{
+					"settlement_reference": options.Reference,
+					"settlement_payer":     o.Payer,
+					"settlement_payee":     o.Payee,
+				},
+			},
+		})
+	}
+	return out
+}
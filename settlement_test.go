@@ -0,0 +1,153 @@
+package blnkgo_test
+
+import (
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func obligation(source, destination string, amount int64) blnkgo.Transaction {
+	return blnkgo.Transaction{ParentTransaction: blnkgo.ParentTransaction{
+		Source:        source,
+		Destination:   destination,
+		Currency:      "USD",
+		PreciseAmount: big.NewInt(amount),
+		Status:        blnkgo.PryTransactionStatusApplied,
+	}}
+}
+
+func partnerTransactions() []blnkgo.Transaction {
+	rejected := obligation("A", "C", 999)
+	rejected.Status = blnkgo.PryTransactionStatusRejected
+	return []blnkgo.Transaction{
+		obligation("A", "B", 100),
+		obligation("B", "A", 30),
+		obligation("B", "C", 50),
+		obligation("C", "A", 20),
+		obligation("A", "Z", 500),
+		rejected,
+	}
+}
+
+func TestNetTransactions_Bilateral(t *testing.T) {
+	s, err := blnkgo.NetTransactions(partnerTransactions(), blnkgo.SettlementOptions{
+		Mode:         blnkgo.NettingBilateral,
+		Participants: []string{"A", "B", "C"},
+		Reference:    "eod",
+	})
+	require.NoError(t, err)
+	require.Len(t, s.Obligations, 3)
+	assert.Equal(t, blnkgo.NetObligation{Payer: "A", Payee: "B", Currency: "USD", Amount: big.NewInt(70)}, s.Obligations[0])
+	assert.Equal(t, blnkgo.NetObligation{Payer: "C", Payee: "A", Currency: "USD", Amount: big.NewInt(20)}, s.Obligations[1])
+	assert.Equal(t, blnkgo.NetObligation{Payer: "B", Payee: "C", Currency: "USD", Amount: big.NewInt(50)}, s.Obligations[2])
+	assert.Equal(t, "eod_USD_1", s.Transactions[0].Reference)
+}
+
+func TestNetTransactions_Multilateral(t *testing.T) {
+	s, err := blnkgo.NetTransactions(partnerTransactions(), blnkgo.SettlementOptions{
+		Mode:         blnkgo.NettingMultilateral,
+		Participants: []string{"A", "B", "C"},
+		Reference:    "eod",
+		Accounts:     map[string]string{"A": "@bank_a"},
+	})
+	require.NoError(t, err)
+
+	// A: -100+30+20 = -50, B: +100-30-50 = 20, C: +50-20 = 30
+	require.Len(t, s.Obligations, 2)
+	assert.Equal(t, blnkgo.NetObligation{Payer: "A", Payee: "C", Currency: "USD", Amount: big.NewInt(30)}, s.Obligations[0])
+	assert.Equal(t, blnkgo.NetObligation{Payer: "A", Payee: "B", Currency: "USD", Amount: big.NewInt(20)}, s.Obligations[1])
+	assert.Empty(t, s.Unmatched)
+	assert.Equal(t, "@bank_a", s.Transactions[0].Source)
+	assert.Equal(t, "C", s.Transactions[0].Destination)
+	assert.Len(t, s.Positions, 3)
+}
+
+func TestNetBalances_Offset(t *testing.T) {
+	s, err := blnkgo.NetBalances([]blnkgo.LedgerBalance{
+		{BalanceID: "A", Currency: "USD", Balance: big.NewInt(-80)},
+		{BalanceID: "B", Currency: "USD", Balance: big.NewInt(50)},
+		{BalanceID: "C", Currency: "USD", Balance: big.NewInt(40)},
+	}, blnkgo.SettlementOptions{Mode: blnkgo.NettingMultilateral, Reference: "eod", Offset: true})
+	require.NoError(t, err)
+
+	require.Len(t, s.Obligations, 2)
+	assert.Equal(t, "B", s.Transactions[0].Source)
+	assert.Equal(t, "A", s.Transactions[0].Destination)
+	require.Len(t, s.Unmatched, 1)
+	assert.Equal(t, "C", s.Unmatched[0].Participant)
+	assert.Equal(t, "10", s.Unmatched[0].Amount.String())
+
+	_, err = blnkgo.NetBalances(nil, blnkgo.SettlementOptions{Mode: blnkgo.NettingBilateral, Reference: "eod"})
+	assert.Error(t, err)
+}
+
+func TestNetting_NetTransactions_PostsAtomically(t *testing.T) {
+	mockClient := &MockClient{}
+	netting := blnkgo.NewNetting(blnkgo.NewTransactionService(mockClient), blnkgo.NewLedgerBalanceService(mockClient))
+
+	var filter blnkgo.FilterParams
+	mockClient.On("NewRequest", "transactions/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		filter = args.Get(2).(blnkgo.FilterParams)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.FilterResponse).Data = []interface{}{
+			map[string]interface{}{"source": "A", "destination": "B", "currency": "USD", "precise_amount": 100, "status": "APPLIED"},
+			map[string]interface{}{"source": "B", "destination": "A", "currency": "USD", "precise_amount": 40, "status": "APPLIED"},
+		}
+	})
+	var bulk blnkgo.CreateBulkTransactionRequest
+	mockClient.On("NewRequest", "transactions/bulk", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		bulk = args.Get(2).(blnkgo.CreateBulkTransactionRequest)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.CreateBulkTransactionResponse")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.CreateBulkTransactionResponse).BatchID = "batch_1"
+	})
+
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	s, err := netting.NetTransactions(from, to, blnkgo.SettlementOptions{Mode: blnkgo.NettingBilateral, Participants: []string{"A", "B"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, blnkgo.OpIn, filter.Filters[2].Operator)
+	assert.True(t, bulk.Atomic)
+	require.Len(t, bulk.Transactions, 1)
+	assert.Equal(t, "60", bulk.Transactions[0].PreciseAmount.String())
+	assert.Equal(t, "settlement_20240602T000000Z_USD_1", bulk.Transactions[0].Reference)
+	assert.Equal(t, "batch_1", s.Batch.BatchID)
+}
+
+func TestNetting_Preview(t *testing.T) {
+	mockClient := &MockClient{}
+	netting := blnkgo.NewNetting(blnkgo.NewTransactionService(mockClient), blnkgo.NewLedgerBalanceService(mockClient))
+	mockClient.On("NewRequest", "balances/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.FilterResponse).Data = []interface{}{
+			map[string]interface{}{"balance_id": "A", "currency": "USD", "balance": -10},
+			map[string]interface{}{"balance_id": "B", "currency": "USD", "balance": 10},
+		}
+	})
+
+	s, err := netting.NetBalances([]blnkgo.Filter{{Field: "ledger_id", Operator: blnkgo.OpEqual, Value: "ldg_partners"}},
+		blnkgo.SettlementOptions{Mode: blnkgo.NettingMultilateral, Reference: "eod", Preview: true})
+	require.NoError(t, err)
+	assert.True(t, s.Preview)
+	assert.Len(t, s.Transactions, 1)
+	assert.Nil(t, s.Batch)
+	mockClient.AssertNotCalled(t, "NewRequest", "transactions/bulk", http.MethodPost, mock.Anything)
+}
+
+func TestNetting_NetBalancesRequiresReference(t *testing.T) {
+	mockClient := &MockClient{}
+	netting := blnkgo.NewNetting(blnkgo.NewTransactionService(mockClient), blnkgo.NewLedgerBalanceService(mockClient))
+
+	_, err := netting.NetBalances([]blnkgo.Filter{{Field: "ledger_id", Operator: blnkgo.OpEqual, Value: "ldg_partners"}},
+		blnkgo.SettlementOptions{Mode: blnkgo.NettingMultilateral})
+	assert.EqualError(t, err, "validation error: settlement reference is required")
+	mockClient.AssertNotCalled(t, "NewRequest", mock.Anything, mock.Anything, mock.Anything)
+}
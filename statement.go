@@ -0,0 +1,476 @@
+package blnkgo
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StatementRequest selects the transactions of BalanceID effective in
+// [From, To).
+type StatementRequest struct {
+	BalanceID string
+	From      time.Time
+	To        time.Time
+	// Precision formats CSV and HTML amounts in major units; zero uses 1.
+	Precision int64
+	// FromSource reconstructs the opening and closing balances from transactions.
+	FromSource bool
+	// PageSize is the number of transactions fetched per Filter call while
+	// streaming. Zero uses the default page size.
+	PageSize int
+}
+
+// StatementLine is one transaction on a statement. Debit and Credit are in
+// minor units; exactly one is non-zero unless the balance paid itself.
+type StatementLine struct {
+	Date           time.Time            `json:"date"`
+	TransactionID  string               `json:"transaction_id"`
+	Reference      string               `json:"reference"`
+	Description    string               `json:"description"`
+	Counterparty   string               `json:"counterparty"`
+	Status         PryTransactionStatus `json:"status"`
+	Debit          *big.Int             `json:"debit"`
+	Credit         *big.Int             `json:"credit"`
+	RunningBalance *big.Int             `json:"running_balance"`
+}
+
+// StatementSummary holds a statement's totals. Reconciled reports whether the
+// opening balance plus the listed transactions equals the closing balance
+// returned by Core.
+type StatementSummary struct {
+	BalanceID      string    `json:"balance_id"`
+	Currency       string    `json:"currency"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	OpeningBalance *big.Int  `json:"opening_balance"`
+	ClosingBalance *big.Int  `json:"closing_balance"`
+	TotalDebits    *big.Int  `json:"total_debits"`
+	TotalCredits   *big.Int  `json:"total_credits"`
+	Count          int       `json:"count"`
+	Reconciled     bool      `json:"reconciled"`
+}
+
+// Statement is a statement held in memory. Use Stream or the Write methods for
+// long periods.
+type Statement struct {
+	Summary StatementSummary `json:"summary"`
+	Lines   []StatementLine  `json:"lines"`
+}
+
+// StatementGenerator builds account statements from historical balances and
+// transactions.
+type StatementGenerator struct {
+	transactions *TransactionService
+	balances     *LedgerBalanceService
+}
+
+func NewStatementGenerator(transactions *TransactionService, balances *LedgerBalanceService) *StatementGenerator {
+	return &StatementGenerator{transactions: transactions, balances: balances}
+}
+
+// ValidateStatementRequest checks the balance and period.
+func ValidateStatementRequest(r StatementRequest) error {
+	if r.BalanceID == "" {
+		return errors.New("validation error: balance id is required")
+	}
+	if r.From.IsZero() || !r.From.Before(r.To) {
+		return errors.New("validation error: statement start must be before its end")
+	}
+	if r.Precision < 0 || r.PageSize < 0 {
+		return errors.New("validation error: precision and page size must be non-negative")
+	}
+	return nil
+}
+
+// Generate builds the whole statement in memory.
+func (g *StatementGenerator) Generate(r StatementRequest) (*Statement, error) {
+	statement := &Statement{}
+	summary, err := g.Stream(r, nil, func(line StatementLine) error {
+		statement.Lines = append(statement.Lines, line)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	statement.Summary = *summary
+	return statement, nil
+}
+
+// Stream reads the opening balance, then passes the summary so far to onOpen
+// and every line to onLine in effective date order, one page at a time. Either
+// callback may be nil. Only applied and committed transactions are listed; a
+// transaction with several sources or destinations gets one line for each leg
+// on the balance. The returned summary carries the closing balance and totals.
+func (g *StatementGenerator) Stream(r StatementRequest, onOpen func(StatementSummary) error, onLine func(StatementLine) error) (*StatementSummary, error) {
+	if err := ValidateStatementRequest(r); err != nil {
+		return nil, err
+	}
+	opening, _, err := g.balances.GetHistorical(r.BalanceID, r.From, r.FromSource)
+	if err != nil {
+		return nil, fmt.Errorf("statement: opening balance: %w", err)
+	}
+	summary := &StatementSummary{
+		BalanceID:      r.BalanceID,
+		Currency:       opening.Balance.Currency,
+		From:           r.From,
+		To:             r.To,
+		OpeningBalance: cloneBigInt(opening.Balance.Balance),
+		TotalDebits:    big.NewInt(0),
+		TotalCredits:   big.NewInt(0),
+	}
+	if onOpen != nil {
+		if err := onOpen(*summary); err != nil {
+			return nil, err
+		}
+	}
+
+	period := []Filter{
+		{Field: "effective_date", Operator: OpGreaterThanOrEqual, Value: r.From.UTC().Format(time.RFC3339)},
+		{Field: "effective_date", Operator: OpLessThan, Value: r.To.UTC().Format(time.RFC3339)},
+	}
+	cursor := func(side Filter, keep func(Transaction) bool) *transactionCursor {
+		return &transactionCursor{filter: g.transactions.Filter, keep: keep, params: FilterParams{
+			Filters:   append([]Filter{side}, period...),
+			SortBy:    "effective_date",
+			SortOrder: "asc",
+			Limit:     r.PageSize,
+		}}
+	}
+	// Each transaction is listed by exactly one cursor: single-leg rows by the
+	// side naming the balance (self-transfers from the source side), and
+	// multi-leg rows by the side left empty.
+	balance := r.BalanceID
+	cursors := []*transactionCursor{
+		cursor(Filter{Field: "source", Operator: OpEqual, Value: balance}, nil),
+		cursor(Filter{Field: "destination", Operator: OpEqual, Value: balance}, func(t Transaction) bool {
+			return t.Source != "" && t.Source != balance
+		}),
+		cursor(Filter{Field: "source", Operator: OpIsNull}, func(t Transaction) bool {
+			return t.Destination == balance || hasLeg(t.Sources, balance) || hasLeg(t.Destinations, balance)
+		}),
+		cursor(Filter{Field: "destination", Operator: OpIsNull}, func(t Transaction) bool {
+			return t.Source != "" && t.Source != balance && hasLeg(t.Destinations, balance)
+		}),
+	}
+
+	// A multi-leg transaction whose legs Core recorded as child rows is listed
+	// once, through whichever of the two is seen first.
+	expanded, split := make(map[string]struct{}), make(map[string]struct{})
+	running := cloneBigInt(opening.Balance.Balance)
+	for {
+		var next *transactionCursor
+		var txn *Transaction
+		for _, c := range cursors {
+			t, err := c.peek()
+			if err != nil {
+				return nil, err
+			}
+			if t != nil && (txn == nil || transactionAfter(*txn, *t)) {
+				next, txn = c, t
+			}
+		}
+		if txn == nil {
+			summary.ClosingBalance = running
+			return g.close(r, summary)
+		}
+		next.pop()
+		if !txn.Status.IsSettled() {
+			continue
+		}
+		if len(txn.Sources) > 0 || len(txn.Destinations) > 0 {
+			if _, ok := split[txn.TransactionID]; ok {
+				continue
+			}
+			expanded[txn.TransactionID] = struct{}{}
+		} else if txn.ParentTransactionID != "" {
+			if _, ok := expanded[txn.ParentTransactionID]; ok {
+				continue
+			}
+			split[txn.ParentTransactionID] = struct{}{}
+		}
+
+		lines, err := statementLines(*txn, balance, running)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			summary.TotalDebits.Add(summary.TotalDebits, line.Debit)
+			summary.TotalCredits.Add(summary.TotalCredits, line.Credit)
+			summary.Count++
+			if onLine != nil {
+				if err := onLine(line); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+}
+
+// close compares the running balance with Core's balance at the period end.
+func (g *StatementGenerator) close(r StatementRequest, summary *StatementSummary) (*StatementSummary, error) {
+	closing, _, err := g.balances.GetHistorical(r.BalanceID, r.To, r.FromSource)
+	if err != nil {
+		return nil, fmt.Errorf("statement: closing balance: %w", err)
+	}
+	summary.Reconciled = cloneBigInt(closing.Balance.Balance).Cmp(summary.ClosingBalance) == 0
+	summary.ClosingBalance = cloneBigInt(closing.Balance.Balance)
+	return summary, nil
+}
+
+// statementLines returns the lines txn adds to balanceID's statement. A
+// single-leg transaction is one line; a multi-leg one gets a line per source
+// or destination leg on the balance.
+func statementLines(txn Transaction, balanceID string, running *big.Int) ([]StatementLine, error) {
+	amount, err := transactionPreciseAmount(txn.ParentTransaction)
+	if err != nil {
+		return nil, fmt.Errorf("statement: transaction %s: %w", txn.TransactionID, err)
+	}
+	newLine := func(counterparty string) StatementLine {
+		line := StatementLine{
+			Date:          txn.CreatedAt,
+			TransactionID: txn.TransactionID,
+			Reference:     txn.Reference,
+			Description:   txn.Description,
+			Counterparty:  counterparty,
+			Status:        txn.Status,
+			Debit:         big.NewInt(0),
+			Credit:        big.NewInt(0),
+		}
+		if txn.EffectiveDate != nil && !txn.EffectiveDate.IsZero() {
+			line.Date = *txn.EffectiveDate
+		}
+		return line
+	}
+
+	if len(txn.Sources) == 0 && len(txn.Destinations) == 0 {
+		line := newLine("")
+		if txn.Source == balanceID {
+			line.Debit.Set(amount)
+			line.Counterparty = txn.Destination
+			running.Sub(running, amount)
+		}
+		if txn.Destination == balanceID {
+			line.Credit.Set(amount)
+			line.Counterparty = txn.Source
+			running.Add(running, amount)
+		}
+		line.RunningBalance = new(big.Int).Set(running)
+		return []StatementLine{line}, nil
+	}
+
+	sources, err := resolveLegAmounts(txn.Sources, txn.Source, amount, txn.Precision)
+	if err != nil {
+		return nil, fmt.Errorf("statement: transaction %s: %w", txn.TransactionID, err)
+	}
+	destinations, err := resolveLegAmounts(txn.Destinations, txn.Destination, amount, txn.Precision)
+	if err != nil {
+		return nil, fmt.Errorf("statement: transaction %s: %w", txn.TransactionID, err)
+	}
+	var lines []StatementLine
+	for _, leg := range sources {
+		if leg.identifier != balanceID {
+			continue
+		}
+		line := newLine(legIdentifiers(destinations))
+		line.Debit.Set(leg.amount)
+		running.Sub(running, leg.amount)
+		line.RunningBalance = new(big.Int).Set(running)
+		lines = append(lines, line)
+	}
+	for _, leg := range destinations {
+		if leg.identifier != balanceID {
+			continue
+		}
+		line := newLine(legIdentifiers(sources))
+		line.Credit.Set(leg.amount)
+		running.Add(running, leg.amount)
+		line.RunningBalance = new(big.Int).Set(running)
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+func hasLeg(legs []Source, identifier string) bool {
+	for _, leg := range legs {
+		if leg.Identifier == identifier {
+			return true
+		}
+	}
+	return false
+}
+
+func legIdentifiers(legs []legAmount) string {
+	ids := make([]string, len(legs))
+	for i, leg := range legs {
+		ids[i] = leg.identifier
+	}
+	return strings.Join(ids, ", ")
+}
+
+// transactionAfter orders transactions by effective date, falling back to the
+// creation time, then by ID.
+func transactionAfter(a, b Transaction) bool {
+	at, bt := transactionDate(a), transactionDate(b)
+	if !at.Equal(bt) {
+		return at.After(bt)
+	}
+	return a.TransactionID > b.TransactionID
+}
+
+func transactionDate(t Transaction) time.Time {
+	if t.EffectiveDate != nil && !t.EffectiveDate.IsZero() {
+		return *t.EffectiveDate
+	}
+	return t.CreatedAt
+}
+
+// transactionCursor pages through Filter results one transaction at a time,
+// skipping rows that keep, when set, rejects.
+type transactionCursor struct {
+	filter func(FilterParams) (*FilterResponse, *http.Response, error)
+	keep   func(Transaction) bool
+	params FilterParams
+	page   []Transaction
+	done   bool
+}
+
+func (c *transactionCursor) peek() (*Transaction, error) {
+	if c.params.Limit <= 0 {
+		c.params.Limit = defaultFilterPageSize
+	}
+	for len(c.page) == 0 && !c.done {
+		response, _, err := c.filter(c.params)
+		if err != nil {
+			return nil, err
+		}
+		var page []Transaction
+		if err := response.DecodeData(&page); err != nil {
+			return nil, err
+		}
+		c.done = len(page) < c.params.Limit
+		c.params.Offset += c.params.Limit
+		for _, t := range page {
+			if c.keep == nil || c.keep(t) {
+				c.page = append(c.page, t)
+			}
+		}
+	}
+	if len(c.page) == 0 {
+		return nil, nil
+	}
+	return &c.page[0], nil
+}
+
+func (c *transactionCursor) pop() {
+	c.page = c.page[1:]
+}
+
+var statementCSVHeader = []string{"date", "transaction_id", "reference", "description", "counterparty", "debit", "credit", "balance"}
+
+// WriteCSV streams the statement as CSV with amounts in major units. The first
+// and last rows carry the opening and closing balances.
+func (g *StatementGenerator) WriteCSV(w io.Writer, r StatementRequest) (*StatementSummary, error) {
+	out := csv.NewWriter(w)
+	format := func(n *big.Int) string { return FormatMajorUnits(n, r.Precision) }
+	summary, err := g.Stream(r, func(s StatementSummary) error {
+		if err := out.Write(statementCSVHeader); err != nil {
+			return err
+		}
+		return out.Write([]string{s.From.Format(time.RFC3339), "", "", "Opening balance", "", "", "", format(s.OpeningBalance)})
+	}, func(line StatementLine) error {
+		return out.Write([]string{
+			line.Date.Format(time.RFC3339), line.TransactionID, line.Reference, line.Description, line.Counterparty,
+			format(line.Debit), format(line.Credit), format(line.RunningBalance),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := out.Write([]string{
+		summary.To.Format(time.RFC3339), "", "", "Closing balance", "",
+		format(summary.TotalDebits), format(summary.TotalCredits), format(summary.ClosingBalance),
+	}); err != nil {
+		return nil, err
+	}
+	out.Flush()
+	return summary, out.Error()
+}
+
+// WriteJSON streams the statement as {"lines": [...], "summary": {...}} with
+// amounts in minor units.
+func (g *StatementGenerator) WriteJSON(w io.Writer, r StatementRequest) (*StatementSummary, error) {
+	first := true
+	summary, err := g.Stream(r, func(StatementSummary) error {
+		_, err := io.WriteString(w, `{"lines":[`)
+		return err
+	}, func(line StatementLine) error {
+		data, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(w, `],"summary":%s}`, data); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// WriteHTML streams the statement as a standalone HTML document with amounts
+// in major units.
+func (g *StatementGenerator) WriteHTML(w io.Writer, r StatementRequest) (*StatementSummary, error) {
+	format := func(n *big.Int) string { return FormatMajorUnits(n, r.Precision) }
+	summary, err := g.Stream(r, func(s StatementSummary) error {
+		_, err := fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Statement %[1]s</title></head>
+<body>
+<h1>Statement for %[1]s</h1>
+<p>%[2]s to %[3]s (%[4]s)</p>
+<table>
+<thead><tr><th>Date</th><th>Reference</th><th>Description</th><th>Counterparty</th><th>Debit</th><th>Credit</th><th>Balance</th></tr></thead>
+<tbody>
+<tr><td>%[2]s</td><td></td><td>Opening balance</td><td></td><td></td><td></td><td>%[5]s</td></tr>
+`, html.EscapeString(s.BalanceID), s.From.Format("2006-01-02"), s.To.Format("2006-01-02"), html.EscapeString(s.Currency), format(s.OpeningBalance))
+		return err
+	}, func(line StatementLine) error {
+		_, err := fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			line.Date.Format("2006-01-02"), html.EscapeString(line.Reference), html.EscapeString(line.Description),
+			html.EscapeString(line.Counterparty), format(line.Debit), format(line.Credit), format(line.RunningBalance))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(w, `<tr><td>%s</td><td></td><td>Closing balance</td><td></td><td>%s</td><td>%s</td><td>%s</td></tr>
+</tbody>
+</table>
+</body>
+</html>
+`, summary.To.Format("2006-01-02"), format(summary.TotalDebits), format(summary.TotalCredits), format(summary.ClosingBalance)); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
@@ -0,0 +1,171 @@
+package blnkgo_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// statementTxn is effective on the given June day but created in July, as a
+// back-dated posting would be.
+func statementTxn(id, source, destination string, amount int64, day int, status string) map[string]interface{} {
+	return map[string]interface{}{
+		"transaction_id": id, "reference": "ref_" + id, "source": source, "destination": destination,
+		"precise_amount": amount, "status": status, "currency": "USD",
+		"effective_date": time.Date(2024, 6, day, 12, 0, 0, 0, time.UTC).Format(time.RFC3339),
+		"created_at":     time.Date(2024, 7, 2, 31-day, 0, 0, 0, time.UTC).Format(time.RFC3339),
+	}
+}
+
+func statementLegs(txn map[string]interface{}, side string, legs ...map[string]interface{}) map[string]interface{} {
+	delete(txn, strings.TrimSuffix(side, "s"))
+	txn[side] = legs
+	return txn
+}
+
+func setupStatement(t *testing.T, closing int64) (*blnkgo.StatementGenerator, blnkgo.StatementRequest) {
+	mockClient := &MockClient{}
+	var path string
+	mockClient.On("NewRequest", mock.MatchedBy(func(p string) bool { return strings.HasPrefix(p, "balances/bln_wallet/at?") }), http.MethodGet, nil).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		path = args.String(0)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.LedgerBalanceHistorical")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		h := args.Get(1).(*blnkgo.LedgerBalanceHistorical)
+		h.Balance.Currency = "USD"
+		h.Balance.Balance = big.NewInt(10000)
+		if strings.Contains(path, "2024-07-01") {
+			h.Balance.Balance = big.NewInt(closing)
+		}
+	})
+
+	// t6 pays from two sources and was also recorded as the child row t6_1;
+	// t7 pays into two destinations.
+	t6 := statementLegs(statementTxn("t6", "", "bln_shop", 1000, 15, "APPLIED"), "sources",
+		map[string]interface{}{"identifier": "bln_wallet", "precise_distribution": "300"},
+		map[string]interface{}{"identifier": "bln_savings", "distribution": "left"})
+	t6child := statementTxn("t6_1", "bln_wallet", "bln_shop", 300, 15, "APPLIED")
+	t6child["parent_transaction"] = "t6"
+	t7 := statementLegs(statementTxn("t7", "@salary", "", 2000, 25, "APPLIED"), "destinations",
+		map[string]interface{}{"identifier": "bln_wallet", "distribution": "60%"},
+		map[string]interface{}{"identifier": "bln_savings", "distribution": "left"})
+
+	// Pages of two: debits on the source side, credits on the destination
+	// side, multi-leg rows where that side is empty.
+	pages := map[string][][]interface{}{
+		"source eq": {
+			{statementTxn("t2", "bln_wallet", "bln_shop", 2500, 5, "APPLIED"), statementTxn("t3", "bln_wallet", "bln_shop", 9999, 6, "REJECTED")},
+			{t6child, statementTxn("t5", "bln_wallet", "bln_wallet", 100, 20, "APPLIED")},
+		},
+		"destination eq": {
+			{statementTxn("t1", "@salary", "bln_wallet", 5000, 1, "APPLIED"), statementTxn("t4", "bln_friend", "bln_wallet", 1000, 10, "APPLIED")},
+			{statementTxn("t5", "bln_wallet", "bln_wallet", 100, 20, "APPLIED")},
+		},
+		"source isnull":      {{t6}},
+		"destination isnull": {{t7}},
+	}
+	var params blnkgo.FilterParams
+	mockClient.On("NewRequest", "transactions/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		params = args.Get(2).(blnkgo.FilterParams)
+		assert.Equal(t, "effective_date", params.SortBy)
+		assert.Equal(t, "effective_date", params.Filters[1].Field)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		side := pages[params.Filters[0].Field+" "+string(params.Filters[0].Operator)]
+		page := []interface{}{}
+		if i := params.Offset / params.Limit; i < len(side) {
+			page = side[i]
+		}
+		args.Get(1).(*blnkgo.FilterResponse).Data = page
+	})
+
+	generator := blnkgo.NewStatementGenerator(blnkgo.NewTransactionService(mockClient), blnkgo.NewLedgerBalanceService(mockClient))
+	return generator, blnkgo.StatementRequest{
+		BalanceID: "bln_wallet",
+		From:      time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		To:        time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+		Precision: 100,
+		PageSize:  2,
+	}
+}
+
+func TestStatementGenerator_Generate(t *testing.T) {
+	generator, request := setupStatement(t, 14400)
+
+	statement, err := generator.Generate(request)
+	require.NoError(t, err)
+	require.Len(t, statement.Lines, 6)
+
+	ids := []string{}
+	for _, line := range statement.Lines {
+		ids = append(ids, line.TransactionID)
+	}
+	assert.Equal(t, []string{"t1", "t2", "t4", "t6", "t5", "t7"}, ids)
+	assert.Equal(t, "15000", statement.Lines[0].RunningBalance.String())
+	assert.Equal(t, "@salary", statement.Lines[0].Counterparty)
+	assert.Equal(t, "2500", statement.Lines[1].Debit.String())
+	assert.Equal(t, "bln_shop", statement.Lines[1].Counterparty)
+	assert.Equal(t, "300", statement.Lines[3].Debit.String())
+	assert.Equal(t, "bln_shop", statement.Lines[3].Counterparty)
+	assert.Equal(t, "13200", statement.Lines[4].RunningBalance.String())
+	assert.Equal(t, "1200", statement.Lines[5].Credit.String())
+	assert.Equal(t, "@salary", statement.Lines[5].Counterparty)
+	assert.Equal(t, "14400", statement.Lines[5].RunningBalance.String())
+
+	summary := statement.Summary
+	assert.Equal(t, "10000", summary.OpeningBalance.String())
+	assert.Equal(t, "14400", summary.ClosingBalance.String())
+	assert.Equal(t, "2900", summary.TotalDebits.String())
+	assert.Equal(t, "7300", summary.TotalCredits.String())
+	assert.True(t, summary.Reconciled)
+
+	streamed, err := generator.Stream(request, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 6, streamed.Count)
+
+	generator, request = setupStatement(t, 14000)
+	statement, err = generator.Generate(request)
+	require.NoError(t, err)
+	assert.False(t, statement.Summary.Reconciled)
+
+	_, err = generator.Generate(blnkgo.StatementRequest{BalanceID: "bln_wallet"})
+	assert.Error(t, err)
+}
+
+func TestStatementGenerator_Writers(t *testing.T) {
+	generator, request := setupStatement(t, 14400)
+
+	var out bytes.Buffer
+	_, err := generator.WriteCSV(&out, request)
+	require.NoError(t, err)
+	rows, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 9)
+	assert.Equal(t, "100.00", rows[1][7])
+	assert.Equal(t, "25.00", rows[3][5])
+	assert.Equal(t, "144.00", rows[8][7])
+
+	out.Reset()
+	_, err = generator.WriteJSON(&out, request)
+	require.NoError(t, err)
+	var decoded blnkgo.Statement
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Len(t, decoded.Lines, 6)
+	assert.Equal(t, "14400", decoded.Summary.ClosingBalance.String())
+
+	out.Reset()
+	_, err = generator.WriteHTML(&out, request)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "<td>Opening balance</td>")
+	assert.Contains(t, out.String(), "<td>ref_t4</td>")
+	assert.Contains(t, out.String(), "</html>")
+}
@@ -8,7 +8,11 @@ import (
 	"time"
 )
 
-type TransactionService service
+type TransactionService struct {
+	client ClientInterface
+	// closedPeriods, when set, rejects postings effective inside a closed period.
+	closedPeriods *closedPeriodIndex
+}
 
 type Source struct {
 	Identifier          string       `json:"identifier"`
@@ -43,6 +47,9 @@ type CreateTransactionRequest struct {
 	InflightCommitDate *time.Time `json:"inflight_commit_date,omitempty"`
 	ScheduledFor       *time.Time `json:"scheduled_for,omitempty"`
 	AllowOverdraft     bool       `json:"allow_overdraft,omitempty"`
+	// ParentTransactionID links the new transaction to an earlier one, as
+	// Core does for refunds and committed holds.
+	ParentTransactionID string `json:"parent_transaction,omitempty"`
 }
 
 type Transaction struct {
@@ -58,6 +65,11 @@ type UpdateStatus struct {
 	Amount        *float64       `json:"amount"`
 	PreciseAmount *big.Int       `json:"precise_amount"`
 	SkipQueue     bool           `json:"skip_queue,omitempty"`
+	// PrecheckStatus opts in to a client-side status check. Set it to the
+	// status you last read for the transaction and Update returns a
+	// *TransactionStatusError without calling Core if that status does not
+	// allow the update. When empty no check is made and no lookup is done.
+	PrecheckStatus PryTransactionStatus `json:"-"`
 }
 
 type CreateBulkTransactionRequest struct {
@@ -79,6 +91,11 @@ type CreateBulkTransactionResponse struct {
 // Omit the body (pass nil) to queue the refund using Core defaults.
 type RefundTransactionRequest struct {
 	SkipQueue bool `json:"skip_queue,omitempty"`
+	// PrecheckStatus opts in to a client-side status check. Set it to the
+	// status you last read for the transaction and Refund returns a
+	// *TransactionStatusError without calling Core if it cannot be refunded.
+	// When empty no check is made and no lookup is done.
+	PrecheckStatus PryTransactionStatus `json:"-"`
 }
 
 // MaxBulkInflightItems caps the number of transactions accepted in a single
@@ -147,6 +164,9 @@ func (s *TransactionService) Create(body CreateTransactionRequest) (*Transaction
 	if err := ValidateCreateTransacation(body); err != nil {
 		return nil, nil, err
 	}
+	if err := s.checkClosedPeriods(body); err != nil {
+		return nil, nil, err
+	}
 
 	req, err := s.client.NewRequest("transactions", http.MethodPost, body)
 	if err != nil {
@@ -204,6 +224,9 @@ func (s *TransactionService) CreateBulk(body CreateBulkTransactionRequest) (*Cre
 	if err := ValidateCreateBulkTransaction(body); err != nil {
 		return nil, nil, err
 	}
+	if err := s.checkClosedPeriods(body.Transactions...); err != nil {
+		return nil, nil, err
+	}
 
 	req, err := s.client.NewRequest("transactions/bulk", http.MethodPost, body)
 	if err != nil {
@@ -224,6 +247,15 @@ func (s *TransactionService) Update(transactionID string, body UpdateStatus) (*T
 	if transactionID == "" {
 		return nil, nil, fmt.Errorf("transactionID is required")
 	}
+	if body.PrecheckStatus != "" {
+		action, err := inflightStatusAction(body.Status)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := CheckTransactionAction(transactionID, body.PrecheckStatus, action); err != nil {
+			return nil, nil, err
+		}
+	}
 	u := fmt.Sprintf("transactions/inflight/%s", transactionID)
 	req, err := s.client.NewRequest(u, http.MethodPut, body)
 	if err != nil {
@@ -252,6 +284,11 @@ func (s *TransactionService) Refund(transactionID string, body ...*RefundTransac
 		if err := ValidateRefundTransaction(*body[0]); err != nil {
 			return nil, nil, err
 		}
+		if body[0].PrecheckStatus != "" {
+			if err := CheckTransactionAction(transactionID, body[0].PrecheckStatus, TransactionActionRefund); err != nil {
+				return nil, nil, err
+			}
+		}
 		reqBody = body[0]
 	}
 
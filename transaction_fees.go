@@ -0,0 +1,295 @@
+package blnkgo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Metadata keys recording the fee breakdown on a transaction built by
+// FeeSchedule.Apply.
+const (
+	FeeScheduleMetaKey = "fee_schedule"
+	FeeBaseMetaKey     = "fee_base_amount"
+	FeeTotalMetaKey    = "fee_total"
+	FeesMetaKey        = "fees"
+)
+
+// FeeBearer selects who pays the fees of a transfer.
+type FeeBearer string
+
+const (
+	// FeeBearerDestination deducts fees from the amount credited to the
+	// destination; the source is debited the base amount.
+	FeeBearerDestination FeeBearer = "destination"
+	// FeeBearerSource adds fees on top of the base amount debited from the
+	// source; the destination is credited the full base amount.
+	FeeBearerSource FeeBearer = "source"
+)
+
+// FeeTier is one bracket of a tiered fee. The tier whose UpTo is the smallest
+// value at or above the base amount applies to the whole amount; a nil UpTo
+// matches everything above the previous tier.
+type FeeTier struct {
+	UpTo       *big.Int
+	Flat       *big.Int
+	Percentage float64
+}
+
+// FeeRule is one fee routed to a revenue balance. Flat amounts and caps are in
+// minor units; Percentage is a percent of the base amount (2.9 means 2.9%).
+// When Tiers is set it replaces Flat and Percentage. An empty Currency matches
+// every currency.
+type FeeRule struct {
+	Name        string
+	Currency    string
+	Destination string
+	Narration   string
+
+	Flat       *big.Int
+	Percentage float64
+	Tiers      []FeeTier
+
+	Min *big.Int
+	Max *big.Int
+}
+
+// FeeSchedule is a named set of fee rules applied to transfers.
+type FeeSchedule struct {
+	Name   string
+	Bearer FeeBearer
+	Rules  []FeeRule
+}
+
+// FeeCharge is the fee produced by one rule.
+type FeeCharge struct {
+	Rule        string   `json:"rule"`
+	Destination string   `json:"destination"`
+	Amount      *big.Int `json:"amount"`
+}
+
+// FeeQuote is the result of applying a fee schedule to a base amount, in minor
+// units. Total is debited from the source and Net is credited to the
+// destination.
+type FeeQuote struct {
+	Schedule  string      `json:"schedule"`
+	Currency  string      `json:"currency"`
+	Base      *big.Int    `json:"base"`
+	Fees      []FeeCharge `json:"fees"`
+	TotalFees *big.Int    `json:"total_fees"`
+	Total     *big.Int    `json:"total"`
+	Net       *big.Int    `json:"net"`
+}
+
+// ValidateFeeSchedule checks rules are named, routed and consistently capped.
+func ValidateFeeSchedule(s FeeSchedule) error {
+	if s.Bearer != "" && s.Bearer != FeeBearerDestination && s.Bearer != FeeBearerSource {
+		return fmt.Errorf("validation error: invalid fee bearer: %s", s.Bearer)
+	}
+	names := make(map[string]struct{}, len(s.Rules))
+	for i, r := range s.Rules {
+		if strings.TrimSpace(r.Name) == "" {
+			return fmt.Errorf("validation error: fee rule at index %d must have a name", i)
+		}
+		if _, dup := names[r.Name]; dup {
+			return fmt.Errorf("validation error: duplicate fee rule %s", r.Name)
+		}
+		names[r.Name] = struct{}{}
+		if strings.TrimSpace(r.Destination) == "" {
+			return fmt.Errorf("validation error: fee rule %s must have a destination", r.Name)
+		}
+		if r.Percentage < 0 || isNegative(r.Flat) || isNegative(r.Min) || isNegative(r.Max) {
+			return fmt.Errorf("validation error: fee rule %s amounts must be non-negative", r.Name)
+		}
+		if r.Min != nil && r.Max != nil && r.Min.Cmp(r.Max) > 0 {
+			return fmt.Errorf("validation error: fee rule %s min exceeds max", r.Name)
+		}
+		for j, tier := range r.Tiers {
+			if tier.Percentage < 0 || isNegative(tier.Flat) {
+				return fmt.Errorf("validation error: fee rule %s tier %d amounts must be non-negative", r.Name, j)
+			}
+			if tier.UpTo == nil && j != len(r.Tiers)-1 {
+				return fmt.Errorf("validation error: fee rule %s only the last tier may be unbounded", r.Name)
+			}
+			if j > 0 && tier.UpTo != nil && tier.UpTo.Cmp(r.Tiers[j-1].UpTo) <= 0 {
+				return fmt.Errorf("validation error: fee rule %s tiers must be in ascending order", r.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Quote computes the fees for base (minor units) in currency.
+func (s FeeSchedule) Quote(currency string, base *big.Int) (*FeeQuote, error) {
+	if err := ValidateFeeSchedule(s); err != nil {
+		return nil, err
+	}
+	if base == nil || base.Sign() < 0 {
+		return nil, errors.New("validation error: base amount must be non-negative")
+	}
+
+	quote := &FeeQuote{Schedule: s.Name, Currency: currency, Base: new(big.Int).Set(base), TotalFees: big.NewInt(0)}
+	for _, rule := range s.Rules {
+		if rule.Currency != "" && !strings.EqualFold(rule.Currency, currency) {
+			continue
+		}
+		fee, err := rule.fee(base)
+		if err != nil {
+			return nil, err
+		}
+		quote.Fees = append(quote.Fees, FeeCharge{Rule: rule.Name, Destination: rule.Destination, Amount: fee})
+		quote.TotalFees.Add(quote.TotalFees, fee)
+	}
+
+	if s.Bearer == FeeBearerSource {
+		quote.Total = new(big.Int).Add(base, quote.TotalFees)
+		quote.Net = new(big.Int).Set(base)
+	} else {
+		if quote.TotalFees.Cmp(base) > 0 {
+			return nil, fmt.Errorf("validation error: fees %s exceed base amount %s", quote.TotalFees, base)
+		}
+		quote.Total = new(big.Int).Set(base)
+		quote.Net = new(big.Int).Sub(base, quote.TotalFees)
+	}
+	return quote, nil
+}
+
+// Apply turns a single-destination transfer into one transaction whose
+// destinations route each fee to its revenue balance and the remainder to the
+// original destination. The breakdown is recorded under FeesMetaKey. Sources,
+// when used instead of Source, must split with percentages or "left" so they
+// scale to the new total.
+func (s FeeSchedule) Apply(body CreateTransactionRequest) (*CreateTransactionRequest, *FeeQuote, error) {
+	if err := ValidateCreateTransacation(body); err != nil {
+		return nil, nil, err
+	}
+	if body.Destination == "" {
+		return nil, nil, errors.New("validation error: fees can only be applied to a transfer with a single destination")
+	}
+	base, err := transactionPreciseAmount(body.ParentTransaction)
+	if err != nil {
+		return nil, nil, err
+	}
+	quote, err := s.Quote(body.Currency, base)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := body
+	out.MetaData = make(MetaData, len(body.MetaData)+4)
+	for k, v := range body.MetaData {
+		out.MetaData[k] = v
+	}
+	if quote.TotalFees.Sign() == 0 {
+		return &out, quote, nil
+	}
+
+	if out.Precision == 0 {
+		out.Precision = 1
+	}
+	out.Amount = 0
+	out.PreciseAmount = new(big.Int).Set(quote.Total)
+	out.Destination = ""
+	out.Destinations = nil
+
+	// Fees routed to the same revenue balance are merged into one leg.
+	legs := make(map[string]*big.Int)
+	var order []string
+	narrations := make(map[string]string)
+	for _, fee := range quote.Fees {
+		if fee.Amount.Sign() == 0 {
+			continue
+		}
+		if _, ok := legs[fee.Destination]; !ok {
+			legs[fee.Destination] = big.NewInt(0)
+			order = append(order, fee.Destination)
+		}
+		legs[fee.Destination].Add(legs[fee.Destination], fee.Amount)
+		if narrations[fee.Destination] == "" {
+			narrations[fee.Destination] = s.narration(fee.Rule)
+		}
+	}
+	for _, destination := range order {
+		out.Destinations = append(out.Destinations, Source{
+			Identifier:          destination,
+			PreciseDistribution: legs[destination].String(),
+			Narration:           narrations[destination],
+		})
+	}
+	out.Destinations = append(out.Destinations, Source{Identifier: body.Destination, Distribution: "left"})
+
+	breakdown := make([]map[string]interface{}, 0, len(quote.Fees))
+	for _, fee := range quote.Fees {
+		breakdown = append(breakdown, map[string]interface{}{
+			"rule":        fee.Rule,
+			"destination": fee.Destination,
+			"amount":      fee.Amount.String(),
+		})
+	}
+	out.MetaData[FeeScheduleMetaKey] = s.Name
+	out.MetaData[FeeBaseMetaKey] = base.String()
+	out.MetaData[FeeTotalMetaKey] = quote.TotalFees.String()
+	out.MetaData[FeesMetaKey] = breakdown
+
+	if err := ValidateCreateTransacation(out); err != nil {
+		return nil, nil, err
+	}
+	return &out, quote, nil
+}
+
+func (s FeeSchedule) narration(rule string) string {
+	for _, r := range s.Rules {
+		if r.Name == rule && r.Narration != "" {
+			return r.Narration
+		}
+	}
+	return ""
+}
+
+func (r FeeRule) fee(base *big.Int) (*big.Int, error) {
+	flat, pct := r.Flat, r.Percentage
+	if len(r.Tiers) > 0 {
+		tier := r.Tiers[len(r.Tiers)-1]
+		for _, t := range r.Tiers {
+			if t.UpTo == nil || base.Cmp(t.UpTo) <= 0 {
+				tier = t
+				break
+			}
+		}
+		flat, pct = tier.Flat, tier.Percentage
+	}
+
+	fee, err := percentOf(base, pct)
+	if err != nil {
+		return nil, fmt.Errorf("fee rule %s: %w", r.Name, err)
+	}
+	if flat != nil {
+		fee.Add(fee, flat)
+	}
+	if r.Min != nil && fee.Cmp(r.Min) < 0 {
+		fee.Set(r.Min)
+	}
+	if r.Max != nil && fee.Cmp(r.Max) > 0 {
+		fee.Set(r.Max)
+	}
+	return fee, nil
+}
+
+// percentOf returns pct percent of n, rounded half away from zero.
+func percentOf(n *big.Int, pct float64) (*big.Int, error) {
+	if pct == 0 {
+		return big.NewInt(0), nil
+	}
+	p, ok := new(big.Rat).SetString(strconv.FormatFloat(pct, 'f', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("invalid percentage: %v", pct)
+	}
+	r := new(big.Rat).Mul(new(big.Rat).SetInt(n), p)
+	return roundRat(r.Quo(r, big.NewRat(100, 1))), nil
+}
+
+func isNegative(n *big.Int) bool {
+	return n != nil && n.Sign() < 0
+}
@@ -0,0 +1,119 @@
+package blnkgo_test
+
+import (
+	"math/big"
+	"testing"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cardFeeSchedule(bearer blnkgo.FeeBearer) blnkgo.FeeSchedule {
+	return blnkgo.FeeSchedule{
+		Name:   "card",
+		Bearer: bearer,
+		Rules: []blnkgo.FeeRule{
+			{Name: "processing", Destination: "@revenue", Percentage: 2.9, Flat: big.NewInt(30), Max: big.NewInt(1000)},
+			{Name: "fx", Currency: "EUR", Destination: "@fx_revenue", Percentage: 1},
+			{Name: "platform", Destination: "@revenue", Tiers: []blnkgo.FeeTier{
+				{UpTo: big.NewInt(10000), Flat: big.NewInt(50)},
+				{UpTo: big.NewInt(100000), Percentage: 0.5},
+				{Percentage: 0.25},
+			}},
+		},
+	}
+}
+
+func feeTransfer(amount float64, currency string) blnkgo.CreateTransactionRequest {
+	return blnkgo.CreateTransactionRequest{
+		ParentTransaction: blnkgo.ParentTransaction{
+			Amount:      amount,
+			Precision:   100,
+			Reference:   "order_1",
+			Description: "checkout",
+			Currency:    currency,
+			Source:      "bln_customer",
+			Destination: "bln_merchant",
+			MetaData:    blnkgo.MetaData{"order_id": "1"},
+		},
+	}
+}
+
+func TestValidateFeeSchedule(t *testing.T) {
+	assert.NoError(t, blnkgo.ValidateFeeSchedule(cardFeeSchedule("")))
+	assert.Error(t, blnkgo.ValidateFeeSchedule(blnkgo.FeeSchedule{Rules: []blnkgo.FeeRule{{Name: "x"}}}))
+	assert.Error(t, blnkgo.ValidateFeeSchedule(blnkgo.FeeSchedule{Rules: []blnkgo.FeeRule{
+		{Name: "x", Destination: "@r", Min: big.NewInt(10), Max: big.NewInt(5)},
+	}}))
+	assert.Error(t, blnkgo.ValidateFeeSchedule(blnkgo.FeeSchedule{Rules: []blnkgo.FeeRule{
+		{Name: "x", Destination: "@r", Tiers: []blnkgo.FeeTier{{UpTo: big.NewInt(10)}, {UpTo: big.NewInt(5)}}},
+	}}))
+	assert.Error(t, blnkgo.ValidateFeeSchedule(blnkgo.FeeSchedule{Bearer: "nobody"}))
+}
+
+func TestFeeSchedule_Quote(t *testing.T) {
+	schedule := cardFeeSchedule("")
+
+	quote, err := schedule.Quote("USD", big.NewInt(5000))
+	require.NoError(t, err)
+	require.Len(t, quote.Fees, 2)
+	assert.Equal(t, "175", quote.Fees[0].Amount.String()) // 145 + 30
+	assert.Equal(t, "50", quote.Fees[1].Amount.String())
+	assert.Equal(t, "225", quote.TotalFees.String())
+	assert.Equal(t, "5000", quote.Total.String())
+	assert.Equal(t, "4775", quote.Net.String())
+
+	quote, err = schedule.Quote("EUR", big.NewInt(1000000))
+	require.NoError(t, err)
+	require.Len(t, quote.Fees, 3)
+	assert.Equal(t, "1000", quote.Fees[0].Amount.String()) // capped
+	assert.Equal(t, "10000", quote.Fees[1].Amount.String())
+	assert.Equal(t, "2500", quote.Fees[2].Amount.String())
+
+	_, err = blnkgo.FeeSchedule{Rules: []blnkgo.FeeRule{
+		{Name: "min", Destination: "@r", Min: big.NewInt(500)},
+	}}.Quote("USD", big.NewInt(100))
+	assert.Error(t, err)
+}
+
+func TestFeeSchedule_Apply_DestinationBears(t *testing.T) {
+	out, quote, err := cardFeeSchedule(blnkgo.FeeBearerDestination).Apply(feeTransfer(50, "USD"))
+	require.NoError(t, err)
+	assert.Equal(t, "225", quote.TotalFees.String())
+
+	assert.Equal(t, "5000", out.PreciseAmount.String())
+	assert.Empty(t, out.Destination)
+	require.Len(t, out.Destinations, 2)
+	assert.Equal(t, blnkgo.Source{Identifier: "@revenue", PreciseDistribution: "225"}, out.Destinations[0])
+	assert.Equal(t, blnkgo.Source{Identifier: "bln_merchant", Distribution: "left"}, out.Destinations[1])
+
+	assert.Equal(t, "1", out.MetaData["order_id"])
+	assert.Equal(t, "card", out.MetaData[blnkgo.FeeScheduleMetaKey])
+	assert.Equal(t, "225", out.MetaData[blnkgo.FeeTotalMetaKey])
+	assert.Len(t, out.MetaData[blnkgo.FeesMetaKey], 2)
+
+	result, err := blnkgo.Simulate(*out, nil)
+	require.NoError(t, err)
+	merchant, _ := result.Balance("bln_merchant")
+	assert.Equal(t, "4775", merchant.Balance.String())
+}
+
+func TestFeeSchedule_Apply_SourceBears(t *testing.T) {
+	out, quote, err := cardFeeSchedule(blnkgo.FeeBearerSource).Apply(feeTransfer(50, "EUR"))
+	require.NoError(t, err)
+	assert.Equal(t, "5275", quote.Total.String())
+	assert.Equal(t, "5275", out.PreciseAmount.String())
+	require.Len(t, out.Destinations, 3)
+	assert.Equal(t, "225", out.Destinations[0].PreciseDistribution)
+	assert.Equal(t, "@fx_revenue", out.Destinations[1].Identifier)
+	assert.Equal(t, "50", out.Destinations[1].PreciseDistribution)
+}
+
+func TestFeeSchedule_Apply_RequiresSingleDestination(t *testing.T) {
+	body := feeTransfer(50, "USD")
+	body.Destination = ""
+	body.Destinations = []blnkgo.Source{{Identifier: "a", Distribution: "left"}}
+	_, _, err := cardFeeSchedule("").Apply(body)
+	assert.Error(t, err)
+}
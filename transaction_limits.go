@@ -0,0 +1,443 @@
+package blnkgo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LimitRule constrains debits from a source balance. Currency, MetaKey/MetaValue
+// and Balance narrow which transactions the rule applies to; an empty value
+// matches everything. Amounts are in minor units. Each rule is evaluated per
+// source balance.
+type LimitRule struct {
+	Name      string
+	Currency  string
+	MetaKey   string
+	MetaValue interface{}
+	Balance   string
+
+	// MaxAmount caps a single debit.
+	MaxAmount *big.Int
+	// MaxTotal caps the sum of debits within Window, including this one.
+	MaxTotal *big.Int
+	// MaxCount caps the number of debits within Window, including this one.
+	MaxCount int
+	Window   time.Duration
+}
+
+func (r LimitRule) applies(t CreateTransactionRequest, balance string) bool {
+	if r.Currency != "" && !strings.EqualFold(r.Currency, t.Currency) {
+		return false
+	}
+	if r.Balance != "" && r.Balance != balance {
+		return false
+	}
+	if r.MetaKey != "" {
+		v, ok := t.MetaData[r.MetaKey]
+		if !ok || (r.MetaValue != nil && fmt.Sprint(v) != fmt.Sprint(r.MetaValue)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r LimitRule) key(balance string) string {
+	return r.Name + "|" + balance
+}
+
+// ValidateLimitRule checks that a rule is named and sets at least one limit.
+func ValidateLimitRule(r LimitRule) error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("validation error: limit rule name is required")
+	}
+	if r.MaxAmount == nil && r.MaxTotal == nil && r.MaxCount == 0 {
+		return fmt.Errorf("validation error: limit rule %s must set max amount, max total or max count", r.Name)
+	}
+	if (r.MaxTotal != nil || r.MaxCount > 0) && r.Window <= 0 {
+		return fmt.Errorf("validation error: limit rule %s needs a positive window", r.Name)
+	}
+	if r.MaxCount < 0 {
+		return fmt.Errorf("validation error: limit rule %s max count must be non-negative", r.Name)
+	}
+	return nil
+}
+
+// LimitExceededError explains why a transaction was rejected.
+type LimitExceededError struct {
+	Rule      string
+	Balance   string
+	Reason    string
+	Limit     string
+	Current   string
+	Requested string
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("limit %s exceeded for %s: %s (limit %s, current %s, requested %s)",
+		e.Rule, e.Balance, e.Reason, e.Limit, e.Current, e.Requested)
+}
+
+// LimitUsage is the activity recorded for a rule and balance within a window.
+type LimitUsage struct {
+	Count int
+	Total *big.Int
+}
+
+// LimitCounterStore tracks usage for windowed rules. Implementations backed by
+// Redis or similar can be plugged in for high throughput; without a store the
+// engine reads recent transactions through TransactionService.Filter.
+type LimitCounterStore interface {
+	Usage(key string, since time.Time) (LimitUsage, error)
+	Record(key string, at time.Time, amount *big.Int) error
+}
+
+// LimitEngine evaluates limit rules before transactions are created.
+//
+// Without a store, usage is read from Core and counts settled (APPLIED or
+// COMMIT) debits plus the uncommitted part of open inflight holds; queued
+// transactions are not yet counted.
+type LimitEngine struct {
+	transactions *TransactionService
+	rules        []LimitRule
+	store        LimitCounterStore
+	locks        sync.Map
+}
+
+// NewLimitEngine validates rules and returns an engine. store may be nil, in
+// which case windowed rules are evaluated against TransactionService.Filter.
+func NewLimitEngine(transactions *TransactionService, rules []LimitRule, store LimitCounterStore) (*LimitEngine, error) {
+	names := make(map[string]struct{}, len(rules))
+	for _, r := range rules {
+		if err := ValidateLimitRule(r); err != nil {
+			return nil, err
+		}
+		if _, dup := names[r.Name]; dup {
+			return nil, fmt.Errorf("validation error: duplicate limit rule %s", r.Name)
+		}
+		names[r.Name] = struct{}{}
+	}
+	return &LimitEngine{transactions: transactions, rules: rules, store: store}, nil
+}
+
+// Check returns a *LimitExceededError for the first rule the transaction would
+// break, evaluated at now.
+func (e *LimitEngine) Check(body CreateTransactionRequest, now time.Time) error {
+	debits, err := e.debits(body)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range e.rules {
+		for _, debit := range debits {
+			if !rule.applies(body, debit.identifier) {
+				continue
+			}
+			if rule.MaxAmount != nil && debit.amount.Cmp(rule.MaxAmount) > 0 {
+				return &LimitExceededError{
+					Rule: rule.Name, Balance: debit.identifier, Reason: "amount above per-transaction maximum",
+					Limit: rule.MaxAmount.String(), Current: "0", Requested: debit.amount.String(),
+				}
+			}
+			if rule.MaxTotal == nil && rule.MaxCount == 0 {
+				continue
+			}
+
+			usage, err := e.usage(rule, body, debit.identifier, now.Add(-rule.Window))
+			if err != nil {
+				return err
+			}
+			if rule.MaxCount > 0 && usage.Count+1 > rule.MaxCount {
+				return &LimitExceededError{
+					Rule: rule.Name, Balance: debit.identifier, Reason: fmt.Sprintf("more than %d transactions in %s", rule.MaxCount, rule.Window),
+					Limit: fmt.Sprint(rule.MaxCount), Current: fmt.Sprint(usage.Count), Requested: "1",
+				}
+			}
+			if rule.MaxTotal != nil && new(big.Int).Add(usage.Total, debit.amount).Cmp(rule.MaxTotal) > 0 {
+				return &LimitExceededError{
+					Rule: rule.Name, Balance: debit.identifier, Reason: fmt.Sprintf("total above maximum for %s", rule.Window),
+					Limit: rule.MaxTotal.String(), Current: usage.Total.String(), Requested: debit.amount.String(),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Record adds a posted transaction to the counter store. It is a no-op when the
+// engine reads usage from Core.
+func (e *LimitEngine) Record(body CreateTransactionRequest, at time.Time) error {
+	if e.store == nil {
+		return nil
+	}
+	debits, err := e.debits(body)
+	if err != nil {
+		return err
+	}
+	for _, rule := range e.rules {
+		if rule.MaxTotal == nil && rule.MaxCount == 0 {
+			continue
+		}
+		for _, debit := range debits {
+			if !rule.applies(body, debit.identifier) {
+				continue
+			}
+			if err := e.store.Record(rule.key(debit.identifier), at, debit.amount); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Create checks every rule, creates the transaction and records it. Calls
+// debiting the same balance are serialized within this engine so two of them
+// cannot both pass a check that only one fits; engines in other processes
+// are not coordinated and can still race between Check and Create.
+func (e *LimitEngine) Create(body CreateTransactionRequest) (*Transaction, *http.Response, error) {
+	debits, err := e.debits(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	unlock := e.lockBalances(debits)
+	defer unlock()
+
+	now := time.Now()
+	if err := e.Check(body, now); err != nil {
+		return nil, nil, err
+	}
+	transaction, resp, err := e.transactions.Create(body)
+	if err != nil {
+		return nil, resp, err
+	}
+	if err := e.Record(body, now); err != nil {
+		return transaction, resp, err
+	}
+	return transaction, resp, nil
+}
+
+// lockBalances locks every debited balance in a fixed order and returns a
+// function releasing them.
+func (e *LimitEngine) lockBalances(debits []legAmount) func() {
+	ids := make([]string, 0, len(debits))
+	seen := make(map[string]struct{}, len(debits))
+	for _, d := range debits {
+		if _, ok := seen[d.identifier]; !ok {
+			seen[d.identifier] = struct{}{}
+			ids = append(ids, d.identifier)
+		}
+	}
+	sort.Strings(ids)
+
+	held := make([]*sync.Mutex, 0, len(ids))
+	for _, id := range ids {
+		lock, _ := e.locks.LoadOrStore(id, &sync.Mutex{})
+		mu := lock.(*sync.Mutex)
+		mu.Lock()
+		held = append(held, mu)
+	}
+	return func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].Unlock()
+		}
+	}
+}
+
+func (e *LimitEngine) debits(body CreateTransactionRequest) ([]legAmount, error) {
+	if err := ValidateCreateTransacation(body); err != nil {
+		return nil, err
+	}
+	total, err := transactionPreciseAmount(body.ParentTransaction)
+	if err != nil {
+		return nil, err
+	}
+	return resolveLegAmounts(body.Sources, body.Source, total, body.Precision)
+}
+
+func (e *LimitEngine) usage(rule LimitRule, body CreateTransactionRequest, balance string, since time.Time) (LimitUsage, error) {
+	if e.store != nil {
+		usage, err := e.store.Usage(rule.key(balance), since)
+		if err != nil {
+			return LimitUsage{}, err
+		}
+		if usage.Total == nil {
+			usage.Total = big.NewInt(0)
+		}
+		return usage, nil
+	}
+
+	filters := []Filter{
+		{Field: "created_at", Operator: OpGreaterThanOrEqual, Value: since.UTC().Format(time.RFC3339)},
+	}
+	if rule.Currency != "" {
+		filters = append(filters, Filter{Field: "currency", Operator: OpEqual, Value: body.Currency})
+	}
+	if rule.MetaKey != "" && rule.MetaValue != nil {
+		filters = append(filters, Filter{Field: "meta_data." + rule.MetaKey, Operator: OpEqual, Value: rule.MetaValue})
+	}
+
+	// Multi-source rows leave source empty and list the balance in sources;
+	// single-source rows name it in source.
+	multi, err := filterAll[Transaction](e.transactions.Filter, FilterParams{
+		Filters: append([]Filter{{Field: "source", Operator: OpIsNull}}, filters...),
+	})
+	if err != nil {
+		return LimitUsage{}, err
+	}
+	single, err := filterAll[Transaction](e.transactions.Filter, FilterParams{
+		Filters: append([]Filter{{Field: "source", Operator: OpEqual, Value: balance}}, filters...),
+	})
+	if err != nil {
+		return LimitUsage{}, err
+	}
+
+	rows := single
+	for _, txn := range multi {
+		if len(txn.Sources) > 0 {
+			rows = append(rows, txn)
+		}
+	}
+	children := make(map[string][]Transaction)
+	for _, txn := range rows {
+		if txn.ParentTransactionID != "" {
+			children[txn.ParentTransactionID] = append(children[txn.ParentTransactionID], txn)
+		}
+	}
+
+	usage := LimitUsage{Total: big.NewInt(0)}
+	for _, txn := range rows {
+		if rule.MetaKey != "" && rule.MetaValue == nil {
+			if _, ok := txn.MetaData[rule.MetaKey]; !ok {
+				continue
+			}
+		}
+		// A multi-source parent whose legs were recorded as children is
+		// counted through the children.
+		if len(txn.Sources) > 0 && len(children[txn.TransactionID]) > 0 {
+			continue
+		}
+		amount, err := limitLegAmount(txn, balance)
+		if err != nil {
+			return LimitUsage{}, err
+		}
+		if amount.Sign() == 0 {
+			continue
+		}
+
+		switch {
+		case txn.Status.IsSettled():
+			usage.Count++
+			usage.Total.Add(usage.Total, amount)
+		case txn.Status == PryTransactionStatusInFlight:
+			held, resolved, err := openHoldAmount(amount, children[txn.TransactionID], balance)
+			if err != nil {
+				return LimitUsage{}, err
+			}
+			if !resolved {
+				usage.Count++
+			}
+			usage.Total.Add(usage.Total, held)
+		}
+	}
+	return usage, nil
+}
+
+// limitLegAmount returns the part of txn debited from balance.
+func limitLegAmount(txn Transaction, balance string) (*big.Int, error) {
+	total, err := transactionPreciseAmount(txn.ParentTransaction)
+	if err != nil {
+		return nil, err
+	}
+	if len(txn.Sources) == 0 {
+		return total, nil
+	}
+	legs, err := resolveLegAmounts(txn.Sources, txn.Source, total, txn.Precision)
+	if err != nil {
+		return nil, err
+	}
+	amount := big.NewInt(0)
+	for _, leg := range legs {
+		if leg.identifier == balance {
+			amount.Add(amount, leg.amount)
+		}
+	}
+	return amount, nil
+}
+
+// openHoldAmount returns how much of an inflight hold is still held, and
+// whether any commit or void has resolved it. Commits are counted as their own
+// settled rows, so only the uncommitted remainder of a hold adds to usage.
+func openHoldAmount(amount *big.Int, children []Transaction, balance string) (*big.Int, bool, error) {
+	held := new(big.Int).Set(amount)
+	resolved := false
+	for _, child := range children {
+		switch {
+		case child.Status == PryTransactionStatusVoid:
+			return big.NewInt(0), true, nil
+		case child.Status.IsSettled():
+			committed, err := limitLegAmount(child, balance)
+			if err != nil {
+				return nil, false, err
+			}
+			held.Sub(held, committed)
+			resolved = true
+		}
+	}
+	if held.Sign() < 0 {
+		held.SetInt64(0)
+	}
+	return held, resolved, nil
+}
+
+// MemoryLimitStore is an in-process sliding-window LimitCounterStore. Entries
+// older than Retention are discarded on write.
+type MemoryLimitStore struct {
+	Retention time.Duration
+	events    map[string][]limitEvent
+	mu        sync.Mutex
+}
+
+type limitEvent struct {
+	at     time.Time
+	amount *big.Int
+}
+
+// NewMemoryLimitStore returns a store retaining events for retention, which
+// should be at least the longest rule window.
+func NewMemoryLimitStore(retention time.Duration) *MemoryLimitStore {
+	return &MemoryLimitStore{Retention: retention, events: make(map[string][]limitEvent)}
+}
+
+func (s *MemoryLimitStore) Usage(key string, since time.Time) (LimitUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := LimitUsage{Total: big.NewInt(0)}
+	events := s.events[key]
+	i := sort.Search(len(events), func(i int) bool { return !events[i].at.Before(since) })
+	for _, ev := range events[i:] {
+		usage.Count++
+		usage.Total.Add(usage.Total, ev.amount)
+	}
+	return usage, nil
+}
+
+func (s *MemoryLimitStore) Record(key string, at time.Time, amount *big.Int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := append(s.events[key], limitEvent{at: at, amount: new(big.Int).Set(amount)})
+	sort.SliceStable(events, func(i, j int) bool { return events[i].at.Before(events[j].at) })
+	if s.Retention > 0 {
+		cutoff := at.Add(-s.Retention)
+		i := sort.Search(len(events), func(i int) bool { return !events[i].at.Before(cutoff) })
+		events = events[i:]
+	}
+	s.events[key] = events
+	return nil
+}
@@ -0,0 +1,174 @@
+package blnkgo_test
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func limitTransaction(amount float64, category string) blnkgo.CreateTransactionRequest {
+	return blnkgo.CreateTransactionRequest{
+		ParentTransaction: blnkgo.ParentTransaction{
+			Amount:      amount,
+			Precision:   100,
+			Reference:   "ref_limit",
+			Description: "card spend",
+			Currency:    "USD",
+			Source:      "bln_wallet",
+			Destination: "bln_merchant",
+			MetaData:    blnkgo.MetaData{"category": category},
+		},
+	}
+}
+
+func TestValidateLimitRule(t *testing.T) {
+	assert.Error(t, blnkgo.ValidateLimitRule(blnkgo.LimitRule{}))
+	assert.Error(t, blnkgo.ValidateLimitRule(blnkgo.LimitRule{Name: "empty"}))
+	assert.Error(t, blnkgo.ValidateLimitRule(blnkgo.LimitRule{Name: "daily", MaxCount: 5}))
+	assert.NoError(t, blnkgo.ValidateLimitRule(blnkgo.LimitRule{Name: "cap", MaxAmount: big.NewInt(100)}))
+
+	_, err := blnkgo.NewLimitEngine(nil, []blnkgo.LimitRule{
+		{Name: "cap", MaxAmount: big.NewInt(1)},
+		{Name: "cap", MaxAmount: big.NewInt(2)},
+	}, nil)
+	assert.Error(t, err)
+}
+
+func TestLimitEngine_Check_MaxAmount(t *testing.T) {
+	engine, err := blnkgo.NewLimitEngine(nil, []blnkgo.LimitRule{
+		{Name: "usd_cap", Currency: "USD", MaxAmount: big.NewInt(50000)},
+	}, nil)
+	require.NoError(t, err)
+
+	assert.NoError(t, engine.Check(limitTransaction(500, "food"), time.Now()))
+
+	err = engine.Check(limitTransaction(500.01, "food"), time.Now())
+	var limitErr *blnkgo.LimitExceededError
+	require.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, "usd_cap", limitErr.Rule)
+	assert.Equal(t, "bln_wallet", limitErr.Balance)
+	assert.Equal(t, "50001", limitErr.Requested)
+
+	body := limitTransaction(900, "food")
+	body.Currency = "EUR"
+	assert.NoError(t, engine.Check(body, time.Now()))
+}
+
+func TestLimitEngine_Check_MemoryStoreWindow(t *testing.T) {
+	store := blnkgo.NewMemoryLimitStore(24 * time.Hour)
+	engine, err := blnkgo.NewLimitEngine(nil, []blnkgo.LimitRule{
+		{Name: "daily_gambling", MetaKey: "category", MetaValue: "gambling", MaxTotal: big.NewInt(10000), MaxCount: 2, Window: 24 * time.Hour},
+	}, store)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, engine.Record(limitTransaction(60, "gambling"), now.Add(-25*time.Hour)))
+	require.NoError(t, engine.Record(limitTransaction(60, "gambling"), now.Add(-time.Hour)))
+	require.NoError(t, engine.Record(limitTransaction(500, "food"), now.Add(-time.Hour)))
+
+	assert.NoError(t, engine.Check(limitTransaction(40, "gambling"), now))
+	assert.NoError(t, engine.Check(limitTransaction(1000, "food"), now))
+
+	err = engine.Check(limitTransaction(40.01, "gambling"), now)
+	var limitErr *blnkgo.LimitExceededError
+	require.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, "6000", limitErr.Current)
+
+	require.NoError(t, engine.Record(limitTransaction(1, "gambling"), now))
+	err = engine.Check(limitTransaction(1, "gambling"), now)
+	require.True(t, errors.As(err, &limitErr))
+	assert.Contains(t, limitErr.Reason, "more than 2 transactions")
+}
+
+func TestLimitEngine_Check_FromFilter(t *testing.T) {
+	mockClient, svc := setupTransactionService()
+	var sent blnkgo.FilterParams
+	mockClient.On("NewRequest", "transactions/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		sent = args.Get(2).(blnkgo.FilterParams)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.FilterResponse).Data = []interface{}{
+			map[string]interface{}{"transaction_id": "txn_1", "precise_amount": 30000, "status": "APPLIED"},
+			map[string]interface{}{"transaction_id": "txn_2", "precise_amount": 50000, "status": "REJECTED"},
+		}
+	})
+
+	engine, err := blnkgo.NewLimitEngine(svc, []blnkgo.LimitRule{
+		{Name: "weekly", Currency: "USD", MaxTotal: big.NewInt(50000), Window: 7 * 24 * time.Hour},
+	}, nil)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, engine.Check(limitTransaction(200, "food"), now))
+	assert.Equal(t, blnkgo.Filter{Field: "source", Operator: blnkgo.OpEqual, Value: "bln_wallet"}, sent.Filters[0])
+	assert.Equal(t, "2024-05-01T00:00:00Z", sent.Filters[1].Value)
+
+	err = engine.Check(limitTransaction(200.01, "food"), now)
+	var limitErr *blnkgo.LimitExceededError
+	assert.True(t, errors.As(err, &limitErr))
+}
+
+func TestLimitEngine_Check_FromFilterCountsLegsAndHoldsOnce(t *testing.T) {
+	mockClient, svc := setupTransactionService()
+	var operator blnkgo.Operator
+	mockClient.On("NewRequest", "transactions/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		operator = args.Get(2).(blnkgo.FilterParams).Filters[0].Operator
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		if operator == blnkgo.OpIsNull {
+			args.Get(1).(*blnkgo.FilterResponse).Data = []interface{}{
+				map[string]interface{}{"transaction_id": "txn_multi", "precise_amount": 30000, "precision": 100, "status": "APPLIED", "sources": []interface{}{
+					map[string]interface{}{"identifier": "bln_wallet", "distribution": "10%"},
+					map[string]interface{}{"identifier": "bln_other", "distribution": "left"},
+				}},
+				map[string]interface{}{"transaction_id": "txn_elsewhere", "precise_amount": 90000, "status": "APPLIED"},
+			}
+			return
+		}
+		args.Get(1).(*blnkgo.FilterResponse).Data = []interface{}{
+			map[string]interface{}{"transaction_id": "txn_1", "precise_amount": 10000, "status": "APPLIED"},
+			map[string]interface{}{"transaction_id": "txn_hold", "precise_amount": 20000, "status": "INFLIGHT"},
+			map[string]interface{}{"transaction_id": "txn_commit", "precise_amount": 20000, "status": "APPLIED", "parent_transaction": "txn_hold"},
+			map[string]interface{}{"transaction_id": "txn_partial", "precise_amount": 8000, "status": "INFLIGHT"},
+			map[string]interface{}{"transaction_id": "txn_partial_commit", "precise_amount": 3000, "status": "COMMIT", "parent_transaction": "txn_partial"},
+			map[string]interface{}{"transaction_id": "txn_voided", "precise_amount": 9000, "status": "INFLIGHT"},
+			map[string]interface{}{"transaction_id": "txn_void", "precise_amount": 9000, "status": "VOID", "parent_transaction": "txn_voided"},
+			map[string]interface{}{"transaction_id": "txn_queued", "precise_amount": 7000, "status": "QUEUED"},
+			map[string]interface{}{"transaction_id": "txn_rejected", "precise_amount": 7000, "status": "REJECTED"},
+		}
+	})
+
+	// 10000 + 20000 (hold counted once, through its commit) + 3000 + 5000
+	// still held + 3000 (10% leg of txn_multi) = 41000 across 4 debits.
+	engine, err := blnkgo.NewLimitEngine(svc, []blnkgo.LimitRule{
+		{Name: "weekly", MaxTotal: big.NewInt(42000), MaxCount: 5, Window: 7 * 24 * time.Hour},
+	}, nil)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, engine.Check(limitTransaction(10, "food"), now))
+
+	err = engine.Check(limitTransaction(10.01, "food"), now)
+	var limitErr *blnkgo.LimitExceededError
+	require.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, "41000", limitErr.Current)
+}
+
+func TestLimitEngine_Create_RejectsWithoutPosting(t *testing.T) {
+	mockClient, svc := setupTransactionService()
+	engine, err := blnkgo.NewLimitEngine(svc, []blnkgo.LimitRule{
+		{Name: "cap", MaxAmount: big.NewInt(100)},
+	}, blnkgo.NewMemoryLimitStore(time.Hour))
+	require.NoError(t, err)
+
+	_, _, err = engine.Create(limitTransaction(5, "food"))
+	assert.Error(t, err)
+	mockClient.AssertNotCalled(t, "NewRequest", "transactions", http.MethodPost, mock.Anything)
+}
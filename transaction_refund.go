@@ -0,0 +1,224 @@
+package blnkgo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+)
+
+// Metadata keys linking a partial refund to the transaction it refunds.
+const (
+	RefundOfMetaKey          = "refund_of"
+	RefundOfReferenceMetaKey = "refund_of_reference"
+)
+
+// ErrRefundExceedsRemaining is returned when a partial refund is larger than the
+// amount still refundable.
+var ErrRefundExceedsRemaining = errors.New("refund exceeds remaining refundable amount")
+
+// PartialRefundRequest describes a partial refund. Amount is in major units and
+// converted with the original transaction's precision; PreciseAmount (minor
+// units) takes precedence when set. Reference defaults to
+// "<original reference>_refund_<n>" so concurrent duplicates are rejected by Core.
+type PartialRefundRequest struct {
+	Amount         float64
+	PreciseAmount  *big.Int
+	Reference      string
+	Description    string
+	MetaData       MetaData
+	SkipQueue      bool
+	AllowOverdraft bool
+}
+
+// RefundSummary is the refund position of a transaction in minor units.
+// Refunded counts settled refunds only; Pending holds refunds that are still
+// queued or inflight. Remaining subtracts both so a new refund cannot exceed
+// the original while earlier ones are in progress.
+type RefundSummary struct {
+	TransactionID  string        `json:"transaction_id"`
+	Reference      string        `json:"reference"`
+	Currency       string        `json:"currency"`
+	Precision      int64         `json:"precision"`
+	OriginalAmount *big.Int      `json:"original_amount"`
+	Refunded       *big.Int      `json:"refunded"`
+	Pending        *big.Int      `json:"pending"`
+	Remaining      *big.Int      `json:"remaining"`
+	Refunds        []Transaction `json:"refunds"`
+}
+
+// FullyRefunded reports whether nothing remains to be refunded.
+func (r *RefundSummary) FullyRefunded() bool {
+	return r.Remaining.Sign() <= 0
+}
+
+// RefundSummary returns how much of a transaction has been refunded, both by
+// RefundPartial (linked through parent_transaction and meta_data.refund_of)
+// and by Core's full refund (linked through parent_transaction with source
+// and destination swapped). Rejected, voided and expired refunds are listed
+// but not counted.
+func (s *TransactionService) RefundSummary(transactionID string) (*RefundSummary, *http.Response, error) {
+	original, resp, err := s.Get(transactionID)
+	if err != nil {
+		return nil, resp, err
+	}
+	return s.refundSummary(original)
+}
+
+func (s *TransactionService) refundSummary(original *Transaction) (*RefundSummary, *http.Response, error) {
+	total, err := transactionPreciseAmount(original.ParentTransaction)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byMeta, err := filterAll[Transaction](s.Filter, FilterParams{
+		Filters:   []Filter{{Field: "meta_data." + RefundOfMetaKey, Operator: OpEqual, Value: original.TransactionID}},
+		SortBy:    "created_at",
+		SortOrder: "asc",
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	children, err := filterAll[Transaction](s.Filter, FilterParams{
+		Filters:   []Filter{{Field: "parent_transaction", Operator: OpEqual, Value: original.TransactionID}},
+		SortBy:    "created_at",
+		SortOrder: "asc",
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	summary := &RefundSummary{
+		TransactionID:  original.TransactionID,
+		Reference:      original.Reference,
+		Currency:       original.Currency,
+		Precision:      original.Precision,
+		OriginalAmount: total,
+		Refunded:       big.NewInt(0),
+		Pending:        big.NewInt(0),
+	}
+
+	seen := make(map[string]struct{})
+	add := func(refund Transaction) error {
+		if _, ok := seen[refund.TransactionID]; ok {
+			return nil
+		}
+		seen[refund.TransactionID] = struct{}{}
+		summary.Refunds = append(summary.Refunds, refund)
+		var into *big.Int
+		switch {
+		case refund.Status.IsSettled():
+			into = summary.Refunded
+		case refund.Status == PryTransactionStatusQueued || refund.Status == PryTransactionStatusInFlight:
+			into = summary.Pending
+		default:
+			return nil
+		}
+		amount, err := transactionPreciseAmount(refund.ParentTransaction)
+		if err != nil {
+			return err
+		}
+		into.Add(into, amount)
+		return nil
+	}
+
+	for _, refund := range byMeta {
+		if err := add(refund); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, child := range children {
+		if child.Source != original.Destination || child.Destination != original.Source {
+			continue
+		}
+		if err := add(child); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	summary.Remaining = new(big.Int).Sub(total, summary.Refunded)
+	summary.Remaining.Sub(summary.Remaining, summary.Pending)
+	if summary.Remaining.Sign() < 0 {
+		summary.Remaining.SetInt64(0)
+	}
+	return summary, nil, nil
+}
+
+// RefundPartial refunds part of a transaction by posting a reversal (source and
+// destination swapped) linked to the original through parent_transaction and
+// metadata. It may be called several times; each call checks the remaining
+// refundable amount first.
+func (s *TransactionService) RefundPartial(transactionID string, body PartialRefundRequest) (*Transaction, *http.Response, error) {
+	if transactionID == "" {
+		return nil, nil, fmt.Errorf("transactionID is required")
+	}
+	if body.PreciseAmount == nil && body.Amount <= 0 {
+		return nil, nil, errors.New("validation error: amount or precise_amount is required")
+	}
+	if body.PreciseAmount != nil && body.PreciseAmount.Sign() <= 0 {
+		return nil, nil, errors.New("validation error: precise_amount must be positive")
+	}
+
+	original, resp, err := s.Get(transactionID)
+	if err != nil {
+		return nil, resp, err
+	}
+	if err := CheckTransactionAction(transactionID, original.Status, TransactionActionRefund); err != nil {
+		return nil, nil, err
+	}
+	if original.Source == "" || original.Destination == "" {
+		return nil, nil, errors.New("validation error: partial refunds require a single source and destination")
+	}
+
+	amount := body.PreciseAmount
+	if amount == nil {
+		amount, err = majorToMinorUnits(strconv.FormatFloat(body.Amount, 'f', -1, 64), original.Precision)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	summary, resp, err := s.refundSummary(original)
+	if err != nil {
+		return nil, resp, err
+	}
+	if amount.Cmp(summary.Remaining) > 0 {
+		return nil, nil, fmt.Errorf("%w: requested %s, remaining %s", ErrRefundExceedsRemaining, amount, summary.Remaining)
+	}
+
+	reference := body.Reference
+	if reference == "" {
+		reference = fmt.Sprintf("%s_refund_%d", original.Reference, len(summary.Refunds)+1)
+	}
+	description := body.Description
+	if description == "" {
+		description = fmt.Sprintf("Refund of %s", original.Reference)
+	}
+	meta := make(MetaData, len(body.MetaData)+2)
+	for k, v := range body.MetaData {
+		meta[k] = v
+	}
+	meta[RefundOfMetaKey] = original.TransactionID
+	meta[RefundOfReferenceMetaKey] = original.Reference
+
+	precision := original.Precision
+	if precision == 0 {
+		precision = 1
+	}
+	return s.Create(CreateTransactionRequest{
+		ParentTransactionID: original.TransactionID,
+		ParentTransaction: ParentTransaction{
+			PreciseAmount: amount,
+			Precision:     precision,
+			Reference:     reference,
+			Description:   description,
+			Currency:      original.Currency,
+			Source:        original.Destination,
+			Destination:   original.Source,
+			SkipQueue:     body.SkipQueue,
+			MetaData:      meta,
+		},
+		AllowOverdraft: body.AllowOverdraft,
+	})
+}
@@ -0,0 +1,139 @@
+package blnkgo_test
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+	"testing"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func refundOriginal(status blnkgo.PryTransactionStatus) blnkgo.Transaction {
+	return blnkgo.Transaction{
+		TransactionID: "txn_orig",
+		ParentTransaction: blnkgo.ParentTransaction{
+			Amount:        100,
+			PreciseAmount: big.NewInt(10000),
+			Precision:     100,
+			Currency:      "USD",
+			Reference:     "order_1",
+			Source:        "bln_customer",
+			Destination:   "bln_merchant",
+			Status:        status,
+		},
+	}
+}
+
+// mockRefundLookups wires Get for the original and the two refund filters.
+func mockRefundLookups(mockClient *MockClient, original blnkgo.Transaction, byMeta, children []interface{}) {
+	mockClient.On("NewRequest", "transactions/"+original.TransactionID, http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*blnkgo.Transaction) = original
+	}).Once()
+
+	var lastField string
+	mockClient.On("NewRequest", "transactions/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		lastField = args.Get(2).(blnkgo.FilterParams).Filters[0].Field
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		response := args.Get(1).(*blnkgo.FilterResponse)
+		if lastField == "parent_transaction" {
+			response.Data = children
+		} else {
+			response.Data = byMeta
+		}
+	})
+}
+
+func TestTransactionService_RefundSummary(t *testing.T) {
+	mockClient, svc := setupTransactionService()
+	mockRefundLookups(mockClient, refundOriginal(blnkgo.PryTransactionStatusApplied),
+		[]interface{}{
+			map[string]interface{}{"transaction_id": "txn_r1", "precise_amount": 2500, "status": "APPLIED", "source": "bln_merchant", "destination": "bln_customer"},
+			map[string]interface{}{"transaction_id": "txn_r2", "precise_amount": 1000, "status": "REJECTED", "source": "bln_merchant", "destination": "bln_customer"},
+			map[string]interface{}{"transaction_id": "txn_r3", "precise_amount": 1500, "status": "QUEUED", "source": "bln_merchant", "destination": "bln_customer"},
+		},
+		[]interface{}{
+			map[string]interface{}{"transaction_id": "txn_r1", "precise_amount": 2500, "status": "APPLIED", "source": "bln_merchant", "destination": "bln_customer"},
+			map[string]interface{}{"transaction_id": "txn_core", "precise_amount": 500, "status": "APPLIED", "source": "bln_merchant", "destination": "bln_customer"},
+			map[string]interface{}{"transaction_id": "txn_commit", "precise_amount": 9999, "status": "APPLIED", "source": "bln_customer", "destination": "bln_merchant"},
+		})
+
+	summary, _, err := svc.RefundSummary("txn_orig")
+	require.NoError(t, err)
+	assert.Equal(t, "10000", summary.OriginalAmount.String())
+	assert.Equal(t, "3000", summary.Refunded.String())
+	assert.Equal(t, "1500", summary.Pending.String())
+	assert.Equal(t, "5500", summary.Remaining.String())
+	assert.Len(t, summary.Refunds, 4)
+	assert.False(t, summary.FullyRefunded())
+}
+
+func TestTransactionService_RefundPartial_Success(t *testing.T) {
+	mockClient, svc := setupTransactionService()
+	mockRefundLookups(mockClient, refundOriginal(blnkgo.PryTransactionStatusApplied),
+		[]interface{}{
+			map[string]interface{}{"transaction_id": "txn_r1", "precise_amount": 2500, "status": "APPLIED"},
+		}, nil)
+
+	var posted blnkgo.CreateTransactionRequest
+	mockClient.On("NewRequest", "transactions", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		posted = args.Get(2).(blnkgo.CreateTransactionRequest)
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusCreated}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.Transaction).TransactionID = "txn_r2"
+	})
+
+	refund, _, err := svc.RefundPartial("txn_orig", blnkgo.PartialRefundRequest{Amount: 12.5})
+	require.NoError(t, err)
+	assert.Equal(t, "txn_r2", refund.TransactionID)
+
+	assert.Equal(t, "1250", posted.PreciseAmount.String())
+	assert.Equal(t, "bln_merchant", posted.Source)
+	assert.Equal(t, "bln_customer", posted.Destination)
+	assert.Equal(t, "order_1_refund_2", posted.Reference)
+	assert.Equal(t, "txn_orig", posted.MetaData[blnkgo.RefundOfMetaKey])
+	assert.Equal(t, "txn_orig", posted.ParentTransactionID)
+}
+
+func TestTransactionService_RefundPartial_OverRefund(t *testing.T) {
+	mockClient, svc := setupTransactionService()
+	mockRefundLookups(mockClient, refundOriginal(blnkgo.PryTransactionStatusApplied),
+		[]interface{}{
+			map[string]interface{}{"transaction_id": "txn_r1", "precise_amount": 9000, "status": "APPLIED"},
+		}, nil)
+
+	_, _, err := svc.RefundPartial("txn_orig", blnkgo.PartialRefundRequest{PreciseAmount: big.NewInt(1001)})
+	assert.True(t, errors.Is(err, blnkgo.ErrRefundExceedsRemaining))
+	assert.Contains(t, err.Error(), "remaining 1000")
+	mockClient.AssertNotCalled(t, "NewRequest", "transactions", http.MethodPost, mock.Anything)
+}
+
+func TestTransactionService_RefundPartial_NotRefundable(t *testing.T) {
+	mockClient, svc := setupTransactionService()
+	original := refundOriginal(blnkgo.PryTransactionStatusInFlight)
+	mockClient.On("NewRequest", "transactions/txn_orig", http.MethodGet, nil).Return(&http.Request{}, nil)
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.Transaction")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*blnkgo.Transaction) = original
+	})
+
+	_, _, err := svc.RefundPartial("txn_orig", blnkgo.PartialRefundRequest{Amount: 1})
+	var statusErr *blnkgo.TransactionStatusError
+	assert.True(t, errors.As(err, &statusErr))
+}
+
+func TestTransactionService_RefundPartial_Validation(t *testing.T) {
+	mockClient, svc := setupTransactionService()
+
+	_, _, err := svc.RefundPartial("", blnkgo.PartialRefundRequest{Amount: 1})
+	assert.Error(t, err)
+	_, _, err = svc.RefundPartial("txn_orig", blnkgo.PartialRefundRequest{})
+	assert.Error(t, err)
+	_, _, err = svc.RefundPartial("txn_orig", blnkgo.PartialRefundRequest{PreciseAmount: big.NewInt(-5)})
+	assert.Error(t, err)
+	mockClient.AssertNotCalled(t, "NewRequest")
+}
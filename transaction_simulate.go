@@ -0,0 +1,325 @@
+package blnkgo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// SimulationResult is the projected effect of one or more transactions on a set
+// of balances. Balances are copies of the supplied snapshots (plus zero-value
+// balances for identifiers that were not supplied) in the order they were first
+// touched; the originals are never modified.
+type SimulationResult struct {
+	Balances   []LedgerBalance      `json:"balances"`
+	Violations []OverdraftViolation `json:"violations,omitempty"`
+}
+
+// OverdraftViolation reports a source balance whose projected available amount
+// (Balance minus InflightDebitBalance) would go negative without AllowOverdraft.
+type OverdraftViolation struct {
+	Reference  string   `json:"reference"`
+	Identifier string   `json:"identifier"`
+	Available  *big.Int `json:"available"`
+	Shortfall  *big.Int `json:"shortfall"`
+}
+
+// Balance returns the projected balance for a balance ID or indicator.
+func (r *SimulationResult) Balance(identifier string) (*LedgerBalance, bool) {
+	for i := range r.Balances {
+		if r.Balances[i].BalanceID == identifier || (r.Balances[i].Indicator != "" && r.Balances[i].Indicator == identifier) {
+			return &r.Balances[i], true
+		}
+	}
+	return nil, false
+}
+
+// HasViolations reports whether any source balance would be overdrawn.
+func (r *SimulationResult) HasViolations() bool {
+	return len(r.Violations) > 0
+}
+
+// Simulate projects the effect of a transaction on the supplied balance snapshots
+// without calling Core. Split legs are resolved with the same distribution rules
+// Core applies (precise_distribution, percentages, fixed amounts, then "left"),
+// inflight transactions only move the inflight fields, and Rate is applied to
+// destination credits.
+func Simulate(body CreateTransactionRequest, balances []LedgerBalance) (*SimulationResult, error) {
+	if err := ValidateCreateTransacation(body); err != nil {
+		return nil, err
+	}
+
+	sim := newBalanceSimulator(balances)
+	if err := sim.apply(body, body.Inflight); err != nil {
+		return nil, err
+	}
+	return sim.result(), nil
+}
+
+// SimulateBulk projects every transaction in a bulk request in order, as Core
+// would apply them, and reports all overdraft violations.
+func SimulateBulk(body CreateBulkTransactionRequest, balances []LedgerBalance) (*SimulationResult, error) {
+	if err := ValidateCreateBulkTransaction(body); err != nil {
+		return nil, err
+	}
+
+	sim := newBalanceSimulator(balances)
+	for i, tx := range body.Transactions {
+		if err := sim.apply(tx, body.Inflight || tx.Inflight); err != nil {
+			return nil, fmt.Errorf("transaction at index %d: %w", i, err)
+		}
+	}
+	return sim.result(), nil
+}
+
+type balanceSimulator struct {
+	snapshots  map[string]LedgerBalance
+	projected  map[string]*LedgerBalance
+	order      []string
+	violations []OverdraftViolation
+}
+
+func newBalanceSimulator(balances []LedgerBalance) *balanceSimulator {
+	sim := &balanceSimulator{
+		snapshots: make(map[string]LedgerBalance, len(balances)*2),
+		projected: make(map[string]*LedgerBalance),
+	}
+	for _, b := range balances {
+		if b.BalanceID != "" {
+			sim.snapshots[b.BalanceID] = b
+		}
+		if b.Indicator != "" {
+			sim.snapshots[b.Indicator] = b
+		}
+	}
+	return sim
+}
+
+func (s *balanceSimulator) balance(identifier, currency string) (*LedgerBalance, error) {
+	key := identifier
+	snapshot, known := s.snapshots[identifier]
+	if known && snapshot.BalanceID != "" {
+		key = snapshot.BalanceID
+	}
+	if b, ok := s.projected[key]; ok {
+		return b, nil
+	}
+
+	var b LedgerBalance
+	if known {
+		b = snapshot
+	} else if strings.HasPrefix(identifier, "@") {
+		b = LedgerBalance{Indicator: identifier, Currency: currency}
+	} else {
+		b = LedgerBalance{BalanceID: identifier, Currency: currency}
+	}
+	if b.Currency != "" && currency != "" && !strings.EqualFold(b.Currency, currency) {
+		return nil, fmt.Errorf("simulation error: balance %s has currency %s, transaction uses %s", identifier, b.Currency, currency)
+	}
+
+	b.Balance = cloneBigInt(b.Balance)
+	b.CreditBalance = cloneBigInt(b.CreditBalance)
+	b.DebitBalance = cloneBigInt(b.DebitBalance)
+	b.InflightBalance = cloneBigInt(b.InflightBalance)
+	b.InflightCreditBalance = cloneBigInt(b.InflightCreditBalance)
+	b.InflightDebitBalance = cloneBigInt(b.InflightDebitBalance)
+	b.QueuedDebitBalance = cloneBigInt(b.QueuedDebitBalance)
+	b.QueuedCreditBalance = cloneBigInt(b.QueuedCreditBalance)
+
+	s.projected[key] = &b
+	s.order = append(s.order, key)
+	return &b, nil
+}
+
+func (s *balanceSimulator) apply(t CreateTransactionRequest, inflight bool) error {
+	total, err := transactionPreciseAmount(t.ParentTransaction)
+	if err != nil {
+		return err
+	}
+
+	sources, err := resolveLegAmounts(t.Sources, t.Source, total, t.Precision)
+	if err != nil {
+		return err
+	}
+
+	credited := total
+	if t.Rate != 0 && t.Rate != 1 {
+		credited, err = scaleBigInt(total, t.Rate)
+		if err != nil {
+			return err
+		}
+	}
+	destinations, err := resolveLegAmounts(t.Destinations, t.Destination, credited, t.Precision)
+	if err != nil {
+		return err
+	}
+
+	for _, leg := range sources {
+		b, err := s.balance(leg.identifier, t.Currency)
+		if err != nil {
+			return err
+		}
+		if inflight {
+			b.InflightDebitBalance.Add(b.InflightDebitBalance, leg.amount)
+			b.InflightBalance.Sub(b.InflightBalance, leg.amount)
+		} else {
+			b.DebitBalance.Add(b.DebitBalance, leg.amount)
+			b.Balance.Sub(b.Balance, leg.amount)
+		}
+
+		available := new(big.Int).Sub(b.Balance, b.InflightDebitBalance)
+		if !t.AllowOverdraft && available.Sign() < 0 {
+			s.violations = append(s.violations, OverdraftViolation{
+				Reference:  t.Reference,
+				Identifier: leg.identifier,
+				Available:  available,
+				Shortfall:  new(big.Int).Neg(available),
+			})
+		}
+	}
+
+	for _, leg := range destinations {
+		b, err := s.balance(leg.identifier, t.Currency)
+		if err != nil {
+			return err
+		}
+		if inflight {
+			b.InflightCreditBalance.Add(b.InflightCreditBalance, leg.amount)
+			b.InflightBalance.Add(b.InflightBalance, leg.amount)
+		} else {
+			b.CreditBalance.Add(b.CreditBalance, leg.amount)
+			b.Balance.Add(b.Balance, leg.amount)
+		}
+	}
+
+	return nil
+}
+
+func (s *balanceSimulator) result() *SimulationResult {
+	result := &SimulationResult{
+		Balances:   make([]LedgerBalance, 0, len(s.order)),
+		Violations: s.violations,
+	}
+	for _, key := range s.order {
+		result.Balances = append(result.Balances, *s.projected[key])
+	}
+	return result
+}
+
+type legAmount struct {
+	identifier string
+	amount     *big.Int
+}
+
+// resolveLegAmounts splits total (minor units) across legs. Fixed distributions
+// are in major units and scaled by precision, percentages are floored, and the
+// remainder goes to the "left" leg. Without a "left" leg the legs must add up
+// to total exactly, as Core requires.
+func resolveLegAmounts(legs []Source, single string, total *big.Int, precision int64) ([]legAmount, error) {
+	if single != "" {
+		return []legAmount{{identifier: single, amount: new(big.Int).Set(total)}}, nil
+	}
+
+	amounts := make([]legAmount, len(legs))
+	allocated := big.NewInt(0)
+	leftIndex := -1
+
+	for i, leg := range legs {
+		amounts[i].identifier = leg.Identifier
+		switch {
+		case hasPreciseDistribution(leg):
+			n, ok := parsePreciseInteger(leg.PreciseDistribution)
+			if !ok {
+				return nil, fmt.Errorf("simulation error: invalid precise_distribution for leg: %s", leg.Identifier)
+			}
+			amounts[i].amount = n
+		case leg.Distribution.IsLeft():
+			leftIndex = i
+			continue
+		case leg.Distribution.IsPercentage():
+			pct, ok := new(big.Rat).SetString(strings.TrimSuffix(string(leg.Distribution), "%"))
+			if !ok {
+				return nil, fmt.Errorf("simulation error: invalid distribution for leg: %s", leg.Identifier)
+			}
+			part := new(big.Rat).Mul(new(big.Rat).SetInt(total), pct)
+			part.Quo(part, big.NewRat(100, 1))
+			amounts[i].amount = new(big.Int).Quo(part.Num(), part.Denom())
+		case leg.Distribution.IsNumber():
+			n, err := majorToMinorUnits(string(leg.Distribution), precision)
+			if err != nil {
+				return nil, fmt.Errorf("simulation error: invalid distribution for leg: %s", leg.Identifier)
+			}
+			amounts[i].amount = n
+		default:
+			return nil, fmt.Errorf("simulation error: invalid distribution for leg: %s", leg.Identifier)
+		}
+		allocated.Add(allocated, amounts[i].amount)
+	}
+
+	remaining := new(big.Int).Sub(total, allocated)
+	if remaining.Sign() < 0 {
+		return nil, errors.New("simulation error: total distribution exceeds the specified amount")
+	}
+	if leftIndex >= 0 {
+		amounts[leftIndex].amount = remaining
+	} else if remaining.Sign() > 0 {
+		return nil, fmt.Errorf("simulation error: distributions leave %s unallocated; add a \"left\" leg", remaining)
+	}
+	return amounts, nil
+}
+
+// transactionPreciseAmount returns the transaction amount in minor units:
+// PreciseAmount when set, otherwise Amount multiplied by Precision.
+func transactionPreciseAmount(t ParentTransaction) (*big.Int, error) {
+	if t.PreciseAmount != nil {
+		if t.PreciseAmount.Sign() < 0 {
+			return nil, errors.New("validation error: precise_amount must be non-negative")
+		}
+		return new(big.Int).Set(t.PreciseAmount), nil
+	}
+	return majorToMinorUnits(strconv.FormatFloat(t.Amount, 'f', -1, 64), t.Precision)
+}
+
+// majorToMinorUnits converts a decimal major-unit string to minor units using
+// Core's precision multiplier, rounding half away from zero. A zero precision is
+// treated as 1.
+func majorToMinorUnits(amount string, precision int64) (*big.Int, error) {
+	r, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount: %s", amount)
+	}
+	if precision == 0 {
+		precision = 1
+	}
+	r.Mul(r, new(big.Rat).SetInt64(precision))
+	return roundRat(r), nil
+}
+
+func scaleBigInt(n *big.Int, factor float64) (*big.Int, error) {
+	f, ok := new(big.Rat).SetString(strconv.FormatFloat(factor, 'f', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("invalid rate: %v", factor)
+	}
+	return roundRat(new(big.Rat).Mul(new(big.Rat).SetInt(n), f)), nil
+}
+
+func roundRat(r *big.Rat) *big.Int {
+	num := new(big.Int).Abs(r.Num())
+	q, m := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	if new(big.Int).Mul(m, big.NewInt(2)).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q
+}
+
+func cloneBigInt(n *big.Int) *big.Int {
+	if n == nil {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(n)
+}
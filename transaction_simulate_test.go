@@ -0,0 +1,206 @@
+package blnkgo_test
+
+import (
+	"math/big"
+	"testing"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func simulationBalance(id string, credit, debit int64) blnkgo.LedgerBalance {
+	return blnkgo.LedgerBalance{
+		BalanceID:     id,
+		Currency:      "USD",
+		Balance:       big.NewInt(credit - debit),
+		CreditBalance: big.NewInt(credit),
+		DebitBalance:  big.NewInt(debit),
+	}
+}
+
+func TestSimulate_SingleLeg(t *testing.T) {
+	balances := []blnkgo.LedgerBalance{
+		simulationBalance("bln_source", 10000, 0),
+		simulationBalance("bln_dest", 0, 0),
+	}
+
+	result, err := blnkgo.Simulate(blnkgo.CreateTransactionRequest{
+		ParentTransaction: blnkgo.ParentTransaction{
+			Amount:      25.5,
+			Precision:   100,
+			Currency:    "USD",
+			Reference:   "ref_sim_1",
+			Source:      "bln_source",
+			Destination: "bln_dest",
+		},
+	}, balances)
+
+	require.NoError(t, err)
+	assert.False(t, result.HasViolations())
+
+	source, ok := result.Balance("bln_source")
+	require.True(t, ok)
+	assert.Equal(t, "7450", source.Balance.String())
+	assert.Equal(t, "2550", source.DebitBalance.String())
+
+	dest, ok := result.Balance("bln_dest")
+	require.True(t, ok)
+	assert.Equal(t, "2550", dest.Balance.String())
+	assert.Equal(t, "2550", dest.CreditBalance.String())
+
+	// Snapshots passed in must not be mutated.
+	assert.Equal(t, "10000", balances[0].Balance.String())
+}
+
+func TestSimulate_SplitDestinations(t *testing.T) {
+	result, err := blnkgo.Simulate(blnkgo.CreateTransactionRequest{
+		ParentTransaction: blnkgo.ParentTransaction{
+			Amount:    100,
+			Precision: 100,
+			Currency:  "USD",
+			Reference: "ref_sim_split",
+			Source:    "bln_source",
+			Destinations: []blnkgo.Source{
+				{Identifier: "bln_fee", Distribution: "10%"},
+				{Identifier: "bln_tax", Distribution: "5"},
+				{Identifier: "bln_merchant", Distribution: "left"},
+			},
+		},
+		AllowOverdraft: true,
+	}, nil)
+
+	require.NoError(t, err)
+	assert.False(t, result.HasViolations())
+
+	fee, _ := result.Balance("bln_fee")
+	tax, _ := result.Balance("bln_tax")
+	merchant, _ := result.Balance("bln_merchant")
+	source, _ := result.Balance("bln_source")
+	assert.Equal(t, "1000", fee.Balance.String())
+	assert.Equal(t, "500", tax.Balance.String())
+	assert.Equal(t, "8500", merchant.Balance.String())
+	assert.Equal(t, "-10000", source.Balance.String())
+}
+
+func TestSimulate_Inflight(t *testing.T) {
+	result, err := blnkgo.Simulate(blnkgo.CreateTransactionRequest{
+		ParentTransaction: blnkgo.ParentTransaction{
+			PreciseAmount: big.NewInt(3000),
+			Currency:      "USD",
+			Reference:     "ref_sim_inflight",
+			Source:        "bln_source",
+			Destination:   "bln_dest",
+		},
+		Inflight: true,
+	}, []blnkgo.LedgerBalance{simulationBalance("bln_source", 5000, 0)})
+
+	require.NoError(t, err)
+	assert.False(t, result.HasViolations())
+
+	source, _ := result.Balance("bln_source")
+	assert.Equal(t, "5000", source.Balance.String())
+	assert.Equal(t, "3000", source.InflightDebitBalance.String())
+	assert.Equal(t, "-3000", source.InflightBalance.String())
+
+	dest, _ := result.Balance("bln_dest")
+	assert.Equal(t, "0", dest.Balance.String())
+	assert.Equal(t, "3000", dest.InflightCreditBalance.String())
+}
+
+func TestSimulate_OverdraftViolation(t *testing.T) {
+	result, err := blnkgo.Simulate(blnkgo.CreateTransactionRequest{
+		ParentTransaction: blnkgo.ParentTransaction{
+			Amount:      60,
+			Precision:   100,
+			Currency:    "USD",
+			Reference:   "ref_sim_overdraft",
+			Source:      "bln_source",
+			Destination: "bln_dest",
+		},
+	}, []blnkgo.LedgerBalance{simulationBalance("bln_source", 5000, 0)})
+
+	require.NoError(t, err)
+	require.True(t, result.HasViolations())
+	assert.Equal(t, "bln_source", result.Violations[0].Identifier)
+	assert.Equal(t, "ref_sim_overdraft", result.Violations[0].Reference)
+	assert.Equal(t, "1000", result.Violations[0].Shortfall.String())
+}
+
+func TestSimulate_CurrencyMismatch(t *testing.T) {
+	_, err := blnkgo.Simulate(blnkgo.CreateTransactionRequest{
+		ParentTransaction: blnkgo.ParentTransaction{
+			Amount:      1,
+			Currency:    "EUR",
+			Reference:   "ref_sim_currency",
+			Source:      "bln_source",
+			Destination: "bln_dest",
+		},
+	}, []blnkgo.LedgerBalance{simulationBalance("bln_source", 5000, 0)})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "currency")
+}
+
+func TestSimulateBulk_AppliesInOrder(t *testing.T) {
+	result, err := blnkgo.SimulateBulk(blnkgo.CreateBulkTransactionRequest{
+		Transactions: []blnkgo.CreateTransactionRequest{
+			{ParentTransaction: blnkgo.ParentTransaction{
+				PreciseAmount: big.NewInt(4000), Currency: "USD", Reference: "bulk_1",
+				Source: "bln_source", Destination: "bln_dest",
+			}},
+			{ParentTransaction: blnkgo.ParentTransaction{
+				PreciseAmount: big.NewInt(2000), Currency: "USD", Reference: "bulk_2",
+				Source: "bln_source", Destination: "bln_dest",
+			}},
+		},
+	}, []blnkgo.LedgerBalance{simulationBalance("bln_source", 5000, 0)})
+
+	require.NoError(t, err)
+	require.Len(t, result.Violations, 1)
+	assert.Equal(t, "bulk_2", result.Violations[0].Reference)
+
+	dest, _ := result.Balance("bln_dest")
+	assert.Equal(t, "6000", dest.Balance.String())
+}
+
+func TestSimulate_InvalidRequest(t *testing.T) {
+	_, err := blnkgo.Simulate(blnkgo.CreateTransactionRequest{}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "validation error")
+}
+
+func TestSimulate_BalanceOnlySnapshot(t *testing.T) {
+	result, err := blnkgo.Simulate(blnkgo.CreateTransactionRequest{
+		ParentTransaction: blnkgo.ParentTransaction{
+			PreciseAmount: big.NewInt(2000),
+			Currency:      "USD",
+			Reference:     "ref_sim_balance_only",
+			Source:        "bln_source",
+			Destination:   "bln_dest",
+		},
+	}, []blnkgo.LedgerBalance{{BalanceID: "bln_source", Currency: "USD", Balance: big.NewInt(5000)}})
+
+	require.NoError(t, err)
+	assert.False(t, result.HasViolations())
+	source, _ := result.Balance("bln_source")
+	assert.Equal(t, "3000", source.Balance.String())
+	assert.Equal(t, "2000", source.DebitBalance.String())
+}
+
+func TestSimulate_UnallocatedRemainder(t *testing.T) {
+	_, err := blnkgo.Simulate(blnkgo.CreateTransactionRequest{
+		ParentTransaction: blnkgo.ParentTransaction{
+			PreciseAmount: big.NewInt(1001),
+			Currency:      "USD",
+			Reference:     "ref_sim_remainder",
+			Source:        "bln_source",
+			Destinations: []blnkgo.Source{
+				{Identifier: "bln_a", Distribution: "50%"},
+				{Identifier: "bln_b", Distribution: "50%"},
+			},
+		},
+		AllowOverdraft: true,
+	}, nil)
+	assert.ErrorContains(t, err, "unallocated")
+}
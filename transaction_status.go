@@ -0,0 +1,134 @@
+package blnkgo
+
+import "fmt"
+
+// TransactionAction is an operation whose validity depends on the current
+// transaction status.
+type TransactionAction string
+
+const (
+	TransactionActionCommit TransactionAction = "commit"
+	TransactionActionVoid   TransactionAction = "void"
+	TransactionActionRefund TransactionAction = "refund"
+)
+
+// transactionStatusTransitions is the status graph Core follows: queued
+// transactions are applied, held or rejected; inflight holds are committed
+// (reported as COMMIT or APPLIED), voided or expire; every other status is
+// final.
+var transactionStatusTransitions = map[PryTransactionStatus][]PryTransactionStatus{
+	PryTransactionStatusQueued: {
+		PryTransactionStatusApplied,
+		PryTransactionStatusInFlight,
+		PryTransactionStatusRejected,
+	},
+	PryTransactionStatusInFlight: {
+		PryTransactionStatusCommit,
+		PryTransactionStatusApplied,
+		PryTransactionStatusVoid,
+		PryTransactionStatusExpired,
+	},
+}
+
+// IsValid reports whether s is one of the statuses Core returns.
+func (s PryTransactionStatus) IsValid() bool {
+	switch s {
+	case PryTransactionStatusQueued, PryTransactionStatusApplied, PryTransactionStatusRejected,
+		PryTransactionStatusCommit, PryTransactionStatusVoid, PryTransactionStatusInFlight,
+		PryTransactionStatusExpired:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsTerminal reports whether no further status transition is possible.
+func (s PryTransactionStatus) IsTerminal() bool {
+	return s.IsValid() && len(transactionStatusTransitions[s]) == 0
+}
+
+// IsSettled reports whether s has moved funds on the balances: APPLIED, or
+// COMMIT for a committed hold. Reports that total money movement count only
+// settled transactions.
+func (s PryTransactionStatus) IsSettled() bool {
+	return s == PryTransactionStatusApplied || s == PryTransactionStatusCommit
+}
+
+// AllowedTransitions returns the statuses s can move to.
+func (s PryTransactionStatus) AllowedTransitions() []PryTransactionStatus {
+	next := transactionStatusTransitions[s]
+	out := make([]PryTransactionStatus, len(next))
+	copy(out, next)
+	return out
+}
+
+// CanTransitionTo reports whether Core allows moving from s to next.
+func (s PryTransactionStatus) CanTransitionTo(next PryTransactionStatus) bool {
+	for _, allowed := range transactionStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// CanCommit reports whether an inflight commit (full or partial) is allowed.
+func (s PryTransactionStatus) CanCommit() bool {
+	return s.CanTransitionTo(PryTransactionStatusCommit)
+}
+
+// CanVoid reports whether an inflight void is allowed.
+func (s PryTransactionStatus) CanVoid() bool {
+	return s.CanTransitionTo(PryTransactionStatusVoid)
+}
+
+// CanRefund reports whether the transaction has moved funds that can be refunded.
+func (s PryTransactionStatus) CanRefund() bool {
+	return s == PryTransactionStatusApplied || s == PryTransactionStatusCommit
+}
+
+// Allows reports whether action is permitted in status s.
+func (s PryTransactionStatus) Allows(action TransactionAction) bool {
+	switch action {
+	case TransactionActionCommit:
+		return s.CanCommit()
+	case TransactionActionVoid:
+		return s.CanVoid()
+	case TransactionActionRefund:
+		return s.CanRefund()
+	default:
+		return false
+	}
+}
+
+// TransactionStatusError is returned when an action is not permitted by the
+// transaction's current status.
+type TransactionStatusError struct {
+	TransactionID string
+	Status        PryTransactionStatus
+	Action        TransactionAction
+}
+
+func (e *TransactionStatusError) Error() string {
+	return fmt.Sprintf("transaction %s is %s; %s is not allowed", e.TransactionID, e.Status, e.Action)
+}
+
+// CheckTransactionAction returns a *TransactionStatusError when action is not
+// permitted in status.
+func CheckTransactionAction(transactionID string, status PryTransactionStatus, action TransactionAction) error {
+	if status.Allows(action) {
+		return nil
+	}
+	return &TransactionStatusError{TransactionID: transactionID, Status: status, Action: action}
+}
+
+func inflightStatusAction(status InflightStatus) (TransactionAction, error) {
+	switch status {
+	case InflightStatusCommit:
+		return TransactionActionCommit, nil
+	case InflightStatusVoid:
+		return TransactionActionVoid, nil
+	default:
+		return "", fmt.Errorf("validation error: invalid inflight status %q", status)
+	}
+}
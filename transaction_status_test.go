@@ -0,0 +1,100 @@
+package blnkgo_test
+
+import (
+	"errors"
+	"testing"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPryTransactionStatus_Predicates(t *testing.T) {
+	tests := []struct {
+		status    blnkgo.PryTransactionStatus
+		terminal  bool
+		canCommit bool
+		canVoid   bool
+		canRefund bool
+	}{
+		{blnkgo.PryTransactionStatusQueued, false, false, false, false},
+		{blnkgo.PryTransactionStatusInFlight, false, true, true, false},
+		{blnkgo.PryTransactionStatusApplied, true, false, false, true},
+		{blnkgo.PryTransactionStatusCommit, true, false, false, true},
+		{blnkgo.PryTransactionStatusVoid, true, false, false, false},
+		{blnkgo.PryTransactionStatusRejected, true, false, false, false},
+		{blnkgo.PryTransactionStatusExpired, true, false, false, false},
+		{blnkgo.PryTransactionStatus("UNKNOWN"), false, false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			assert.Equal(t, tt.terminal, tt.status.IsTerminal())
+			assert.Equal(t, tt.canCommit, tt.status.CanCommit())
+			assert.Equal(t, tt.canVoid, tt.status.CanVoid())
+			assert.Equal(t, tt.canRefund, tt.status.CanRefund())
+		})
+	}
+}
+
+func TestPryTransactionStatus_Transitions(t *testing.T) {
+	assert.True(t, blnkgo.PryTransactionStatusQueued.CanTransitionTo(blnkgo.PryTransactionStatusApplied))
+	assert.True(t, blnkgo.PryTransactionStatusInFlight.CanTransitionTo(blnkgo.PryTransactionStatusExpired))
+	assert.True(t, blnkgo.PryTransactionStatusInFlight.CanTransitionTo(blnkgo.PryTransactionStatusApplied))
+	assert.False(t, blnkgo.PryTransactionStatusApplied.CanTransitionTo(blnkgo.PryTransactionStatusVoid))
+	assert.ElementsMatch(t, []blnkgo.PryTransactionStatus{
+		blnkgo.PryTransactionStatusCommit,
+		blnkgo.PryTransactionStatusApplied,
+		blnkgo.PryTransactionStatusVoid,
+		blnkgo.PryTransactionStatusExpired,
+	}, blnkgo.PryTransactionStatusInFlight.AllowedTransitions())
+	assert.Empty(t, blnkgo.PryTransactionStatusVoid.AllowedTransitions())
+}
+
+func TestTransactionService_Update_StatusPreCheck(t *testing.T) {
+	mockClient, svc := setupTransactionService()
+
+	_, resp, err := svc.Update("txn_1", blnkgo.UpdateStatus{
+		Status:         blnkgo.InflightStatusCommit,
+		PrecheckStatus: blnkgo.PryTransactionStatusVoid,
+	})
+
+	var statusErr *blnkgo.TransactionStatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, blnkgo.TransactionActionCommit, statusErr.Action)
+	assert.Equal(t, blnkgo.PryTransactionStatusVoid, statusErr.Status)
+	assert.Equal(t, "txn_1", statusErr.TransactionID)
+	assert.Nil(t, resp)
+	mockClient.AssertNotCalled(t, "NewRequest")
+}
+
+func TestTransactionService_Update_StatusPreCheckRejectsUnknownStatus(t *testing.T) {
+	mockClient, svc := setupTransactionService()
+
+	_, _, err := svc.Update("txn_1", blnkgo.UpdateStatus{
+		Status:         blnkgo.InflightStatus("capture"),
+		PrecheckStatus: blnkgo.PryTransactionStatusInFlight,
+	})
+
+	assert.ErrorContains(t, err, "invalid inflight status")
+	mockClient.AssertNotCalled(t, "NewRequest")
+}
+
+func TestTransactionService_Refund_StatusPreCheck(t *testing.T) {
+	mockClient, svc := setupTransactionService()
+
+	_, resp, err := svc.Refund("txn_1", &blnkgo.RefundTransactionRequest{
+		PrecheckStatus: blnkgo.PryTransactionStatusInFlight,
+	})
+
+	var statusErr *blnkgo.TransactionStatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, blnkgo.TransactionActionRefund, statusErr.Action)
+	assert.Contains(t, err.Error(), "refund is not allowed")
+	assert.Nil(t, resp)
+	mockClient.AssertNotCalled(t, "NewRequest")
+}
+
+func TestCheckTransactionAction(t *testing.T) {
+	assert.NoError(t, blnkgo.CheckTransactionAction("txn_1", blnkgo.PryTransactionStatusInFlight, blnkgo.TransactionActionVoid))
+	assert.Error(t, blnkgo.CheckTransactionAction("txn_1", blnkgo.PryTransactionStatusApplied, blnkgo.TransactionActionVoid))
+}
@@ -0,0 +1,463 @@
+package blnkgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateParamType constrains the values accepted for a template parameter.
+type TemplateParamType string
+
+const (
+	TemplateParamString  TemplateParamType = "string"
+	TemplateParamNumber  TemplateParamType = "number"
+	TemplateParamInteger TemplateParamType = "integer"
+)
+
+// TemplateParam declares a placeholder used in a template body.
+type TemplateParam struct {
+	Name     string            `json:"name" yaml:"name"`
+	Type     TemplateParamType `json:"type,omitempty" yaml:"type,omitempty"`
+	Required bool              `json:"required,omitempty" yaml:"required,omitempty"`
+	Default  interface{}       `json:"default,omitempty" yaml:"default,omitempty"`
+	// Sample is used when validating the template at registration. When unset
+	// the Default, or a type-appropriate placeholder value, is used.
+	Sample interface{} `json:"sample,omitempty" yaml:"sample,omitempty"`
+}
+
+// TransactionTemplate is a named transaction shape with {{placeholders}}.
+// Transaction has the JSON shape of a CreateTransactionRequest and Bulk the
+// shape of a CreateBulkTransactionRequest; set exactly one. A string that is
+// exactly "{{name}}" is replaced by the typed parameter value, so numeric
+// fields such as amount can be parameterised; placeholders inside longer
+// strings are interpolated.
+type TransactionTemplate struct {
+	Name        string          `json:"name" yaml:"name"`
+	Description string          `json:"description,omitempty" yaml:"description,omitempty"`
+	Params      []TemplateParam `json:"params,omitempty" yaml:"params,omitempty"`
+	Transaction interface{}     `json:"transaction,omitempty" yaml:"transaction,omitempty"`
+	Bulk        interface{}     `json:"bulk,omitempty" yaml:"bulk,omitempty"`
+}
+
+// TemplateParams are the values substituted into a template at render time.
+type TemplateParams = map[string]interface{}
+
+// TemplateRegistry holds validated transaction templates by name.
+type TemplateRegistry struct {
+	templates map[string]*compiledTemplate
+	mu        sync.RWMutex
+}
+
+type compiledTemplate struct {
+	TransactionTemplate
+	body   interface{}
+	params map[string]TemplateParam
+}
+
+var templatePlaceholderRegex = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+func NewTemplateRegistry() *TemplateRegistry {
+	return &TemplateRegistry{templates: make(map[string]*compiledTemplate)}
+}
+
+// Register validates a template by type-checking parameter defaults, rendering
+// it with sample values and running ValidateCreateTransacation (or
+// ValidateCreateBulkTransaction) on the result.
+func (r *TemplateRegistry) Register(t TransactionTemplate) error {
+	compiled, err := compileTemplate(t)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.templates[t.Name]; exists {
+		return fmt.Errorf("template error: template %q is already registered", t.Name)
+	}
+	r.templates[t.Name] = compiled
+	return nil
+}
+
+// LoadJSON registers one template object or an array of templates.
+func (r *TemplateRegistry) LoadJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("template error: %w", err)
+	}
+	return r.load(raw)
+}
+
+// LoadYAML registers one template document or a list of templates.
+func (r *TemplateRegistry) LoadYAML(data []byte) error {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("template error: %w", err)
+	}
+	return r.load(raw)
+}
+
+// LoadFile registers templates from a .json, .yaml or .yml file.
+func (r *TemplateRegistry) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return r.LoadJSON(data)
+	case ".yaml", ".yml":
+		return r.LoadYAML(data)
+	default:
+		return fmt.Errorf("template error: unsupported template file extension %q", filepath.Ext(path))
+	}
+}
+
+func (r *TemplateRegistry) load(raw interface{}) error {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("template error: %w", err)
+	}
+
+	var templates []TransactionTemplate
+	if _, isList := raw.([]interface{}); isList {
+		err = json.Unmarshal(data, &templates)
+	} else {
+		var t TransactionTemplate
+		err = json.Unmarshal(data, &t)
+		templates = append(templates, t)
+	}
+	if err != nil {
+		return fmt.Errorf("template error: %w", err)
+	}
+
+	for _, t := range templates {
+		if err := r.Register(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns a registered template.
+func (r *TemplateRegistry) Get(name string) (*TransactionTemplate, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.templates[name]
+	if !ok {
+		return nil, false
+	}
+	copied := t.TransactionTemplate
+	return &copied, true
+}
+
+// Names returns the registered template names in sorted order.
+func (r *TemplateRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.templates))
+	for name := range r.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render produces a CreateTransactionRequest from a single-transaction template.
+func (r *TemplateRegistry) Render(name string, params TemplateParams) (*CreateTransactionRequest, error) {
+	t, err := r.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if t.Transaction == nil {
+		return nil, fmt.Errorf("template error: template %q is a bulk template; use RenderBulk", name)
+	}
+	req := new(CreateTransactionRequest)
+	if err := t.render(params, req); err != nil {
+		return nil, err
+	}
+	if err := ValidateCreateTransacation(*req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// RenderBulk produces a CreateBulkTransactionRequest from a bulk template.
+func (r *TemplateRegistry) RenderBulk(name string, params TemplateParams) (*CreateBulkTransactionRequest, error) {
+	t, err := r.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if t.Bulk == nil {
+		return nil, fmt.Errorf("template error: template %q is a single transaction template; use Render", name)
+	}
+	req := new(CreateBulkTransactionRequest)
+	if err := t.render(params, req); err != nil {
+		return nil, err
+	}
+	if err := ValidateCreateBulkTransaction(*req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (r *TemplateRegistry) lookup(name string) (*compiledTemplate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("template error: template %q is not registered", name)
+	}
+	return t, nil
+}
+
+func compileTemplate(t TransactionTemplate) (*compiledTemplate, error) {
+	if strings.TrimSpace(t.Name) == "" {
+		return nil, errors.New("template error: name is required")
+	}
+	if (t.Transaction == nil) == (t.Bulk == nil) {
+		return nil, fmt.Errorf("template error: template %q must set exactly one of transaction or bulk", t.Name)
+	}
+
+	source := t.Transaction
+	if source == nil {
+		source = t.Bulk
+	}
+	data, err := json.Marshal(source)
+	if err != nil {
+		return nil, fmt.Errorf("template error: %q: %w", t.Name, err)
+	}
+	var body interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return nil, fmt.Errorf("template error: %q: %w", t.Name, err)
+	}
+
+	compiled := &compiledTemplate{
+		TransactionTemplate: t,
+		body:                body,
+		params:              make(map[string]TemplateParam, len(t.Params)),
+	}
+	for _, p := range t.Params {
+		if p.Name == "" {
+			return nil, fmt.Errorf("template error: %q: parameter name is required", t.Name)
+		}
+		switch p.Type {
+		case "", TemplateParamString, TemplateParamNumber, TemplateParamInteger:
+		default:
+			return nil, fmt.Errorf("template error: %q: parameter %s has unknown type %q", t.Name, p.Name, p.Type)
+		}
+		if p.Default != nil {
+			checked, err := p.check(p.Default)
+			if err != nil {
+				return nil, fmt.Errorf("template error: %q: default for parameter %s is not a valid %s", t.Name, p.Name, p.Type)
+			}
+			p.Default = checked
+		}
+		compiled.params[p.Name] = p
+	}
+
+	for _, name := range templatePlaceholders(body) {
+		if _, ok := compiled.params[name]; !ok {
+			compiled.params[name] = TemplateParam{Name: name, Required: true}
+		}
+	}
+
+	sample := make(TemplateParams, len(compiled.params))
+	for name, p := range compiled.params {
+		sample[name] = p.sampleValue()
+	}
+	if t.Transaction != nil {
+		var req CreateTransactionRequest
+		if err := compiled.render(sample, &req); err != nil {
+			return nil, err
+		}
+		if err := ValidateCreateTransacation(req); err != nil {
+			return nil, fmt.Errorf("template error: %q: %w", t.Name, err)
+		}
+	} else {
+		var req CreateBulkTransactionRequest
+		if err := compiled.render(sample, &req); err != nil {
+			return nil, err
+		}
+		if err := ValidateCreateBulkTransaction(req); err != nil {
+			return nil, fmt.Errorf("template error: %q: %w", t.Name, err)
+		}
+	}
+	return compiled, nil
+}
+
+func (p TemplateParam) sampleValue() interface{} {
+	if p.Sample != nil {
+		return p.Sample
+	}
+	if p.Default != nil {
+		return p.Default
+	}
+	switch p.Type {
+	case TemplateParamNumber, TemplateParamInteger:
+		return 1
+	default:
+		return "sample_" + p.Name
+	}
+}
+
+func (p TemplateParam) check(value interface{}) (interface{}, error) {
+	switch p.Type {
+	case TemplateParamNumber, TemplateParamInteger:
+		n, ok := templateNumber(value)
+		if !ok {
+			return nil, fmt.Errorf("template error: parameter %s must be a %s", p.Name, p.Type)
+		}
+		if p.Type == TemplateParamInteger && strings.ContainsAny(n.String(), ".eE") {
+			return nil, fmt.Errorf("template error: parameter %s must be an integer", p.Name)
+		}
+		return n, nil
+	case TemplateParamString:
+		if _, ok := value.(string); !ok {
+			return nil, fmt.Errorf("template error: parameter %s must be a string", p.Name)
+		}
+	}
+	return value, nil
+}
+
+func templateNumber(value interface{}) (json.Number, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		return v, true
+	case int:
+		return json.Number(strconv.Itoa(v)), true
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10)), true
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'f', -1, 64)), true
+	case *big.Int:
+		if v == nil {
+			return "", false
+		}
+		return json.Number(v.String()), true
+	case string:
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return json.Number(v), true
+		}
+	}
+	return "", false
+}
+
+func (t *compiledTemplate) render(params TemplateParams, out interface{}) error {
+	values := make(map[string]interface{}, len(t.params))
+	for name, value := range params {
+		p, ok := t.params[name]
+		if !ok {
+			return fmt.Errorf("template error: %q has no parameter %s", t.Name, name)
+		}
+		checked, err := p.check(value)
+		if err != nil {
+			return err
+		}
+		values[name] = checked
+	}
+	for name, p := range t.params {
+		if _, ok := values[name]; ok {
+			continue
+		}
+		if p.Default != nil {
+			values[name] = p.Default
+			continue
+		}
+		if p.Required {
+			return fmt.Errorf("template error: %q requires parameter %s", t.Name, name)
+		}
+	}
+
+	rendered, err := substitutePlaceholders(t.body, values)
+	if err != nil {
+		return fmt.Errorf("template error: %q: %w", t.Name, err)
+	}
+	data, err := json.Marshal(rendered)
+	if err != nil {
+		return fmt.Errorf("template error: %q: %w", t.Name, err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("template error: %q: %w", t.Name, err)
+	}
+	return nil
+}
+
+func substitutePlaceholders(node interface{}, values map[string]interface{}) (interface{}, error) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			rendered, err := substitutePlaceholders(child, values)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			rendered, err := substitutePlaceholders(child, values)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	case string:
+		if m := templatePlaceholderRegex.FindStringSubmatch(v); m != nil && m[0] == v {
+			return values[m[1]], nil
+		}
+		return templatePlaceholderRegex.ReplaceAllStringFunc(v, func(match string) string {
+			name := templatePlaceholderRegex.FindStringSubmatch(match)[1]
+			if value, ok := values[name]; ok && value != nil {
+				return fmt.Sprint(value)
+			}
+			return ""
+		}), nil
+	default:
+		return v, nil
+	}
+}
+
+func templatePlaceholders(node interface{}) []string {
+	seen := make(map[string]struct{})
+	var walk func(interface{})
+	walk = func(n interface{}) {
+		switch v := n.(type) {
+		case map[string]interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		case string:
+			for _, m := range templatePlaceholderRegex.FindAllStringSubmatch(v, -1) {
+				seen[m[1]] = struct{}{}
+			}
+		}
+	}
+	walk(node)
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
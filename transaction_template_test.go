@@ -0,0 +1,170 @@
+package blnkgo_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func feeSplitTemplate() blnkgo.TransactionTemplate {
+	return blnkgo.TransactionTemplate{
+		Name: "fee_split",
+		Params: []blnkgo.TemplateParam{
+			{Name: "amount", Type: blnkgo.TemplateParamNumber, Required: true, Sample: 100},
+			{Name: "fee_pct", Type: blnkgo.TemplateParamNumber, Default: 2.5},
+			{Name: "customer", Type: blnkgo.TemplateParamString, Required: true},
+			{Name: "order_id", Type: blnkgo.TemplateParamString, Required: true},
+		},
+		Transaction: map[string]interface{}{
+			"amount":    "{{amount}}",
+			"precision": 100,
+			"currency":  "USD",
+			"reference": "order_{{order_id}}",
+			"source":    "{{customer}}",
+			"destinations": []interface{}{
+				map[string]interface{}{"identifier": "@revenue", "distribution": "{{fee_pct}}%"},
+				map[string]interface{}{"identifier": "@merchant", "distribution": "left"},
+			},
+			"meta_data": map[string]interface{}{"order_id": "{{order_id}}"},
+		},
+	}
+}
+
+func TestTemplateRegistry_RegisterAndRender(t *testing.T) {
+	registry := blnkgo.NewTemplateRegistry()
+	require.NoError(t, registry.Register(feeSplitTemplate()))
+
+	req, err := registry.Render("fee_split", blnkgo.TemplateParams{
+		"amount":   250.75,
+		"customer": "bln_customer",
+		"order_id": "A-1",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 250.75, req.Amount)
+	assert.Equal(t, int64(100), req.Precision)
+	assert.Equal(t, "order_A-1", req.Reference)
+	assert.Equal(t, "bln_customer", req.Source)
+	require.Len(t, req.Destinations, 2)
+	assert.Equal(t, blnkgo.Distribution("2.5%"), req.Destinations[0].Distribution)
+	assert.Equal(t, "A-1", req.MetaData["order_id"])
+}
+
+func TestTemplateRegistry_RenderErrors(t *testing.T) {
+	registry := blnkgo.NewTemplateRegistry()
+	require.NoError(t, registry.Register(feeSplitTemplate()))
+
+	_, err := registry.Render("fee_split", blnkgo.TemplateParams{"amount": 10, "customer": "bln_c"})
+	assert.ErrorContains(t, err, "requires parameter order_id")
+
+	_, err = registry.Render("fee_split", blnkgo.TemplateParams{"amount": "ten", "customer": "bln_c", "order_id": "1"})
+	assert.ErrorContains(t, err, "must be a number")
+
+	_, err = registry.Render("fee_split", blnkgo.TemplateParams{"amount": 10, "customer": "bln_c", "order_id": "1", "typo": 1})
+	assert.ErrorContains(t, err, "has no parameter typo")
+
+	_, err = registry.Render("missing", nil)
+	assert.ErrorContains(t, err, "not registered")
+
+	_, err = registry.RenderBulk("fee_split", nil)
+	assert.ErrorContains(t, err, "use Render")
+}
+
+func TestTemplateRegistry_RegisterValidatesSample(t *testing.T) {
+	registry := blnkgo.NewTemplateRegistry()
+
+	err := registry.Register(blnkgo.TransactionTemplate{
+		Name:   "broken",
+		Params: []blnkgo.TemplateParam{{Name: "amount", Type: blnkgo.TemplateParamNumber}},
+		Transaction: map[string]interface{}{
+			"amount":      "{{amount}}",
+			"currency":    "USD",
+			"source":      "{{source}}",
+			"destination": "{{source}}",
+			"sources":     []interface{}{map[string]interface{}{"identifier": "a", "distribution": "100%"}},
+		},
+	})
+	assert.ErrorContains(t, err, "Source and Sources")
+
+	badDefault := feeSplitTemplate()
+	badDefault.Name = "bad_default"
+	badDefault.Params[1].Default = "two and a half"
+	assert.ErrorContains(t, registry.Register(badDefault), "default for parameter fee_pct is not a valid number")
+	_, ok := registry.Get("bad_default")
+	assert.False(t, ok)
+
+	require.NoError(t, registry.Register(feeSplitTemplate()))
+	assert.ErrorContains(t, registry.Register(feeSplitTemplate()), "already registered")
+}
+
+func TestTemplateRegistry_LoadYAMLBulk(t *testing.T) {
+	registry := blnkgo.NewTemplateRegistry()
+
+	err := registry.LoadYAML([]byte(`
+- name: card_hold
+  params:
+    - name: amount
+      type: integer
+    - name: card
+  bulk:
+    atomic: true
+    inflight: true
+    transactions:
+      - precise_amount: "{{amount}}"
+        currency: USD
+        reference: "hold_{{card}}"
+        source: "{{card}}"
+        destination: "@card-holds"
+      - precise_amount: 50
+        currency: USD
+        reference: "hold_fee_{{card}}"
+        source: "{{card}}"
+        destination: "@revenue"
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"card_hold"}, registry.Names())
+
+	bulk, err := registry.RenderBulk("card_hold", blnkgo.TemplateParams{"amount": 12000, "card": "bln_card_1"})
+	require.NoError(t, err)
+	assert.True(t, bulk.Atomic)
+	assert.True(t, bulk.Inflight)
+	require.Len(t, bulk.Transactions, 2)
+	assert.Equal(t, "12000", bulk.Transactions[0].PreciseAmount.String())
+	assert.Equal(t, "hold_bln_card_1", bulk.Transactions[0].Reference)
+
+	_, err = registry.RenderBulk("card_hold", blnkgo.TemplateParams{"amount": 1.5, "card": "bln_card_1"})
+	assert.ErrorContains(t, err, "must be an integer")
+}
+
+func TestTemplateRegistry_LoadFileJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "templates.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"name": "payout",
+		"params": [{"name": "amount", "type": "number"}, {"name": "seller"}],
+		"transaction": {
+			"amount": "{{amount}}",
+			"currency": "USD",
+			"reference": "payout_{{seller}}",
+			"source": "{{seller}}",
+			"destination": "@settlement"
+		}
+	}`), 0o600))
+
+	registry := blnkgo.NewTemplateRegistry()
+	require.NoError(t, registry.LoadFile(path))
+
+	tmpl, ok := registry.Get("payout")
+	require.True(t, ok)
+	assert.Len(t, tmpl.Params, 2)
+
+	req, err := registry.Render("payout", blnkgo.TemplateParams{"amount": 42, "seller": "bln_seller"})
+	require.NoError(t, err)
+	assert.Equal(t, float64(42), req.Amount)
+	assert.Equal(t, "@settlement", req.Destination)
+
+	assert.Error(t, registry.LoadFile(filepath.Join(t.TempDir(), "templates.txt")))
+}
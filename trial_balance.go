@@ -0,0 +1,174 @@
+package blnkgo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"text/tabwriter"
+	"time"
+)
+
+// ErrTrialBalanceUnbalanced is returned by TrialBalanceReport.Err when any
+// currency's debits and credits do not net to zero.
+var ErrTrialBalanceUnbalanced = errors.New("trial balance does not net to zero")
+
+// TrialBalanceOptions selects the balances in a trial balance. An empty
+// LedgerID covers every ledger, including internal balances such as @World,
+// which is what a system-wide zero-sum check needs.
+type TrialBalanceOptions struct {
+	LedgerID string
+	// Filters are added to the ledger filter, e.g. to skip test balances.
+	Filters []Filter
+	// IncludeBalances keeps every balance in the report, not only the totals.
+	IncludeBalances bool
+	// PageSize is the number of balances per Filter call. Zero uses the default.
+	PageSize int
+}
+
+// TrialBalanceLine is one balance in a trial balance, in minor units.
+type TrialBalanceLine struct {
+	BalanceID     string   `json:"balance_id"`
+	LedgerID      string   `json:"ledger_id"`
+	Indicator     string   `json:"indicator,omitempty"`
+	Currency      string   `json:"currency"`
+	DebitBalance  *big.Int `json:"debit_balance"`
+	CreditBalance *big.Int `json:"credit_balance"`
+	Balance       *big.Int `json:"balance"`
+}
+
+// TrialBalanceTotal sums one currency. Net is CreditBalance minus
+// DebitBalance and is zero when the currency balances.
+type TrialBalanceTotal struct {
+	Currency      string   `json:"currency"`
+	Balances      int      `json:"balances"`
+	DebitBalance  *big.Int `json:"debit_balance"`
+	CreditBalance *big.Int `json:"credit_balance"`
+	Net           *big.Int `json:"net"`
+	// BalanceSum is the sum of every Balance; it differs from Net when a
+	// balance's stored figures disagree with each other.
+	BalanceSum *big.Int `json:"balance_sum"`
+	Balanced   bool     `json:"balanced"`
+}
+
+// TrialBalanceReport is the result of a trial balance run.
+type TrialBalanceReport struct {
+	GeneratedAt time.Time           `json:"generated_at"`
+	LedgerID    string              `json:"ledger_id,omitempty"`
+	Totals      []TrialBalanceTotal `json:"totals"`
+	Balances    []TrialBalanceLine  `json:"balances,omitempty"`
+	Balanced    bool                `json:"balanced"`
+}
+
+// Unbalanced returns the totals that do not net to zero.
+func (r *TrialBalanceReport) Unbalanced() []TrialBalanceTotal {
+	var out []TrialBalanceTotal
+	for _, t := range r.Totals {
+		if !t.Balanced {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Err returns ErrTrialBalanceUnbalanced naming the failing currencies, or nil.
+func (r *TrialBalanceReport) Err() error {
+	unbalanced := r.Unbalanced()
+	if len(unbalanced) == 0 {
+		return nil
+	}
+	msg := ""
+	for i, t := range unbalanced {
+		if i > 0 {
+			msg += ", "
+		}
+		msg += fmt.Sprintf("%s net %s", t.Currency, t.Net)
+	}
+	return fmt.Errorf("%w: %s", ErrTrialBalanceUnbalanced, msg)
+}
+
+// WriteText writes the totals as an aligned table, flagging currencies that do
+// not net to zero.
+func (r *TrialBalanceReport) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "CURRENCY\tBALANCES\tDEBITS\tCREDITS\tNET\t\t")
+	for _, t := range r.Totals {
+		flag := ""
+		if !t.Balanced {
+			flag = "UNBALANCED"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t\n", t.Currency, t.Balances, t.DebitBalance, t.CreditBalance, t.Net, flag)
+	}
+	return tw.Flush()
+}
+
+// TrialBalance pages through the selected balances and sums debit and credit
+// balances per currency. Balances are not held in memory unless
+// IncludeBalances is set, so it is safe to run over every ledger.
+func (s *LedgerBalanceService) TrialBalance(options TrialBalanceOptions) (*TrialBalanceReport, error) {
+	params := FilterParams{
+		Filters:   append([]Filter(nil), options.Filters...),
+		SortBy:    "created_at",
+		SortOrder: "asc",
+		Limit:     options.PageSize,
+	}
+	if options.LedgerID != "" {
+		params.Filters = append(params.Filters, Filter{Field: "ledger_id", Operator: OpEqual, Value: options.LedgerID})
+	}
+	if params.Limit <= 0 {
+		params.Limit = defaultFilterPageSize
+	}
+
+	report := &TrialBalanceReport{GeneratedAt: time.Now().UTC(), LedgerID: options.LedgerID, Balanced: true}
+	totals := map[string]*TrialBalanceTotal{}
+	for {
+		response, _, err := s.Filter(params)
+		if err != nil {
+			return nil, err
+		}
+		var page []LedgerBalance
+		if err := response.DecodeData(&page); err != nil {
+			return nil, err
+		}
+		for _, b := range page {
+			total, ok := totals[b.Currency]
+			if !ok {
+				total = &TrialBalanceTotal{
+					Currency:      b.Currency,
+					DebitBalance:  big.NewInt(0),
+					CreditBalance: big.NewInt(0),
+					BalanceSum:    big.NewInt(0),
+				}
+				totals[b.Currency] = total
+			}
+			total.Balances++
+			total.DebitBalance.Add(total.DebitBalance, cloneBigInt(b.DebitBalance))
+			total.CreditBalance.Add(total.CreditBalance, cloneBigInt(b.CreditBalance))
+			total.BalanceSum.Add(total.BalanceSum, cloneBigInt(b.Balance))
+			if options.IncludeBalances {
+				report.Balances = append(report.Balances, TrialBalanceLine{
+					BalanceID:     b.BalanceID,
+					LedgerID:      b.LedgerID,
+					Indicator:     b.Indicator,
+					Currency:      b.Currency,
+					DebitBalance:  cloneBigInt(b.DebitBalance),
+					CreditBalance: cloneBigInt(b.CreditBalance),
+					Balance:       cloneBigInt(b.Balance),
+				})
+			}
+		}
+		if len(page) < params.Limit {
+			break
+		}
+		params.Offset += params.Limit
+	}
+
+	for _, currency := range sortedKeys(totals) {
+		total := totals[currency]
+		total.Net = new(big.Int).Sub(total.CreditBalance, total.DebitBalance)
+		total.Balanced = total.Net.Sign() == 0 && total.BalanceSum.Sign() == 0
+		report.Balanced = report.Balanced && total.Balanced
+		report.Totals = append(report.Totals, *total)
+	}
+	return report, nil
+}
@@ -0,0 +1,60 @@
+package blnkgo_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+
+	blnkgo "github.com/blnkfinance/blnk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func trialBalance(id, currency string, debit, credit int64) map[string]interface{} {
+	return map[string]interface{}{
+		"balance_id": id, "ledger_id": "ldg_main", "currency": currency,
+		"debit_balance": debit, "credit_balance": credit, "balance": credit - debit,
+	}
+}
+
+func TestLedgerBalanceService_TrialBalance(t *testing.T) {
+	mockClient, svc := setupLedgerBalanceService()
+	pages := [][]interface{}{
+		{trialBalance("bln_world", "USD", 15000, 0), trialBalance("bln_a", "USD", 2000, 12000)},
+		{trialBalance("bln_b", "USD", 0, 5000), trialBalance("bln_eur", "EUR", 0, 700)},
+		{},
+	}
+	var sent []blnkgo.FilterParams
+	mockClient.On("NewRequest", "balances/filter", http.MethodPost, mock.Anything).Return(&http.Request{}, nil).Run(func(args mock.Arguments) {
+		sent = append(sent, args.Get(2).(blnkgo.FilterParams))
+	})
+	mockClient.On("CallWithRetry", mock.Anything, mock.AnythingOfType("*blnkgo.FilterResponse")).Return(&http.Response{StatusCode: http.StatusOK}, nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*blnkgo.FilterResponse).Data = pages[len(sent)-1]
+	})
+
+	report, err := svc.TrialBalance(blnkgo.TrialBalanceOptions{LedgerID: "ldg_main", PageSize: 2, IncludeBalances: true})
+	require.NoError(t, err)
+	require.Len(t, sent, 3)
+	assert.Equal(t, "ledger_id", sent[0].Filters[0].Field)
+	assert.Equal(t, 2, sent[1].Offset)
+
+	require.Len(t, report.Totals, 2)
+	eur, usd := report.Totals[0], report.Totals[1]
+	assert.Equal(t, "EUR", eur.Currency)
+	assert.False(t, eur.Balanced)
+	assert.Equal(t, "700", eur.Net.String())
+	assert.True(t, usd.Balanced)
+	assert.Equal(t, 3, usd.Balances)
+	assert.Equal(t, "17000", usd.DebitBalance.String())
+	assert.Len(t, report.Balances, 4)
+
+	assert.False(t, report.Balanced)
+	assert.True(t, errors.Is(report.Err(), blnkgo.ErrTrialBalanceUnbalanced))
+	assert.Contains(t, report.Err().Error(), "EUR net 700")
+
+	var out bytes.Buffer
+	require.NoError(t, report.WriteText(&out))
+	assert.Contains(t, out.String(), "UNBALANCED")
+}